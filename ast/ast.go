@@ -3,12 +3,15 @@ package ast
 import (
 	"bytes"
 	"dodo-lang/token"
+	"path/filepath"
+	"reflect"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // Position of the token the node was parsed from
 }
 
 type Statement interface {
@@ -21,6 +24,14 @@ type Expression interface {
 	expressionNode() // Dummy method helping the Go compiler for better debugging
 }
 
+// Pattern is matched against a value by match arms and destructuring lets and
+// parameters, binding the identifiers in it to the parts of the value they
+// matched
+type Pattern interface {
+	Node
+	patternNode()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -33,6 +44,14 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 && !IsNil(p.Statements[0]) {
+		return p.Statements[0].Pos()
+	} else {
+		return token.Position{}
+	}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -49,17 +68,31 @@ type Identifier struct {
 }
 
 func (i *Identifier) expressionNode()      {}
+func (i *Identifier) patternNode()         {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type LetStatement struct {
 	Token   token.Token // token.LET token
 	Name    *Identifier
+	Pattern Pattern // Set instead of Name when destructuring, eg. `let [a, b] = arr;`
 	Value   Expression
 	Mutable bool
 }
 
-func (ls *LetStatement) statementNode() {}
+// Bindings returns the identifiers the statement binds, which are the ones in
+// its pattern when destructuring
+func (ls *LetStatement) Bindings() []*Identifier {
+	if ls.Pattern != nil {
+		return PatternBindings(ls.Pattern)
+	}
+
+	return []*Identifier{ls.Name}
+}
+
+func (ls *LetStatement) statementNode()      {}
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
 func (ls *LetStatement) TokenLiteral() string {
 	if ls.Mutable {
 		return ls.Token.Literal + " mut"
@@ -71,7 +104,13 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -83,18 +122,44 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ReassignmentStatement assigns to a variable, eg. `x = 1`, or to an element
+// of one, eg. `arr[0] += 1` or `obj.field = 2`
 type ReassignmentStatement struct {
-	Token token.Token // token.ASSIGN token
-	Ident *Identifier
-	Value Expression
+	Token  token.Token // token.ASSIGN or a compound assignment token like token.PLUS_ASSIGN
+	Target Expression  // An *Identifier, or an *IndexExpression with an *Identifier at its root
+	Value  Expression
 }
 
 func (ras *ReassignmentStatement) statementNode()       {}
 func (ras *ReassignmentStatement) TokenLiteral() string { return ras.Token.Literal }
+func (ras *ReassignmentStatement) Pos() token.Position  { return ras.Token.Pos }
+
+// Operator returns the operator of a compound assignment, eg. + for +=, or an
+// empty string for a plain assignment
+func (ras *ReassignmentStatement) Operator() string {
+	return token.AssignOperators[ras.Token.Type]
+}
+
+// Root returns the variable being assigned to, or to an element of
+func (ras *ReassignmentStatement) Root() *Identifier {
+	target := ras.Target
+
+	for {
+		switch t := target.(type) {
+		case *Identifier:
+			return t
+		case *IndexExpression:
+			target = t.Left
+		default:
+			return nil
+		}
+	}
+}
+
 func (ls *ReassignmentStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(ls.Ident.String())
+	out.WriteString(ls.Target.String())
 	out.WriteString(" " + ls.TokenLiteral() + " ")
 	out.WriteString(ls.Value.String())
 	out.WriteString(";")
@@ -109,6 +174,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -123,6 +189,199 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises a value as an error, which unwinds the program until a
+// try expression catches it, eg. `throw error("not found");`
+type ThrowStatement struct {
+	Token token.Token // token.THROW
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// BreakStatement leaves the innermost loop, or the loop with the given label
+// when Label is set, eg. `break outer;`
+type BreakStatement struct {
+	Token token.Token // token.BREAK
+	Label *Identifier
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string {
+	if bs.Label != nil {
+		return bs.TokenLiteral() + " " + bs.Label.String() + ";"
+	}
+
+	return bs.TokenLiteral() + ";"
+}
+
+// ContinueStatement skips to the next iteration of the innermost loop, or of
+// the loop with the given label when Label is set
+type ContinueStatement struct {
+	Token token.Token // token.CONTINUE
+	Label *Identifier
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return cs.TokenLiteral() + " " + cs.Label.String() + ";"
+	}
+
+	return cs.TokenLiteral() + ";"
+}
+
+// ImportStatement loads another file as a module, either by path, eg.
+// `import "lib/math.dodo";`, or by name, eg. `import math;`
+type ImportStatement struct {
+	Token token.Token // token.IMPORT
+	Path  string      // Path of the imported file, relative to the importing file
+	Name  *Identifier // Name the module is bound to
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImportStatement) String() string {
+	if is.Name.Token.Type == token.IDENT {
+		return is.TokenLiteral() + " " + is.Name.String() + ";"
+	}
+
+	return is.TokenLiteral() + " \"" + is.Path + "\";"
+}
+
+// FilePath returns the path of the imported file. Paths are relative to the
+// importing file, or the working directory when there is no file (eg. in the
+// REPL).
+func (is *ImportStatement) FilePath() string {
+	if filepath.IsAbs(is.Path) {
+		return is.Path
+	}
+
+	return filepath.Join(filepath.Dir(is.Token.Pos.Filename), is.Path)
+}
+
+// StructStatement declares a struct type, eg. `struct Person { name, age }`,
+// binding its name to a constructor taking the fields as arguments
+type StructStatement struct {
+	Token  token.Token // token.STRUCT
+	Name   *Identifier
+	Fields []*Identifier
+}
+
+func (ss *StructStatement) statementNode()       {}
+func (ss *StructStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *StructStatement) Pos() token.Position  { return ss.Token.Pos }
+func (ss *StructStatement) String() string {
+	fields := []string{}
+
+	for _, f := range ss.Fields {
+		fields = append(fields, f.String())
+	}
+
+	if len(fields) == 0 {
+		return ss.TokenLiteral() + " " + ss.Name.String() + " {}"
+	}
+
+	return ss.TokenLiteral() + " " + ss.Name.String() + " { " + strings.Join(fields, ", ") + " }"
+}
+
+// EnumStatement declares an enum, eg. `enum Shape { Circle(r), Rect(w, h) }`,
+// binding its name and the names of its variants
+type EnumStatement struct {
+	Token    token.Token // token.ENUM
+	Name     *Identifier
+	Variants []*EnumVariant
+}
+
+func (es *EnumStatement) statementNode()       {}
+func (es *EnumStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *EnumStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *EnumStatement) String() string {
+	variants := []string{}
+
+	for _, v := range es.Variants {
+		variants = append(variants, v.String())
+	}
+
+	if len(variants) == 0 {
+		return es.TokenLiteral() + " " + es.Name.String() + " {}"
+	}
+
+	return es.TokenLiteral() + " " + es.Name.String() + " { " + strings.Join(variants, ", ") + " }"
+}
+
+// EnumVariant is a variant of an enum, eg. `Circle(r)`, or `Empty` for one
+// without fields
+type EnumVariant struct {
+	Name   *Identifier
+	Fields []*Identifier // nil for variants without parentheses, which are values rather than constructors
+}
+
+// FieldNames returns the names of the fields of the variant, nil if it has no
+// parentheses
+func (ev *EnumVariant) FieldNames() []string {
+	if ev.Fields == nil {
+		return nil
+	}
+
+	names := []string{}
+
+	for _, f := range ev.Fields {
+		names = append(names, f.Value)
+	}
+
+	return names
+}
+
+func (ev *EnumVariant) String() string {
+	if ev.Fields == nil {
+		return ev.Name.String()
+	}
+
+	fields := []string{}
+
+	for _, f := range ev.Fields {
+		fields = append(fields, f.String())
+	}
+
+	return ev.Name.String() + "(" + strings.Join(fields, ", ") + ")"
+}
+
+// ImplStatement implements methods for a struct or enum, eg.
+// `impl Person { fn greet(self) { ... } }`. Every method takes the receiver of
+// a dot call, eg. p in `p.greet()`, as its first parameter.
+type ImplStatement struct {
+	Token   token.Token // token.IMPL
+	Name    *Identifier
+	Methods []*FunctionLiteral // Named by the Name of each function
+}
+
+func (is *ImplStatement) statementNode()       {}
+func (is *ImplStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImplStatement) Pos() token.Position  { return is.Token.Pos }
+func (is *ImplStatement) String() string {
+	methods := []string{}
+
+	for _, m := range is.Methods {
+		methods = append(methods, m.TokenLiteral()+" "+m.Name+m.signature()+" "+m.Body.String())
+	}
+
+	if len(methods) == 0 {
+		return is.TokenLiteral() + " " + is.Name.String() + " {}"
+	}
+
+	return is.TokenLiteral() + " " + is.Name.String() + " { " + strings.Join(methods, " ") + " }"
+}
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -130,6 +389,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -145,8 +405,19 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -154,22 +425,59 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// InterpolatedString is a string literal with embedded expressions, eg.
+// "sum is ${sum(xs)}". Parts are kept in source order, the text between the
+// embedded expressions as string literals with a TEMPLATE token, telling them
+// apart from embedded string literals like ${"a"}.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if sl, ok := part.(*StringLiteral); ok && sl.Token.Type == token.TEMPLATE {
+			out.WriteString(sl.Value)
+			continue
+		}
+
+		out.WriteString("${" + part.String() + "}")
+	}
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression   // Keys of Pairs in source order
+	End   token.Position // Position of the closing } token
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
 
-	for k, v := range hl.Pairs {
-		pairs = append(pairs, k.String()+":"+v.String())
+	if hl.Keys != nil {
+		for _, k := range hl.Keys {
+			pairs = append(pairs, k.String()+":"+hl.Pairs[k].String())
+		}
+	} else {
+		for k, v := range hl.Pairs {
+			pairs = append(pairs, k.String()+":"+v.String())
+		}
 	}
 
 	out.WriteString("{")
@@ -185,15 +493,18 @@ type DollarLiteral struct {
 
 func (dl *DollarLiteral) expressionNode()      {}
 func (dl *DollarLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DollarLiteral) Pos() token.Position  { return dl.Token.Pos }
 func (dl *DollarLiteral) String() string       { return dl.Token.Literal }
 
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	End      token.Position // Position of the closing ] token
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -216,8 +527,18 @@ type IndexExpression struct {
 	Index Expression
 }
 
+// Field returns the name after the dot of a field access, eg. `a.b`. On
+// structs and modules the name picks out a field or binding, on other values
+// it is a variable holding the index.
+func (ie *IndexExpression) Field() (*Identifier, bool) {
+	ident, ok := ie.Index.(*Identifier)
+
+	return ident, ok && ie.Token.Type == token.PERIOD
+}
+
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -230,6 +551,46 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is eg. arr[1:3] or str[::-1], the bounds that are left out
+// are nil
+type SliceExpression struct {
+	Token token.Token // The '[' token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+
+	out.WriteString(":")
+
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+
+	out.WriteString("])")
+
+	return out.String()
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -238,6 +599,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -258,6 +620,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -277,17 +640,19 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
 	Token       token.Token // if token
 	Condition   Expression
 	Consequence *BlockStatement
-	Alternative *BlockStatement
+	Alternative *BlockStatement // For `else if`, a block holding just the next if, with its if token as Token
 }
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -304,32 +669,301 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// IsElseIf reports whether the alternative of ie is another if, chained with
+// `else if`
+func (ie *IfExpression) IsElseIf() bool {
+	return ie.Alternative != nil && ie.Alternative.Token.Type == token.IF
+}
+
+// MatchExpression evaluates the body of the first arm whose pattern matches
+// the subject, eg. `match x { 0 => "zero", n if n < 0 => "negative", _ => "positive" }`
+type MatchExpression struct {
+	Token   token.Token // match token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match ")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+type MatchArm struct {
+	Token   token.Token // First token of the pattern
+	Pattern Pattern
+	Guard   Expression      // nil unless the arm has an if guard
+	Body    *BlockStatement // Arms with an expression body get a block holding just it, with the expression's first token as Token
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// TryExpression evaluates to the value of its body, or to the value of its
+// catch block if the body raised an error, eg.
+// `try { load() } catch (e) { e.message } finally { close() }`. Either the
+// catch or the finally block may be left out, but not both.
+type TryExpression struct {
+	Token   token.Token // try token
+	Body    *BlockStatement
+	Param   *Identifier // Bound to the caught error in Catch
+	Catch   *BlockStatement
+	Finally *BlockStatement // Runs however the try is left
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) Pos() token.Position  { return te.Token.Pos }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Body.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (" + te.Param.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
+// LiteralPattern matches values equal to a literal, eg. 1, -2.5, "a" or true
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) Pos() token.Position  { return lp.Token.Pos }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// ArrayPattern matches arrays element by element, eg. `[a, b]`, or with a
+// rest pattern collecting the remaining elements, eg. `[first, ...rest]`
+type ArrayPattern struct {
+	Token    token.Token // [ token
+	Elements []Pattern
+	Rest     *Identifier // nil unless the pattern ends with ...rest
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches hashmaps holding the given keys, eg. `{"name": n}`,
+// which may hold other keys as well
+type HashPattern struct {
+	Token  token.Token  // { token
+	Keys   []Expression // Literal keys, in source order
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) Pos() token.Position  { return hp.Token.Pos }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// IsNil reports whether node is nil, including typed nil pointers left in
+// the tree by statements that failed to parse
+func IsNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(node)
+
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// PatternBindings returns the identifiers bound by a pattern, in the order
+// they appear in it. The wildcard _ binds nothing.
+func PatternBindings(pattern Pattern) []*Identifier {
+	var bindings []*Identifier
+
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		if pattern.Value != "_" {
+			bindings = append(bindings, pattern)
+		}
+	case *ArrayPattern:
+		for _, el := range pattern.Elements {
+			bindings = append(bindings, PatternBindings(el)...)
+		}
+
+		if pattern.Rest != nil {
+			bindings = append(bindings, PatternBindings(pattern.Rest)...)
+		}
+	case *HashPattern:
+		for _, value := range pattern.Values {
+			bindings = append(bindings, PatternBindings(value)...)
+		}
+	}
+
+	return bindings
+}
+
+// ForExpression is a conditional loop, `for (cond) {...}`, or a three-clause
+// loop, `for (let mut i = 0; i < n; i = i + 1) {...}`, where Init and Post
+// are set and any of the clauses may be left out
 type ForExpression struct {
 	Token     token.Token // for token
+	Label     *Identifier // Set for labeled loops, eg. `outer: for (...) {...}`
+	Init      Statement
 	Condition Expression
+	Post      Statement
 	Body      *BlockStatement
 }
 
 func (fe *ForExpression) expressionNode()      {}
 func (fe *ForExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForExpression) Pos() token.Position  { return fe.Token.Pos }
 func (fe *ForExpression) String() string {
 	var out bytes.Buffer
 
+	if fe.Label != nil {
+		out.WriteString(fe.Label.String() + ": ")
+	}
+
 	out.WriteString("for")
-	out.WriteString(fe.Condition.String())
+
+	if fe.IsThreeClause() {
+		out.WriteString("(")
+
+		if fe.Init != nil {
+			out.WriteString(strings.TrimSuffix(fe.Init.String(), ";"))
+		}
+
+		out.WriteString("; ")
+
+		if fe.Condition != nil {
+			out.WriteString(fe.Condition.String())
+		}
+
+		out.WriteString("; ")
+
+		if fe.Post != nil {
+			out.WriteString(strings.TrimSuffix(fe.Post.String(), ";"))
+		}
+
+		out.WriteString(")")
+	} else {
+		out.WriteString(fe.Condition.String())
+	}
+
 	out.WriteString(" ")
 	out.WriteString(fe.Body.String())
 
 	return out.String()
 }
 
+// IsThreeClause reports whether the loop was written with init, condition and
+// post clauses rather than just a condition
+func (fe *ForExpression) IsThreeClause() bool {
+	return fe.Init != nil || fe.Post != nil || fe.Condition == nil
+}
+
+// ForInExpression iterates over the elements of an array, the characters of a
+// string or the keys of a hashmap, eg. `for (x in arr) {...}`. With a second
+// variable, Key is bound to the index or key and Value to the element, eg.
+// `for (k, v in hashmap) {...}`.
+type ForInExpression struct {
+	Token    token.Token // for token
+	Label    *Identifier
+	Key      *Identifier // nil unless two variables are given
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fi *ForInExpression) expressionNode()      {}
+func (fi *ForInExpression) TokenLiteral() string { return fi.Token.Literal }
+func (fi *ForInExpression) Pos() token.Position  { return fi.Token.Pos }
+func (fi *ForInExpression) String() string {
+	var out bytes.Buffer
+
+	if fi.Label != nil {
+		out.WriteString(fi.Label.String() + ": ")
+	}
+
+	out.WriteString("for(")
+
+	if fi.Key != nil {
+		out.WriteString(fi.Key.String() + ", ")
+	}
+
+	out.WriteString(fi.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fi.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fi.Body.String())
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	End        token.Position // Position of the closing } token
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -343,36 +977,68 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression // Default values of the parameters, nil for parameters without one
+	Patterns   []Pattern    // Patterns destructuring the parameters, nil for plain ones, which are named after the pattern
+	Rest       *Identifier  // Rest parameter collecting the remaining arguments, eg. rest in `fn(x, ...rest)`
 	Body       *BlockStatement
+	Name       string // Name of the let binding or method the function is assigned to, if any
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
-	var out bytes.Buffer
+	return fl.TokenLiteral() + fl.signature() + fl.Body.String()
+}
 
+// signature returns the parameter list of the function in parentheses
+func (fl *FunctionLiteral) signature() string {
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		if def := fl.Default(i); def != nil {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
-	out.WriteString(fl.TokenLiteral())
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(")")
-	out.WriteString(fl.Body.String())
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 
-	return out.String()
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// Default returns the default value of the i:th parameter, or nil if it has
+// none
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i >= len(fl.Defaults) {
+		return nil
+	}
+
+	return fl.Defaults[i]
+}
+
+// Pattern returns the pattern destructuring the i:th parameter, or nil if it
+// is a plain one
+func (fl *FunctionLiteral) Pattern(i int) Pattern {
+	if i >= len(fl.Patterns) {
+		return nil
+	}
+
+	return fl.Patterns[i]
 }
 
 type CallExpression struct {
 	Token     token.Token // The ( token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	Piped     Expression // Left side of a pipe, eg. x in `x |> f($)`, placed among the arguments instead of $
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -389,3 +1055,18 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// NamedArgument is an argument passed to a parameter by name, eg. `y: 2` in
+// `f(1, y: 2)`. Named arguments always come after the positional ones.
+type NamedArgument struct {
+	Token token.Token // The name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) Pos() token.Position  { return na.Token.Pos }
+func (na *NamedArgument) String() string {
+	return na.Name.String() + ": " + na.Value.String()
+}
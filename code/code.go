@@ -0,0 +1,294 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i += 1
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+	OpDup
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpPow
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+
+	OpRange
+	OpRangeInclusive
+
+	OpMinus
+	OpBang
+
+	OpJumpNotTruthy
+	OpJump
+	OpJumpIfPassed
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetGlobalForward
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+	OpGetFree
+	OpGetLocalCell
+	OpSetLocalCell
+	OpGetFreeCell
+	OpSetFreeCell
+	OpGetGlobalCell
+	OpSetGlobalCell
+	OpNewCell
+	OpCurrentClosure
+
+	OpArray
+	OpHash
+	OpIndex
+	OpSlice
+	OpSetIndex
+	OpShare
+	OpField
+	OpInterpolate
+
+	OpIter
+	OpIterNext
+
+	OpMatch
+	OpNoMatch
+	OpDestructure
+
+	OpMethod
+	OpImpl
+
+	OpTry
+	OpEndTry
+	OpThrow
+
+	OpCall
+	OpCallNamed
+	OpReturnValue
+	OpReturn
+	OpClosure
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // Number of bytes each operand takes up
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDup:      {"OpDup", []int{1}}, // Number of elements at the top of the stack to push again
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+	OpPow: {"OpPow", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpRange:          {"OpRange", []int{}},
+	OpRangeInclusive: {"OpRangeInclusive", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpIfPassed:  {"OpJumpIfPassed", []int{2, 1}}, // Where to jump if the parameter got an argument, local index of the parameter
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	// Gets a global referred to before its definition, which raises an error
+	// if it has not been defined yet. The second operand is the constant
+	// index of its name.
+	OpGetGlobalForward: {"OpGetGlobalForward", []int{2, 2}},
+	OpGetLocal:         {"OpGetLocal", []int{1}},
+	OpSetLocal:         {"OpSetLocal", []int{1}},
+	OpGetBuiltin:       {"OpGetBuiltin", []int{1}},
+	OpGetFree:          {"OpGetFree", []int{1}},
+
+	// Mutable variables local to a function or a block are kept in cells, so
+	// closures capturing them share the variable rather than a copy of its value
+	OpGetLocalCell:   {"OpGetLocalCell", []int{1}},
+	OpSetLocalCell:   {"OpSetLocalCell", []int{1}},
+	OpGetFreeCell:    {"OpGetFreeCell", []int{1}},
+	OpSetFreeCell:    {"OpSetFreeCell", []int{1}},
+	OpGetGlobalCell:  {"OpGetGlobalCell", []int{2}},
+	OpSetGlobalCell:  {"OpSetGlobalCell", []int{2}},
+	OpNewCell:        {"OpNewCell", []int{}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSlice:    {"OpSlice", []int{}},     // Pops the step, end and start bounds and what to slice
+	OpSetIndex: {"OpSetIndex", []int{}},  // Pops the value, index and container, pushing the container with the value set
+	OpShare:    {"OpShare", []int{}},     // Gives up ownership of the value on top of the stack, see object.SetIndex
+	OpField:    {"OpField", []int{2, 1}}, // Constant index of the name after a dot, whether a variable of that name was pushed as the index
+
+	OpInterpolate: {"OpInterpolate", []int{2}}, // Number of parts to join into a string
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2, 1}}, // Where to jump once the iterator is done, number of values to push
+
+	OpMatch:       {"OpMatch", []int{2, 2}},    // Constant index of the pattern, where to jump if the popped value does not match
+	OpNoMatch:     {"OpNoMatch", []int{}},      // Pops the subject of a match that no arm matched, failing with an error
+	OpDestructure: {"OpDestructure", []int{2}}, // Constant index of the pattern, failing with an error if the popped value does not match
+
+	OpMethod: {"OpMethod", []int{2, 1}}, // Constant index of the name after a dot, whether a function of that name was pushed below the receiver
+	OpImpl:   {"OpImpl", []int{2}},      // Constant index of the method name, popping the method and the type to implement it for
+
+	OpTry:    {"OpTry", []int{2}}, // Where to continue with the caught value pushed if an error is raised before the matching OpEndTry
+	OpEndTry: {"OpEndTry", []int{}},
+	OpThrow:  {"OpThrow", []int{}}, // Pops the value to raise as an error
+
+	OpCall:        {"OpCall", []int{1}},
+	OpCallNamed:   {"OpCallNamed", []int{2, 1}}, // Constant index of the names of the trailing named arguments, number of arguments
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2, 1}}, // Constant index of the function, number of free variables
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+
+		offset += width
+	}
+
+	return instruction
+}
+
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
@@ -0,0 +1,1606 @@
+package compiler
+
+import (
+	"dodo-lang/ast"
+	"dodo-lang/code"
+	"dodo-lang/object"
+	"dodo-lang/token"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // Position of the node currently being compiled
+
+	// Names bound by the top-level statements of the program, which functions
+	// may refer to before they are defined
+	topLevel map[string]bool
+
+	// Modules are compiled once, no matter how many files import them, and
+	// loading holds the files being compiled to detect import cycles, like in
+	// the evaluator
+	modules map[string]*object.Module
+	loading []string
+
+	// Warnings receives warnings about code that compiles but may not do what
+	// was intended, eg. a let shadowing a variable of an enclosing scope
+	Warnings io.Writer
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	sourceMap           map[int]token.Position
+	loops               []*loop     // Loops enclosing the code being compiled, innermost last
+	blocks              []*block    // Blocks enclosing the code being compiled, innermost last
+	tries               []*tryBlock // Try expressions enclosing the code being compiled, innermost last
+}
+
+// block keeps track of the bindings made in a block, which go out of scope at
+// its end
+type block struct {
+	names    map[string]bool
+	restores []func() // Restore the bindings shadowed by the block
+}
+
+// loop keeps track of the jumps out of a loop being compiled, which can only
+// be patched once the end of the loop is known
+type loop struct {
+	label     string
+	iterator  bool  // Whether the loop keeps an iterator on the stack, which leaving it has to pop
+	breaks    []int // Positions of jumps to the end of the loop
+	continues []int // Positions of jumps to the next iteration
+}
+
+// tryBlock keeps track of the handler and finally block of a try expression,
+// which break, continue and return have to deal with when jumping out of it
+type tryBlock struct {
+	loops   int                 // Number of loops enclosing the try expression
+	handler bool                // Whether the code is inside a handler installed by OpTry
+	finally *ast.BlockStatement // nil if the try expression has no finally block
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	SourceMap    map[int]token.Position
+}
+
+// Error is a compile time error, eg. referencing an undefined identifier
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+
+	return e.Message
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+		sourceMap:    map[int]token.Position{},
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: newGlobalSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+		modules:     map[string]*object.Module{},
+	}
+}
+
+func newGlobalSymbolTable() *SymbolTable {
+	symbolTable := NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return symbolTable
+}
+
+// NewWithState creates a compiler that continues where a previous one left
+// off, used by the interactive mode to keep bindings between inputs
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	// Statements that failed to parse are left in the tree as typed nils
+	if ast.IsNil(node) {
+		return c.errorf("cannot compile incomplete program")
+	}
+
+	prevPos := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = prevPos }()
+
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		c.topLevel = topLevelNames(node)
+
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ReassignmentStatement:
+		return c.compileReassignmentStatement(node)
+	case *ast.StructStatement:
+		return c.compileStructStatement(node)
+	case *ast.ImportStatement:
+		return c.compileImportStatement(node)
+	case *ast.EnumStatement:
+		return c.compileEnumStatement(node)
+	case *ast.ImplStatement:
+		return c.compileImplStatement(node)
+	case *ast.BreakStatement:
+		l, err := c.leaveLoopsFor(node.Label)
+
+		if err != nil {
+			return err
+		}
+
+		if l == nil {
+			return c.errorf("break outside of a loop")
+		}
+
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		l, err := c.leaveLoopsFor(node.Label)
+
+		if err != nil {
+			return err
+		}
+
+		if l == nil {
+			return c.errorf("continue outside of a loop")
+		}
+
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
+	case *ast.ReturnStatement:
+		if node.ReturnValue != nil {
+			if err := c.Compile(node.ReturnValue); err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpNull)
+		}
+
+		if err := c.leaveTries(0); err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+
+	// Expressions
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+
+		if !ok && c.scopeIndex > 0 && c.topLevel[node.Value] {
+			// Whether the global is defined by the time the function runs is
+			// only known then
+			global := c.globalSymbolTable().Reserve(node.Value)
+			c.emit(code.OpGetGlobalForward, global.Index, c.addConstant(&object.String{Value: node.Value}))
+
+			return nil
+		}
+
+		if !ok {
+			return c.throwf("identifier not found: %s", node.Value)
+		}
+
+		c.loadSymbol(symbol)
+
+		// Only a mutable variable can own what it holds
+		if symbol.Mutable {
+			c.emit(code.OpShare)
+		}
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.DollarLiteral:
+		return c.errorf("placeholder %s can only be used as an argument in pipe expressions", node.TokenLiteral())
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpInterpolate, len(node.Parts))
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+
+		// Go maps are unordered, sorting keeps the emitted bytecode deterministic
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, k := range keys {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+
+		c.emit(op)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.MatchExpression:
+		return c.compileMatchExpression(node)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+	case *ast.ForExpression:
+		if node.IsThreeClause() {
+			return c.compileThreeClauseFor(node)
+		}
+
+		return c.compileForExpression(node)
+	case *ast.ForInExpression:
+		return c.compileForInExpression(node)
+	case *ast.IndexExpression:
+		if err := c.compileOperand(node.Left); err != nil {
+			return err
+		}
+
+		if err := c.compileIndex(node); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		if err := c.compileOperand(node.Left); err != nil {
+			return err
+		}
+
+		// Bounds that are left out are passed as null
+		for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+
+			if err := c.Compile(bound); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		isDotCall := node.Token.Type == token.PERIOD
+
+		if isDotCall {
+			if err := c.compileMethod(node); err != nil {
+				return err
+			}
+		} else if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		// Builtins that hold on to an argument share it themselves
+		compileArgument := c.Compile
+
+		if c.isBuiltin(node.Function) && !isDotCall {
+			compileArgument = c.compileOperand
+		}
+
+		names := []object.Object{}
+
+		for i, a := range node.Arguments {
+			if named, ok := a.(*ast.NamedArgument); ok {
+				names = append(names, &object.String{Value: named.Name.Value})
+			}
+
+			// The receiver of a dot call is compiled along with the method
+			if i == 0 && isDotCall {
+				continue
+			}
+
+			if err := compileArgument(a); err != nil {
+				return err
+			}
+		}
+
+		if len(names) > 0 {
+			c.emit(code.OpCallNamed, c.addConstant(&object.Array{Elements: names}), len(node.Arguments))
+		} else {
+			c.emit(code.OpCall, len(node.Arguments))
+		}
+	case *ast.NamedArgument:
+		return c.Compile(node.Value)
+	default:
+		return c.errorf("%T is not supported by the bytecode compiler", node)
+	}
+
+	return nil
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":   code.OpAdd,
+	"-":   code.OpSub,
+	"*":   code.OpMul,
+	"/":   code.OpDiv,
+	"%":   code.OpMod,
+	"**":  code.OpPow,
+	">":   code.OpGreaterThan,
+	"<":   code.OpLessThan,
+	">=":  code.OpGreaterEqual,
+	"<=":  code.OpLessEqual,
+	"==":  code.OpEqual,
+	"!=":  code.OpNotEqual,
+	"..":  code.OpRange,
+	"..=": code.OpRangeInclusive,
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	for _, name := range node.Bindings() {
+		if err := c.checkDeclaration(name); err != nil {
+			return err
+		}
+	}
+
+	if node.Pattern != nil {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		c.emit(code.OpDestructure, c.addConstant(&object.Pattern{Node: node.Pattern}))
+		c.initPatternBindings(node.Pattern, node.Mutable)
+
+		return nil
+	}
+
+	var symbol Symbol
+
+	// Functions are defined before their body is compiled so that they can
+	// refer to themselves recursively
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		symbol = c.define(node.Name.Value, node.Mutable)
+
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+
+		symbol = c.define(node.Name.Value, node.Mutable)
+	}
+
+	c.initSymbol(symbol)
+
+	return nil
+}
+
+// checkDeclaration checks that name can be declared in the current scope.
+// Names may be reused in inner scopes, shadowing the outer binding until the
+// end of the scope, but not twice in the same scope.
+func (c *Compiler) checkDeclaration(name *ast.Identifier) error {
+	if c.declared(name.Value) {
+		return c.throwf("identifier '%s' already exists", name.Value)
+	}
+
+	if symbol, ok := c.symbolTable.Lookup(name.Value); ok && symbol.Scope != BuiltinScope && c.Warnings != nil {
+		fmt.Fprintf(c.Warnings, "%s: warning: '%s' shadows a variable of an enclosing scope\n", name.Token.Pos, name.Value)
+	}
+
+	return nil
+}
+
+// compileStructStatement binds the name of a struct to its type, which is a
+// constant since it is fully known at compile time
+func (c *Compiler) compileStructStatement(node *ast.StructStatement) error {
+	if err := c.checkDeclaration(node.Name); err != nil {
+		return err
+	}
+
+	fields := []string{}
+
+	for _, f := range node.Fields {
+		fields = append(fields, f.Value)
+	}
+
+	c.emit(code.OpConstant, c.addConstant(object.NewStructType(node.Name.Value, fields)))
+	c.initSymbol(c.define(node.Name.Value, false))
+
+	return nil
+}
+
+// compileEnumStatement binds the enum along with each of its variants, which
+// are either constructors or values of the enum, all constants
+func (c *Compiler) compileEnumStatement(node *ast.EnumStatement) error {
+	enum := object.NewEnumType(node.Name.Value)
+	names := []*ast.Identifier{node.Name}
+	values := []object.Object{enum}
+
+	for _, v := range node.Variants {
+		names = append(names, v.Name)
+		values = append(values, enum.AddVariant(v.Name.Value, v.FieldNames()))
+	}
+
+	for i, name := range names {
+		if err := c.checkDeclaration(name); err != nil {
+			return err
+		}
+
+		c.emit(code.OpConstant, c.addConstant(values[i]))
+		c.initSymbol(c.define(name.Value, false))
+	}
+
+	return nil
+}
+
+// compileImplStatement adds the methods to the type once they are created,
+// since they may be closures
+func (c *Compiler) compileImplStatement(node *ast.ImplStatement) error {
+	symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+
+	if !ok {
+		return c.throwf("identifier not found: %s", node.Name.Value)
+	}
+
+	for _, method := range node.Methods {
+		c.loadSymbol(symbol)
+
+		if err := c.Compile(method); err != nil {
+			return err
+		}
+
+		c.emit(code.OpImpl, c.addConstant(&object.String{Value: method.Name}))
+	}
+
+	return nil
+}
+
+// compileMethod compiles the function and receiver of a dot call, eg.
+// `x.f(args)`. A method f implemented for the type of x, or else a field f of
+// a record x, is called in favour of any other f in scope, which only OpMethod
+// can tell at runtime.
+func (c *Compiler) compileMethod(node *ast.CallExpression) error {
+	name := node.Function.String()
+	pushed := 0
+
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		c.loadSymbol(symbol)
+		pushed = 1
+	}
+
+	if err := c.Compile(node.Arguments[0]); err != nil {
+		return err
+	}
+
+	c.emit(code.OpMethod, c.addConstant(&object.String{Value: name}), pushed)
+
+	return nil
+}
+
+// compileIndex compiles the index of an index expression. The name of a field
+// access, eg. `a.name`, is a variable holding the index unless a is a struct,
+// which only OpField can tell at runtime.
+func (c *Compiler) compileIndex(node *ast.IndexExpression) error {
+	field, ok := node.Field()
+
+	if !ok {
+		return c.Compile(node.Index)
+	}
+
+	name := c.addConstant(&object.String{Value: field.Value})
+
+	if symbol, ok := c.symbolTable.Resolve(field.Value); ok {
+		c.loadSymbol(symbol)
+		c.emit(code.OpField, name, 1)
+	} else {
+		c.emit(code.OpField, name, 0)
+	}
+
+	return nil
+}
+
+// initPatternBindings defines the identifiers bound by pattern, storing the
+// values OpMatch or OpDestructure pushed for them with the last one on top
+func (c *Compiler) initPatternBindings(pattern ast.Pattern, mutable bool) {
+	bindings := ast.PatternBindings(pattern)
+	symbols := make([]Symbol, len(bindings))
+
+	for i, ident := range bindings {
+		symbols[i] = c.define(ident.Value, mutable)
+	}
+
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.initSymbol(symbols[i])
+	}
+}
+
+// define defines a symbol, which goes out of scope at the end of the
+// innermost enclosing block if there is one
+func (c *Compiler) define(name string, mutable bool) Symbol {
+	scope := &c.scopes[c.scopeIndex]
+
+	if len(scope.blocks) == 0 {
+		return c.symbolTable.Define(name, mutable)
+	}
+
+	symbol, restore := c.symbolTable.DefineInBlock(name, mutable)
+
+	b := scope.blocks[len(scope.blocks)-1]
+	b.names[name] = true
+	b.restores = append(b.restores, restore)
+
+	return symbol
+}
+
+// declared reports whether name is already bound in the innermost block, or
+// in the function itself outside of blocks
+func (c *Compiler) declared(name string) bool {
+	scope := &c.scopes[c.scopeIndex]
+
+	if len(scope.blocks) > 0 {
+		return scope.blocks[len(scope.blocks)-1].names[name]
+	}
+
+	symbol, ok := c.symbolTable.store[name]
+
+	return ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope)
+}
+
+func (c *Compiler) enterBlock() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.blocks = append(scope.blocks, &block{names: map[string]bool{}})
+}
+
+func (c *Compiler) leaveBlock() {
+	scope := &c.scopes[c.scopeIndex]
+	b := scope.blocks[len(scope.blocks)-1]
+
+	for i := len(b.restores) - 1; i >= 0; i-- {
+		b.restores[i]()
+	}
+
+	scope.blocks = scope.blocks[:len(scope.blocks)-1]
+}
+
+// compileBlock compiles the body of a loop, whose bindings go out of scope at
+// its end
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	return c.Compile(block)
+}
+
+// compileReassignmentStatement compiles an assignment to a variable or to an
+// element of one. Assigning to an element, eg. `a[i][j] = v`, leaves a, i, a[i]
+// and j on the stack on the way down, then each OpSetIndex replaces the
+// innermost container, key and value with the changed container.
+func (c *Compiler) compileReassignmentStatement(node *ast.ReassignmentStatement) error {
+	root := node.Root()
+	symbol, ok := c.symbolTable.Resolve(root.Value)
+
+	if !ok {
+		return c.throwf("identifier not found: %s", root.Value)
+	}
+
+	if !symbol.Mutable {
+		return c.throwf("identifier '%s' is not mutable", root.Value)
+	}
+
+	var indexes []*ast.IndexExpression
+
+	for target := node.Target; target != ast.Expression(root); {
+		index := target.(*ast.IndexExpression)
+		indexes = append([]*ast.IndexExpression{index}, indexes...)
+		target = index.Left
+	}
+
+	if len(indexes) > 0 || node.Operator() != "" {
+		c.loadSymbol(symbol)
+	}
+
+	for i, index := range indexes {
+		if err := c.compileIndex(index); err != nil {
+			return err
+		}
+
+		if i < len(indexes)-1 {
+			c.emit(code.OpDup, 2)
+			c.emit(code.OpIndex)
+		}
+	}
+
+	// Compound assignments read the current value first
+	if node.Operator() != "" && len(indexes) > 0 {
+		c.emit(code.OpDup, 2)
+		c.emit(code.OpIndex)
+	}
+
+	if err := c.Compile(node.Value); err != nil {
+		return err
+	}
+
+	if op := node.Operator(); op != "" {
+		c.emit(infixOperators[op])
+	}
+
+	for range indexes {
+		c.emit(code.OpSetIndex)
+	}
+
+	c.storeSymbol(symbol)
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	// Bogus offsets, patched once the length of the consequence is known
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		if err := c.compileBlockValue(node.Alternative); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileMatchExpression keeps the subject of a match in a hidden variable
+// while trying the arms in order. OpMatch pushes the values bound by a pattern
+// when it matches, which are stored in the variables of the arm's block.
+func (c *Compiler) compileMatchExpression(node *ast.MatchExpression) error {
+	if err := c.Compile(node.Subject); err != nil {
+		return err
+	}
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	// match is a keyword, so the name cannot clash with user variables
+	subject := c.define("match", false)
+	c.initSymbol(subject)
+
+	endJumps := []int{}
+
+	for _, arm := range node.Arms {
+		c.enterBlock()
+
+		c.loadSymbol(subject)
+		patternIndex := c.addConstant(&object.Pattern{Node: arm.Pattern})
+		matchPos := c.emit(code.OpMatch, patternIndex, 9999)
+
+		c.initPatternBindings(arm.Pattern, false)
+
+		guardPos := -1
+
+		if arm.Guard != nil {
+			if err := c.Compile(arm.Guard); err != nil {
+				return err
+			}
+
+			guardPos = c.emit(code.OpJumpNotTruthy, 9999)
+		}
+
+		if err := c.compileBlockValue(arm.Body); err != nil {
+			return err
+		}
+
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		c.replaceInstruction(matchPos, code.Make(code.OpMatch, patternIndex, len(c.currentInstructions())))
+
+		if guardPos >= 0 {
+			c.changeOperand(guardPos, len(c.currentInstructions()))
+		}
+
+		c.leaveBlock()
+	}
+
+	c.loadSymbol(subject)
+	c.emit(code.OpNoMatch)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return nil
+}
+
+// compileTryExpression compiles the body of a try inside a handler installed by
+// OpTry, which the virtual machine jumps to with the caught value pushed when
+// an error is raised. Without a catch block, or when the catch block raises an
+// error in turn, the handler runs the finally block and raises the caught
+// value again. Leaving the try normally runs the finally block afterwards.
+// Errors the evaluator raises at runtime are thrown by the compiled code
+// inside the body, see throwf.
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	// Bogus offsets, patched once the code of the handlers is known
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.enterTry(true, node.Finally)
+
+	if err := c.compileBlockValue(node.Body); err != nil {
+		return err
+	}
+
+	c.leaveTry()
+	c.emit(code.OpEndTry)
+
+	endJumps := []int{c.emit(code.OpJump, 9999)}
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+
+	if node.Catch != nil {
+		// The finally block also has to run when the catch block raises an
+		// error, so it gets a handler of its own
+		if node.Finally != nil {
+			tryPos = c.emit(code.OpTry, 9999)
+			c.enterTry(true, node.Finally)
+		}
+
+		c.enterBlock()
+
+		param := c.define(node.Param.Value, false)
+		c.initSymbol(param)
+
+		if err := c.compileBlockValue(node.Catch); err != nil {
+			return err
+		}
+
+		c.leaveBlock()
+
+		if node.Finally == nil {
+			c.changeOperand(endJumps[0], len(c.currentInstructions()))
+			return nil
+		}
+
+		c.leaveTry()
+		c.emit(code.OpEndTry)
+
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+	}
+
+	// Reached with the caught value on the stack when there is no catch
+	// block, or when the catch block raised an error
+	if err := c.compileBlock(node.Finally); err != nil {
+		return err
+	}
+
+	c.emit(code.OpThrow)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	return c.compileBlock(node.Finally)
+}
+
+// compileLogicalExpression compiles && and || to jumps, skipping the right
+// side when the left one decides the result. Like the evaluator, the result
+// is always a boolean.
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	// Bogus offsets, patched once the length of the right side is known
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if node.Operator == "||" {
+		c.emit(code.OpTrue)
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if err := c.compileTruthiness(node.Right); err != nil {
+			return err
+		}
+
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+		return nil
+	}
+
+	if err := c.compileTruthiness(node.Right); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	c.emit(code.OpFalse)
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileTruthiness compiles exp, turning its value into a boolean
+func (c *Compiler) compileTruthiness(exp ast.Expression) error {
+	if err := c.Compile(exp); err != nil {
+		return err
+	}
+
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+
+	return nil
+}
+
+// compileBlockValue compiles a block so that it leaves its value on the stack
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.compileBlock(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileForExpression(node *ast.ForExpression) error {
+	loopStart := len(c.currentInstructions())
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	l := c.enterLoop(node.Label)
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+
+	c.leaveLoop()
+
+	for _, pos := range l.continues {
+		c.changeOperand(pos, loopStart)
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	// Loops evaluate to null, just like in the evaluator
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+func (c *Compiler) compileThreeClauseFor(node *ast.ForExpression) error {
+	var loopVar *Symbol
+
+	// Variables declared by init only live as long as the loop
+	if init, ok := node.Init.(*ast.LetStatement); ok && init.Pattern != nil {
+		c.enterBlock()
+		defer c.leaveBlock()
+
+		if err := c.Compile(init); err != nil {
+			return err
+		}
+	} else if ok {
+		if err := c.Compile(init.Value); err != nil {
+			return err
+		}
+
+		c.enterBlock()
+		defer c.leaveBlock()
+
+		symbol := c.define(init.Name.Value, init.Mutable)
+		c.initSymbol(symbol)
+
+		loopVar = &symbol
+	} else if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	loopStart := len(c.currentInstructions())
+	jumpNotTruthyPos := -1
+
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	l := c.enterLoop(node.Label)
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+
+	c.leaveLoop()
+
+	for _, pos := range l.continues {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	// Like in the evaluator every iteration gets its own copy of a mutable
+	// loop variable, so closures made in the body keep the value of theirs
+	if loopVar != nil && isCell(*loopVar) {
+		c.loadSymbol(*loopVar)
+		c.emit(code.OpShare)
+		c.initSymbol(*loopVar)
+	}
+
+	if node.Post != nil {
+		if err := c.Compile(node.Post); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	if jumpNotTruthyPos >= 0 {
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	}
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+// compileForInExpression keeps an iterator over the collection on the stack
+// while the loop runs, which OpIterNext takes the loop variables from
+func (c *Compiler) compileForInExpression(node *ast.ForInExpression) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+
+	c.emit(code.OpIter)
+
+	loopStart := len(c.currentInstructions())
+	numValues := 1
+
+	if node.Key != nil {
+		numValues = 2
+	}
+
+	iterNextPos := c.emit(code.OpIterNext, 9999, numValues)
+
+	c.enterBlock()
+	defer c.leaveBlock()
+
+	value := c.define(node.Value.Value, false)
+
+	if node.Key != nil {
+		key := c.define(node.Key.Value, false)
+
+		c.initSymbol(value)
+		c.initSymbol(key)
+	} else {
+		c.initSymbol(value)
+	}
+
+	l := c.enterLoop(node.Label)
+	l.iterator = true
+
+	if err := c.compileBlock(node.Body); err != nil {
+		return err
+	}
+
+	c.leaveLoop()
+
+	for _, pos := range l.continues {
+		c.changeOperand(pos, loopStart)
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	c.replaceInstruction(iterNextPos, code.Make(code.OpIterNext, len(c.currentInstructions()), numValues))
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	c.emit(code.OpPop)
+	c.emit(code.OpNull)
+
+	return nil
+}
+
+func (c *Compiler) enterLoop(label *ast.Identifier) *loop {
+	l := &loop{}
+
+	if label != nil {
+		l.label = label.Value
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, l)
+
+	return l
+}
+
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+// leaveLoopsFor finds the innermost loop of the current function, or the one
+// with the given label, for a break or continue to jump to. Iterators of the
+// loops jumped out of on the way are popped, and try expressions in them are
+// left. It returns nil when there is no such loop.
+func (c *Compiler) leaveLoopsFor(label *ast.Identifier) (*loop, error) {
+	loops := c.scopes[c.scopeIndex].loops
+
+	for i := len(loops) - 1; i >= 0; i-- {
+		if label == nil || loops[i].label == label.Value {
+			for _, inner := range loops[i+1:] {
+				if inner.iterator {
+					c.emit(code.OpPop)
+				}
+			}
+
+			return loops[i], c.leaveTries(i + 1)
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *Compiler) enterTry(handler bool, finally *ast.BlockStatement) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, &tryBlock{loops: len(scope.loops), handler: handler, finally: finally})
+}
+
+func (c *Compiler) leaveTry() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+// leaveTries emits the code for jumping out of the try expressions of the
+// current function that are enclosed by at least the given number of loops,
+// innermost first: their handlers are removed and their finally blocks run.
+// The parser makes sure finally blocks cannot be left by a jump, so they can
+// run with whatever is on the stack at the jump.
+func (c *Compiler) leaveTries(loops int) error {
+	tries := c.scopes[c.scopeIndex].tries
+
+	// A finally block is compiled as if outside of the try expressions it
+	// runs after
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= 0 && tries[i].loops >= loops; i-- {
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+
+		if tries[i].finally == nil {
+			continue
+		}
+
+		c.scopes[c.scopeIndex].tries = tries[:i]
+
+		if err := c.compileBlock(tries[i].finally); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	// The scope is left on errors too, so that blocks around the function
+	// are left in the scope they were entered in
+	if err := c.compileFunctionBody(node); err != nil {
+		c.leaveScope()
+		return err
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	// Cells are captured as they are, so the closure shares the variable
+	for _, s := range freeSymbols {
+		switch {
+		case isCell(s) && s.Scope == LocalScope:
+			c.emit(code.OpGetLocal, s.Index)
+		case isCell(s) && s.Scope == GlobalScope:
+			c.emit(code.OpGetGlobal, s.Index)
+		case isCell(s):
+			c.emit(code.OpGetFree, s.Index)
+		default:
+			c.loadSymbol(s)
+		}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		Signature:    object.NewSignature(node.Parameters, node.Defaults, node.Rest),
+		Name:         node.Name,
+		SourceMap:    sourceMap,
+	}
+
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	return nil
+}
+
+// compileFunctionBody compiles the parameters and body of a function in the
+// scope entered for it
+func (c *Compiler) compileFunctionBody(node *ast.FunctionLiteral) error {
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+
+	params := make([]Symbol, len(node.Parameters))
+
+	// Parameters left out of a call are nil until their default value is
+	// computed, which may refer to the parameters before it
+	for i, p := range node.Parameters {
+		symbol := c.symbolTable.Define(p.Value, false)
+		params[i] = symbol
+		def := node.Default(i)
+
+		if def == nil {
+			continue
+		}
+
+		jumpPos := c.emit(code.OpJumpIfPassed, 9999, symbol.Index)
+
+		if err := c.Compile(def); err != nil {
+			return err
+		}
+
+		c.emit(code.OpSetLocal, symbol.Index)
+		c.replaceInstruction(jumpPos, code.Make(code.OpJumpIfPassed, len(c.currentInstructions()), symbol.Index))
+	}
+
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value, false)
+	}
+
+	for i, symbol := range params {
+		if pattern := node.Pattern(i); pattern != nil {
+			c.loadSymbol(symbol)
+			c.emit(code.OpDestructure, c.addConstant(&object.Pattern{Node: pattern}))
+			c.initPatternBindings(pattern, false)
+		}
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+	}
+}
+
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) globalSymbolTable() *SymbolTable {
+	s := c.symbolTable
+
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s
+}
+
+// topLevelNames returns the names bound by the top-level statements of
+// program
+func topLevelNames(program *ast.Program) map[string]bool {
+	names := map[string]bool{}
+
+	for _, stmt := range program.Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if ast.IsNil(stmt) {
+				continue
+			}
+
+			for _, name := range stmt.Bindings() {
+				names[name.Value] = true
+			}
+		case *ast.StructStatement:
+			if !ast.IsNil(stmt) {
+				names[stmt.Name.Value] = true
+			}
+		case *ast.EnumStatement:
+			if ast.IsNil(stmt) {
+				continue
+			}
+
+			names[stmt.Name.Value] = true
+
+			for _, v := range stmt.Variants {
+				names[v.Name.Value] = true
+			}
+		}
+	}
+
+	return names
+}
+
+func (c *Compiler) errorf(format string, a ...any) error {
+	return &Error{Pos: c.pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// throwf reports an error the evaluator raises at runtime, such as an
+// undefined identifier. Inside a try expression it compiles to code throwing
+// the error instead, so that it can be caught like in the evaluator, and
+// compiling goes on as if there was no error since the code after the throw
+// never runs.
+func (c *Compiler) throwf(format string, a ...any) error {
+	if !c.inTry() {
+		return c.errorf(format, a...)
+	}
+
+	caught := &object.ErrorValue{Message: fmt.Sprintf(format, a...), Pos: c.pos}
+
+	c.emit(code.OpConstant, c.addConstant(caught))
+	c.emit(code.OpThrow)
+
+	return nil
+}
+
+// inTry reports whether the code being compiled is inside a try expression,
+// including one around the function it is in
+func (c *Compiler) inTry() bool {
+	for _, scope := range c.scopes[:c.scopeIndex+1] {
+		for _, t := range scope.tries {
+			if t.handler {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	c.scopes[c.scopeIndex].sourceMap[pos] = c.pos
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+		sourceMap:           map[int]token.Position{},
+	}
+
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex += 1
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex -= 1
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// isCell reports whether the variable of s is kept in a cell, which is the
+// case for mutable variables of functions and blocks so closures can share
+// them
+func isCell(s Symbol) bool {
+	return s.Mutable && (s.Scope == LocalScope || s.Scope == FreeScope || s.Scope == GlobalScope && s.Block)
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		if isCell(s) {
+			c.emit(code.OpGetGlobalCell, s.Index)
+		} else {
+			c.emit(code.OpGetGlobal, s.Index)
+		}
+	case LocalScope:
+		if isCell(s) {
+			c.emit(code.OpGetLocalCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		if isCell(s) {
+			c.emit(code.OpGetFreeCell, s.Index)
+		} else {
+			c.emit(code.OpGetFree, s.Index)
+		}
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// compileOperand compiles an expression whose value is only looked at, eg. the
+// array being indexed. Unlike other reads of a variable, this leaves whatever
+// the variable owns with it, see object.SetIndex.
+func (c *Compiler) compileOperand(node ast.Node) error {
+	if ident, ok := node.(*ast.Identifier); ok {
+		if symbol, ok := c.symbolTable.Resolve(ident.Value); ok {
+			c.loadSymbol(symbol)
+			return nil
+		}
+	}
+
+	return c.Compile(node)
+}
+
+// isBuiltin reports whether an expression refers to a builtin function
+func (c *Compiler) isBuiltin(node ast.Expression) bool {
+	ident, ok := node.(*ast.Identifier)
+
+	if !ok {
+		return false
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+
+	return ok && symbol.Scope == BuiltinScope
+}
+
+// initSymbol stores the value on top of the stack in a newly defined variable
+func (c *Compiler) initSymbol(s Symbol) {
+	if isCell(s) {
+		c.emit(code.OpNewCell)
+	}
+
+	if s.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+// storeSymbol stores the value on top of the stack in an existing variable
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch {
+	case isCell(s) && s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobalCell, s.Index)
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case s.Scope == FreeScope:
+		c.emit(code.OpSetFreeCell, s.Index)
+	case isCell(s):
+		c.emit(code.OpSetLocalCell, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
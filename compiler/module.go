@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"dodo-lang/ast"
+	"dodo-lang/code"
+	"dodo-lang/lexer"
+	"dodo-lang/object"
+	"dodo-lang/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompileFile compiles the program of the file being run. The file counts as
+// being loaded while it is compiled, so a module importing it is reported as
+// an import cycle.
+func (c *Compiler) CompileFile(program *ast.Program, filename string) error {
+	if absPath, err := filepath.Abs(filename); err == nil {
+		c.loading = append(c.loading, absPath)
+		defer func() { c.loading = c.loading[:len(c.loading)-1] }()
+	}
+
+	return c.Compile(program)
+}
+
+// compileImportStatement binds the name of the module to a constant telling
+// which globals its bindings are kept in. The code of the module is compiled
+// in place of the first import of it, so it runs once, before anything that
+// imports it.
+func (c *Compiler) compileImportStatement(node *ast.ImportStatement) error {
+	if err := c.checkDeclaration(node.Name); err != nil {
+		return err
+	}
+
+	if c.scopeIndex > 0 || len(c.scopes[c.scopeIndex].blocks) > 0 {
+		return c.errorf("imports are only supported at the top level of a file")
+	}
+
+	module, err := c.compileModule(node)
+
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpConstant, c.addConstant(module))
+	c.initSymbol(c.define(node.Name.Value, false))
+
+	return nil
+}
+
+func (c *Compiler) compileModule(node *ast.ImportStatement) (*object.Module, error) {
+	path := node.FilePath()
+	absPath, err := filepath.Abs(path)
+
+	if err != nil {
+		return nil, c.errorf("could not import %q: %s", node.Path, err)
+	}
+
+	if module, ok := c.modules[absPath]; ok {
+		return module, nil
+	}
+
+	for i, loadingPath := range c.loading {
+		if loadingPath == absPath {
+			cycle := append([]string{}, c.loading[i:]...)
+			cycle = append(cycle, absPath)
+
+			for j := range cycle {
+				cycle[j] = filepath.Base(cycle[j])
+			}
+
+			return nil, c.errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, c.errorf("could not import %q: %s", node.Path, err)
+	}
+
+	p := parser.New(lexer.NewFile(path, string(content)))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, c.errorf("could not import %q: %s", node.Path, strings.Join(p.Errors(), "; "))
+	}
+
+	c.loading = append(c.loading, absPath)
+	defer func() { c.loading = c.loading[:len(c.loading)-1] }()
+
+	// The module gets a symbol table of its own, so its names do not clash
+	// with those of the importing file, but its globals are allocated after
+	// the ones in use
+	importer := c.symbolTable
+	topLevel := c.topLevel
+
+	c.symbolTable = newGlobalSymbolTable()
+	c.symbolTable.numDefinitions = importer.numDefinitions
+
+	defer func() {
+		importer.numDefinitions = c.symbolTable.numDefinitions
+		c.symbolTable = importer
+		c.topLevel = topLevel
+	}()
+
+	if err := c.Compile(program); err != nil {
+		return nil, err
+	}
+
+	module := &object.Module{Name: node.Name.Value, Path: absPath, Globals: map[string]int{}}
+
+	for name, symbol := range c.symbolTable.store {
+		if symbol.Scope == GlobalScope {
+			module.Globals[name] = symbol.Index
+		}
+	}
+
+	c.modules[absPath] = module
+
+	return module, nil
+}
@@ -0,0 +1,158 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name    string
+	Scope   SymbolScope
+	Index   int
+	Mutable bool
+	Block   bool // Whether the symbol only lives in a block, see DefineInBlock
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	reserved       map[string]Symbol // Globals referred to before they are defined, see Reserve
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := make(map[string]Symbol)
+	free := []Symbol{}
+
+	return &SymbolTable{store: s, FreeSymbols: free, reserved: map[string]Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func (s *SymbolTable) Define(name string, mutable bool) Symbol {
+	return s.define(name, mutable, false)
+}
+
+func (s *SymbolTable) define(name string, mutable bool, block bool) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Mutable: mutable, Block: block}
+
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	if reserved, ok := s.reserved[name]; ok && !block {
+		symbol.Index = reserved.Index
+		delete(s.reserved, name)
+	} else {
+		s.numDefinitions += 1
+	}
+
+	s.store[name] = symbol
+
+	return symbol
+}
+
+// Reserve allocates the global that name will be defined in, for functions
+// referring to a global defined further down the program. Defining name
+// outside of a block binds it to the reserved global.
+func (s *SymbolTable) Reserve(name string) Symbol {
+	if symbol, ok := s.reserved[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: GlobalScope, Index: s.numDefinitions}
+	s.reserved[name] = symbol
+	s.numDefinitions += 1
+
+	return symbol
+}
+
+// DefineInBlock defines name like Define, for bindings that only live in a
+// block such as loop variables. The returned function restores whatever name
+// referred to before, to be called at the end of the block.
+//
+// Every run of a block, eg. every iteration of a loop, makes new bindings.
+// Functions capture the ones defined at the top level like they do for
+// locals, since the global they are kept in is reused.
+func (s *SymbolTable) DefineInBlock(name string, mutable bool) (Symbol, func()) {
+	previous, shadowed := s.store[name]
+	symbol := s.define(name, mutable, true)
+
+	return symbol, func() {
+		if shadowed {
+			s.store[name] = previous
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Mutable: original.Mutable}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
+
+// Resolve finds the symbol bound to name, turning locals of enclosing
+// functions into free variables of the current one along the way
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+
+	if !ok && s.Outer != nil {
+		obj, ok = s.Outer.Resolve(name)
+
+		if !ok {
+			return obj, ok
+		}
+
+		if obj.Scope == GlobalScope && !obj.Block || obj.Scope == BuiltinScope {
+			return obj, ok
+		}
+
+		free := s.defineFree(obj)
+		return free, true
+	}
+
+	return obj, ok
+}
+
+// Lookup reports whether name is bound in this or any enclosing table
+// without capturing it as a free variable
+func (s *SymbolTable) Lookup(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+
+	if !ok && s.Outer != nil {
+		return s.Outer.Lookup(name)
+	}
+
+	return obj, ok
+}
@@ -0,0 +1,169 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1, Mutable: true},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1, Mutable: true},
+	}
+
+	global := NewSymbolTable()
+
+	if a := global.Define("a", false); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+
+	if b := global.Define("b", true); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+
+	if c := local.Define("c", false); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+
+	if d := local.Define("d", true); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a", false)
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c", true)
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e", false)
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0, Mutable: true},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "c" {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+
+	if _, ok := secondLocal.Resolve("b"); ok {
+		t.Errorf("name b resolved, but was expected not to")
+	}
+}
+
+func TestResolveBlockGlobals(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a", false)
+	global.DefineInBlock("b", false)
+
+	local := NewEnclosedSymbolTable(global)
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "b", Scope: FreeScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := local.Resolve(sym.Name)
+
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a", false)
+
+	reserved := global.Reserve("c")
+
+	if reserved != (Symbol{Name: "c", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("wrong reserved symbol. got=%+v", reserved)
+	}
+
+	if _, ok := global.Resolve("c"); ok {
+		t.Errorf("reserved name c resolved before being defined")
+	}
+
+	// Bindings of blocks get globals of their own
+	if b, _ := global.DefineInBlock("c", false); b.Index != 2 {
+		t.Errorf("block binding got wrong index. expected=2, got=%d", b.Index)
+	}
+
+	if c := global.Define("c", true); c.Index != 1 {
+		t.Errorf("reserved name defined with wrong index. expected=1, got=%d", c.Index)
+	}
+
+	if d := global.Define("d", false); d.Index != 3 {
+		t.Errorf("wrong index after reserved name. expected=3, got=%d", d.Index)
+	}
+}
+
+func TestLookupDoesNotCapture(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.Define("a", false)
+
+	inner := NewEnclosedSymbolTable(local)
+
+	if _, ok := inner.Lookup("a"); !ok {
+		t.Fatalf("name a not found")
+	}
+
+	if len(inner.FreeSymbols) != 0 {
+		t.Errorf("Lookup captured free symbols. got=%+v", inner.FreeSymbols)
+	}
+}
+
+func TestDefineResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	firstLocal := NewEnclosedSymbolTable(global)
+
+	expected := []Symbol{
+		{Name: "a", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: BuiltinScope, Index: 1},
+	}
+
+	for i, v := range expected {
+		global.DefineBuiltin(i, v.Name)
+	}
+
+	for _, table := range []*SymbolTable{global, firstLocal} {
+		for _, sym := range expected {
+			result, ok := table.Resolve(sym.Name)
+
+			if !ok {
+				t.Errorf("name %s not resolvable", sym.Name)
+				continue
+			}
+
+			if result != sym {
+				t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+			}
+		}
+	}
+}
@@ -3,7 +3,11 @@ package evaluator
 import (
 	"dodo-lang/ast"
 	"dodo-lang/object"
+	"dodo-lang/token"
 	"fmt"
+	"io"
+	"math"
+	"strings"
 )
 
 var (
@@ -12,188 +16,59 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-var builtins = map[string]*object.Builtin{
-	"len": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.Array:
-				return &object.Integer{Value: int64(len(arg.Elements))}
-			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"rest": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.Array:
-				if len(arg.Elements) > 0 {
-
-					arrLen := len(arg.Elements)
-					newArr := make([]object.Object, arrLen-1, arrLen-1)
-					copy(newArr, arg.Elements[1:])
-
-					return &object.Array{Elements: newArr}
-				}
-
-				return NULL
-			case *object.String:
-				if len(arg.Value) > 0 {
-					return &object.String{Value: arg.Value[1:]}
-				}
-
-				return NULL
-			default:
-				return newError("argument to `rest` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.Array:
-				if len(arg.Elements) > 0 {
-					return arg.Elements[0]
-				}
-
-				return NULL
-			case *object.String:
-				if len(arg.Value) > 0 {
-					return &object.String{Value: string(arg.Value[0])}
-				}
-
-				return NULL
-			default:
-				return newError("argument to `first` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
+var builtins = map[string]*object.Builtin{}
 
-			switch arg := args[0].(type) {
-			case *object.Array:
-				max := len(arg.Elements) - 1
-				if len(arg.Elements) > 0 {
-					return arg.Elements[max]
-				}
-
-				return NULL
-			case *object.String:
-				max := len(arg.Value) - 1
-				if len(arg.Value) > 0 {
-					return &object.String{Value: string(arg.Value[max])}
-				}
-
-				return NULL
-			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, expected=2", len(args))
-			}
-
-			switch arg := args[0].(type) {
-			case *object.Array:
-				length := len(arg.Elements)
-				newArr := make([]object.Object, length+1, length+1)
-				copy(newArr, arg.Elements)
-				newArr[length] = args[1]
-
-				return &object.Array{Elements: newArr}
-			default:
-				return newError("argument to `last` not supported, got %s", args[0].Type())
-			}
-		},
-	},
-	"typeof": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
-
-			arg := args[0].(object.Object)
+// Warnings receives warnings about code that works but may not do what was
+// intended, eg. a let shadowing a variable of an enclosing scope. Warnings are
+// dropped while it is nil.
+var Warnings io.Writer
 
-			return &object.String{Value: string(arg.Type())}
-		},
-	},
-	"debug": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, expected=1", len(args))
-			}
-
-			arg := args[0].(object.Object)
+// Positions already warned about, so a let in a loop only warns once
+var warned = map[token.Position]bool{}
 
-			fmt.Printf("%s\n", arg.Inspect())
+// MaxCallDepth limits how deeply function calls may nest, so that runaway
+// recursion fails with an error rather than overflowing the Go stack. Even
+// functions nesting loops, try and match expressions stay well under the
+// 1 GB the Go stack may grow to at this depth.
+var MaxCallDepth = 20000
 
-			return NULL
-		},
-	},
-	"println": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
+// Number of function calls currently being evaluated
+var callDepth int
 
-			return NULL
-		},
-	},
-	"printf": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) < 2 {
-				return newError("wrong number of arguments. got=%d, expected at least 2", len(args))
-			}
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
+	}
+}
 
-			formatStr, ok := args[0].(*object.String)
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	// Expressions that failed to parse are left out of the tree as nils
+	if node == nil {
+		return newError("cannot evaluate incomplete program")
+	}
 
-			if !ok {
-				return newError("first argument has to be a string. got=%s", args[0].Type())
-			}
+	defer func() {
+		// A bug in the evaluator should not take down a whole session, eg. in
+		// the REPL, so a panic becomes a runtime error like any other
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
 
-			var templateArgs []any
-
-			for _, arg := range args[1:] {
-				switch a := arg.(type) {
-				case *object.String:
-					templateArgs = append(templateArgs, a.Value)
-				case *object.Integer:
-					templateArgs = append(templateArgs, a.Value)
-				default:
-					return newError("only strings and integers can be used with 'printf'. got=%s", a.Type())
-				}
-			}
+		// Errors are positioned at the innermost node they surface from, so an
+		// error that already carries a position is left untouched on the way up.
+		// The position of a program is that of its first statement, which says
+		// nothing about where an error came from
+		_, program := node.(*ast.Program)
 
-			fmt.Printf(formatStr.Value, templateArgs...)
-			fmt.Print("\n")
+		if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && !program && !ast.IsNil(node) {
+			err.Pos = node.Pos()
+		}
+	}()
 
-			return NULL
-		},
-	},
+	return eval(node, env)
 }
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -210,42 +85,98 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 
-		if _, ok := env.Get(node.Name.Value); ok {
-			return newError("identifier '%s' already exists", node.Name.Value)
+		// Names may be reused in inner scopes, shadowing the outer binding
+		// until the end of the scope, but not twice in the same scope
+		for _, name := range node.Bindings() {
+			if env.Declared(name.Value) {
+				return newError("identifier '%s' already exists", name.Value)
+			}
+
+			if _, ok := env.Get(name.Value); ok {
+				warnShadowing(name)
+			}
+		}
+
+		if node.Pattern != nil {
+			return destructure(node.Pattern, val, env, node.Mutable)
 		}
 
 		env.Set(node.Name.Value, node.Mutable, val)
 	case *ast.ReassignmentStatement:
+		if err := evalReassignmentStatement(node, env); err != nil {
+			return err
+		}
+
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+
+		val := Eval(node.ReturnValue, env)
+
+		if isError(val) {
+			return val
+		}
+
+		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
 		val := Eval(node.Value, env)
 
 		if isError(val) {
 			return val
 		}
 
-		if !env.IsMutable(node.Ident.Value) {
-			return newError("identifier '%s' is not mutable", node.Ident.Value)
+		return object.Throw(val)
+	case *ast.BreakStatement:
+		return &object.Break{Label: loopLabel(node.Label)}
+	case *ast.ContinueStatement:
+		return &object.Continue{Label: loopLabel(node.Label)}
+	case *ast.ImportStatement:
+		return evalImportStatement(node, env)
+	case *ast.StructStatement:
+		if env.Declared(node.Name.Value) {
+			return newError("identifier '%s' already exists", node.Name.Value)
 		}
 
-		env.Set(node.Ident.Value, true, val)
+		if _, ok := env.Get(node.Name.Value); ok {
+			warnShadowing(node.Name)
+		}
 
-	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		fields := []string{}
 
-		if isError(val) {
-			return val
+		for _, f := range node.Fields {
+			fields = append(fields, f.Value)
 		}
 
-		return &object.ReturnValue{Value: val}
+		env.Set(node.Name.Value, false, object.NewStructType(node.Name.Value, fields))
+	case *ast.EnumStatement:
+		return evalEnumStatement(node, env)
+	case *ast.ImplStatement:
+		target := Eval(node.Name, env)
+
+		if isError(target) {
+			return target
+		}
+
+		for _, method := range node.Methods {
+			if err := object.Implement(target, method.Name, Eval(method, env)); err != nil {
+				return err
+			}
+		}
 
 	// Expressions
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBooleanToBooleanObject(node.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 
@@ -265,6 +196,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 
 		if isError(left) {
@@ -280,43 +215,190 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.ForExpression:
+		if node.IsThreeClause() {
+			return evalThreeClauseFor(node, env)
+		}
+
 		return evalForExpression(node, env)
+	case *ast.ForInExpression:
+		return evalForInExpression(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := evalOperand(node.Left, env)
 
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		// Dot access on a module looks the name up among its bindings
+		if module, ok := left.(*object.Module); ok {
+			if field, ok := node.Field(); ok {
+				return evalModuleMember(module, field.Value)
+			}
+		}
+
+		index := evalIndex(node, left, env)
 
 		if isError(index) {
 			return index
 		}
 
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Patterns: node.Patterns, Rest: node.Rest, Body: body, Env: env}
+	case *ast.NamedArgument:
+		return Eval(node.Value, env)
 	case *ast.CallExpression:
+		if node.Token.Type == token.PERIOD {
+			return evalDotCallExpression(node, env)
+		}
+
 		function := Eval(node.Function, env)
 
 		if isError(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		var args []object.Object
+
+		// Builtins that hold on to an argument share it themselves
+		if _, ok := function.(*object.Builtin); ok {
+			args = evalOperands(node.Arguments, env)
+		} else {
+			args = evalExpressions(node.Arguments, env)
+		}
 
 		// Return instantly if an error is encountered when evaluating the arguments
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		return applyFunction(function, args, argumentNames(node.Arguments))
+	}
+
+	return nil
+}
+
+// evalEnumStatement binds the enum along with each of its variants, which are
+// either constructors or values of the enum
+func evalEnumStatement(node *ast.EnumStatement, env *object.Environment) object.Object {
+	enum := object.NewEnumType(node.Name.Value)
+	names := []*ast.Identifier{node.Name}
+	values := []object.Object{enum}
+
+	for _, v := range node.Variants {
+		names = append(names, v.Name)
+		values = append(values, enum.AddVariant(v.Name.Value, v.FieldNames()))
+	}
+
+	for i, name := range names {
+		if env.Declared(name.Value) {
+			return newError("identifier '%s' already exists", name.Value)
+		}
+
+		if _, ok := env.Get(name.Value); ok {
+			warnShadowing(name)
+		}
+
+		env.Set(name.Value, false, values[i])
+	}
+
+	return nil
+}
+
+// evalReassignmentStatement assigns to a mutable variable or to an element of
+// one. Arrays and hashmaps are never changed in place, assigning to an element
+// makes a changed copy which the variable is then set to, so other variables
+// holding the same array or hashmap are unaffected.
+func evalReassignmentStatement(node *ast.ReassignmentStatement, env *object.Environment) object.Object {
+	root := node.Root()
+
+	// Loop bodies have environments of their own, so the binding may live in
+	// an enclosing one
+	scope := env.Resolve(root.Value)
+
+	if scope == nil {
+		return newError("identifier not found: %s", root.Value)
+	}
+
+	if !scope.IsMutable(root.Value) {
+		return newError("identifier '%s' is not mutable", root.Value)
+	}
+
+	current, _ := scope.Get(root.Value)
+
+	// Walk down from the variable to the element being assigned, keeping the
+	// containers on the way so they can be updated on the way back up
+	var indexes []*ast.IndexExpression
+
+	for target := node.Target; target != root; {
+		index := target.(*ast.IndexExpression)
+		indexes = append([]*ast.IndexExpression{index}, indexes...)
+		target = index.Left
+	}
+
+	containers := []object.Object{current}
+	keys := make([]object.Object, len(indexes))
+
+	for i, exp := range indexes {
+		if _, ok := current.(*object.Module); ok {
+			return newError("cannot assign to a member of %s", current.Inspect())
+		}
+
+		keys[i] = evalIndex(exp, current, env)
+
+		if isError(keys[i]) {
+			return keys[i]
+		}
+
+		// A plain assignment has no use for the element it replaces
+		if i == len(indexes)-1 && node.Operator() == "" {
+			break
+		}
+
+		current = evalIndexExpression(current, keys[i])
+
+		if isError(current) {
+			return current
+		}
+
+		containers = append(containers, current)
+	}
+
+	val := Eval(node.Value, env)
+
+	if isError(val) {
+		return val
+	}
+
+	if op := node.Operator(); op != "" {
+		val = evalInfixExpression(op, current, val)
+
+		if isError(val) {
+			return val
+		}
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		updated, err := object.SetIndex(containers[i], keys[i], val)
+
+		if err != nil {
+			return err
+		}
+
+		val = updated
 	}
 
+	scope.Set(root.Value, true, val)
+
 	return nil
 }
 
@@ -324,6 +406,11 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
+		// Statements that failed to parse are left in the tree as typed nils
+		if ast.IsNil(statement) {
+			return newError("cannot evaluate incomplete program")
+		}
+
 		result = Eval(statement, env)
 
 		switch result := result.(type) {
@@ -341,12 +428,16 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	var result object.Object
 
 	for _, statement := range block.Statements {
+		if ast.IsNil(statement) {
+			return newError("cannot evaluate incomplete program")
+		}
+
 		result = Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
 
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -368,10 +459,16 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
+	case operator == ".." || operator == "..=":
+		return evalRangeExpression(operator, left, right)
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case left.Type() == object.ENUM_OBJ && (operator == "==" || operator == "!="):
+		return nativeBooleanToBooleanObject(left.(*object.Enum).Equal(right) == (operator == "=="))
 	case operator == "==":
 		return nativeBooleanToBooleanObject(left == right)
 	case operator == "!=":
@@ -383,6 +480,43 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+func evalRangeExpression(operator string, left, right object.Object) object.Object {
+	start, ok := left.(*object.Integer)
+	end, ok2 := right.(*object.Integer)
+
+	if !ok || !ok2 {
+		return newError("range bounds must be INTEGER, got %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return &object.Range{Start: start.Value, End: end.Value, Inclusive: operator == "..="}
+}
+
+// evalLogicalExpression evaluates && and ||, only evaluating the right side
+// when the left one does not decide the result already
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+
+	if isError(left) {
+		return left
+	}
+
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := Eval(node.Right, env)
+
+	if isError(right) {
+		return right
+	}
+
+	return nativeBooleanToBooleanObject(isTruthy(right))
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -397,12 +531,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
@@ -416,12 +552,30 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 		return &object.Integer{Value: leftVal - rightVal}
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
+	case "/", "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+
+		if operator == "%" {
+			return &object.Integer{Value: leftVal % rightVal}
+		}
+
 		return &object.Integer{Value: leftVal / rightVal}
+	case "**":
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+
+		return &object.Integer{Value: intPow(leftVal, rightVal)}
 	case "<":
 		return nativeBooleanToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBooleanToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBooleanToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBooleanToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBooleanToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -431,6 +585,59 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+// evalFloatInfixExpression handles float-float as well as mixed int-float
+// operands, promoting the integer side to a float
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBooleanToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBooleanToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBooleanToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBooleanToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBooleanToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBooleanToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// intPow raises base to a non-negative exponent by repeated squaring.
+// Negative exponents give fractions, which are computed as floats instead.
+func intPow(base, exp int64) int64 {
+	result := int64(1)
+
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+
+		base *= base
+		exp >>= 1
+	}
+
+	return result
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -438,6 +645,10 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	switch operator {
 	case "+":
 		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBooleanToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBooleanToBooleanObject(leftVal != rightVal)
 	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
@@ -450,27 +661,84 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
+	// Each branch is a block with bindings of its own
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return Eval(ie.Consequence, object.NewEnclosedEnvironment(env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return Eval(ie.Alternative, object.NewEnclosedEnvironment(env))
 	} else {
 		return NULL
 	}
 }
 
-func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Object {
-	// TODO: Add variable reassignment and enclose loops in their own environments
+// evalMatchExpression evaluates the body of the first arm whose pattern
+// matches the subject and whose guard, if any, is truthy. The bindings of the
+// pattern are only visible in the guard and body of their arm.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
 
-	condition := Eval(ie.Condition, env)
-	var result object.Object = NULL
+	if isError(subject) {
+		return subject
+	}
 
-	if isError(condition) {
-		return condition
+	for _, arm := range me.Arms {
+		armEnv := object.NewEnclosedEnvironment(env)
+
+		err := object.Match(arm.Pattern, subject, func(name *ast.Identifier, value object.Object) {
+			armEnv.Set(name.Value, false, value)
+		})
+
+		if err != nil {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+
+			if isError(guard) {
+				return guard
+			}
+
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return Eval(arm.Body, object.NewEnclosedEnvironment(armEnv))
+	}
+
+	return newError("no pattern matched %s", subject.Inspect())
+}
+
+// evalTryExpression evaluates the body of a try, and then the catch block with
+// the error bound to its parameter if the body raised one. The finally block
+// runs however the rest of the try was left, but an error it raises replaces
+// the outcome of the rest.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Body, object.NewEnclosedEnvironment(env))
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		catchEnv := object.NewEnclosedEnvironment(env)
+		catchEnv.Set(te.Param.Value, false, err.Caught())
+
+		result = Eval(te.Catch, object.NewEnclosedEnvironment(catchEnv))
 	}
 
+	if te.Finally != nil {
+		if finally := Eval(te.Finally, object.NewEnclosedEnvironment(env)); isError(finally) {
+			return finally
+		}
+	}
+
+	return result
+}
+
+// evalForExpression runs a conditional loop, `for (condition) {...}`. Every
+// iteration runs the body in a new environment, so bindings made in it do not
+// outlive the iteration.
+func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Object {
 	for {
-		condition = Eval(ie.Condition, env)
+		condition := Eval(ie.Condition, env)
 
 		if isError(condition) {
 			return condition
@@ -480,22 +748,170 @@ func evalForExpression(ie *ast.ForExpression, env *object.Environment) object.Ob
 			break
 		}
 
-		result = Eval(ie.Body, env)
+		result := Eval(ie.Body, object.NewEnclosedEnvironment(env))
+
+		if done, result := loopControl(ie.Label, result); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// evalThreeClauseFor runs `for (init; condition; post) {...}`. Every
+// iteration gets a copy of the variables declared by init, so closures
+// created in the body hold on to the values of their own iteration.
+func evalThreeClauseFor(fe *ast.ForExpression, env *object.Environment) object.Object {
+	loopEnv := object.NewEnclosedEnvironment(env)
+
+	if fe.Init != nil {
+		if init := Eval(fe.Init, loopEnv); isError(init) {
+			return init
+		}
+	}
+
+	for {
+		if fe.Condition != nil {
+			condition := Eval(fe.Condition, loopEnv)
+
+			if isError(condition) {
+				return condition
+			}
+
+			if !isTruthy(condition) {
+				break
+			}
+		}
+
+		result := Eval(fe.Body, object.NewEnclosedEnvironment(loopEnv))
 
-		if isError(result) {
+		if done, result := loopControl(fe.Label, result); done {
 			return result
 		}
 
-		if rv, isReturnValue := result.(*object.ReturnValue); isReturnValue {
-			return rv.Value
+		loopEnv = loopEnv.Clone()
+
+		if fe.Post != nil {
+			if post := Eval(fe.Post, loopEnv); isError(post) {
+				return post
+			}
 		}
 	}
 
 	return NULL
 }
 
+func evalForInExpression(fi *ast.ForInExpression, env *object.Environment) object.Object {
+	iterable := Eval(fi.Iterable, env)
+
+	if isError(iterable) {
+		return iterable
+	}
+
+	var keys, values []object.Object
+
+	// Ranges are not collected up front, their values are made as needed
+	rng, isRange := iterable.(*object.Range)
+
+	switch iterable := iterable.(type) {
+	case *object.Range:
+	case *object.Array:
+		values = iterable.Elements
+
+		for i := range values {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+		}
+	case *object.String:
+		for i, ch := range []rune(iterable.Value) {
+			keys = append(keys, &object.Integer{Value: int64(i)})
+			values = append(values, &object.String{Value: string(ch)})
+		}
+	case *object.HashMap:
+		for _, pair := range iterable.SortedPairs() {
+			keys = append(keys, pair.Key)
+			values = append(values, pair.Value)
+		}
+
+		// A single variable is bound to the keys of a hashmap
+		if fi.Key == nil {
+			values = keys
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	length := int64(len(values))
+
+	if isRange {
+		length, _ = rng.Len()
+	}
+
+	for i := int64(0); i < length; i++ {
+		iterEnv := object.NewEnclosedEnvironment(env)
+
+		var key, value object.Object
+
+		if isRange {
+			key, value = &object.Integer{Value: i}, rng.At(i)
+		} else {
+			key, value = keys[i], values[i]
+		}
+
+		if fi.Key != nil {
+			iterEnv.Set(fi.Key.Value, false, key)
+		}
+
+		iterEnv.Set(fi.Value.Value, false, value)
+
+		result := Eval(fi.Body, object.NewEnclosedEnvironment(iterEnv))
+
+		if done, result := loopControl(fi.Label, result); done {
+			return result
+		}
+	}
+
+	return NULL
+}
+
+// loopControl handles the result of a loop body, reporting whether the loop
+// is done and what it evaluates to in that case. Errors, returns and breaks or
+// continues of outer loops are passed on.
+func loopControl(label *ast.Identifier, result object.Object) (bool, object.Object) {
+	switch result := result.(type) {
+	case *object.Error, *object.ReturnValue:
+		return true, result
+	case *object.Break:
+		if !isLoopLabel(label, result.Label) {
+			return true, result
+		}
+
+		return true, NULL
+	case *object.Continue:
+		if !isLoopLabel(label, result.Label) {
+			return true, result
+		}
+	}
+
+	return false, nil
+}
+
+func loopLabel(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+
+	return label.Value
+}
+
+// isLoopLabel reports whether a break or continue with the given label refers
+// to the loop labeled loopLabel, which an unlabeled one always does
+func isLoopLabel(loopLabel *ast.Identifier, label string) bool {
+	return label == "" || loopLabel != nil && loopLabel.Value == label
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	if val, ok := env.Get(node.Value); ok {
+		object.Share(val)
 		return val
 	}
 
@@ -506,6 +922,90 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+// evalDotCallExpression evaluates `x.f(args)`, which is parsed as a call to f
+// with the receiver x as its first argument. A method f implemented for the
+// type of x is called in favour of any other f in scope. Functions of a module
+// are called without the module itself as an argument.
+func evalDotCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
+	receiver := Eval(node.Arguments[0], env)
+
+	if isError(receiver) {
+		return receiver
+	}
+
+	var function object.Object
+
+	// Functions of modules and fields of records are called without the
+	// receiver, methods and other functions in scope with it
+	member := true
+
+	if module, ok := receiver.(*object.Module); ok {
+		function = evalModuleMember(module, node.Function.String())
+	} else if method, ok := object.LookupMethod(receiver, node.Function.String()); ok {
+		function = method
+		member = false
+	} else if field, ok := recordField(receiver, node.Function.String()); ok {
+		function = field
+	} else {
+		function = Eval(node.Function, env)
+		member = false
+	}
+
+	if isError(function) {
+		return function
+	}
+
+	args := evalExpressions(node.Arguments[1:], env)
+
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if !member {
+		args = append([]object.Object{receiver}, args...)
+	}
+
+	return applyFunction(function, args, argumentNames(node.Arguments))
+}
+
+// recordField returns the field called name of receiver, if receiver is a
+// record with such a field
+func recordField(receiver object.Object, name string) (object.Object, bool) {
+	record, ok := receiver.(object.Record)
+
+	if !ok {
+		return nil, false
+	}
+
+	value, err := record.Get(&object.String{Value: name})
+
+	if err != nil {
+		return nil, false
+	}
+
+	if value == nil {
+		return NULL, true
+	}
+
+	return value, true
+}
+
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		evaluated := Eval(part, env)
+
+		if isError(evaluated) {
+			return evaluated
+		}
+
+		out.WriteString(evaluated.Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
@@ -522,16 +1022,98 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalOperand evaluates an expression whose value is only looked at, eg. the
+// array being indexed. Unlike other reads of a variable, this leaves whatever
+// the variable owns with it, see object.SetIndex.
+func evalOperand(node ast.Expression, env *object.Environment) object.Object {
+	if ident, ok := node.(*ast.Identifier); ok {
+		if val, ok := env.Get(ident.Value); ok {
+			return val
+		}
+	}
+
+	return Eval(node, env)
+}
+
+func evalOperands(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := evalOperand(e, env)
+
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+// argumentNames returns the names of the named arguments of a call, which
+// come after the positional ones
+func argumentNames(args []ast.Expression) []string {
+	var names []string
+
+	for _, arg := range args {
+		if named, ok := arg.(*ast.NamedArgument); ok {
+			names = append(names, named.Name.Value)
+		}
+	}
+
+	return names
+}
+
+func applyFunction(fn object.Object, args []object.Object, names []string) object.Object {
 
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		if callDepth >= MaxCallDepth {
+			return newError("stack overflow: exceeded %d nested calls", MaxCallDepth)
+		}
+
+		callDepth += 1
+		defer func() { callDepth -= 1 }()
+
+		extendedEnv, err := extendFunctionEnv(fn, args, names)
+
+		if err != nil {
+			return err
+		}
+
 		evaluated := Eval(fn.Body, extendedEnv)
 
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return fn.Fn(args...)
+		if len(names) > 0 {
+			return newError("builtin functions do not take named arguments")
+		}
+
+		switch result := fn.Fn(args...).(type) {
+		case nil:
+			return NULL
+		case *object.Boolean:
+			return nativeBooleanToBooleanObject(result.Value)
+		default:
+			return result
+		}
+	case *object.StructType:
+		value, err := fn.New(args, names)
+
+		if err != nil {
+			return err
+		}
+
+		return value
+	case *object.Variant:
+		value, err := fn.New(args, names)
+
+		if err != nil {
+			return err
+		}
+
+		return value
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -545,17 +1127,93 @@ func unwrapReturnValue(obj object.Object) object.Object {
 	return obj
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv binds the arguments of a call to the parameters of fn.
+// Default values are evaluated in order, so they can refer to the parameters
+// before them.
+func extendFunctionEnv(fn *object.Function, args []object.Object, names []string) (*object.Environment, object.Object) {
+	bound, err := fn.Signature().Bind(args, names)
+
+	if err != nil {
+		return nil, err
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
-	for pI, param := range fn.Parameters {
-		env.Set(param.Value, fn.Env.IsMutable(param.Value), args[pI])
+	for i, param := range fn.Parameters {
+		value := bound[i]
+
+		if value == nil {
+			value = Eval(fn.Default(i), env)
+
+			if isError(value) {
+				return nil, value
+			}
+		}
+
+		env.Set(param.Value, fn.Env.IsMutable(param.Value), value)
+	}
+
+	if fn.Rest != nil {
+		env.Set(fn.Rest.Value, fn.Env.IsMutable(fn.Rest.Value), bound[len(fn.Parameters)])
 	}
 
-	return env
+	for i, param := range fn.Parameters {
+		if i >= len(fn.Patterns) || fn.Patterns[i] == nil {
+			continue
+		}
+
+		value, _ := env.Get(param.Value)
+
+		if err := destructure(fn.Patterns[i], value, env, false); err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+// destructure binds the identifiers of a let or parameter pattern in env,
+// failing with an error when the value does not have the shape of the pattern
+func destructure(pattern ast.Pattern, value object.Object, env *object.Environment, mutable bool) object.Object {
+	err := object.Match(pattern, value, func(name *ast.Identifier, value object.Object) {
+		env.Set(name.Value, mutable, value)
+	})
+
+	if err != nil {
+		return newError("cannot destructure %s: %s", value.Inspect(), err.Message)
+	}
+
+	return nil
+}
+
+// evalIndex evaluates the index of an index expression on left, where the name
+// of a field access on a record, eg. `p.name`, stands for itself rather than
+// a variable
+func evalIndex(node *ast.IndexExpression, left object.Object, env *object.Environment) object.Object {
+	if field, ok := node.Field(); ok {
+		if _, ok := left.(object.Record); ok {
+			return &object.String{Value: field.Value}
+		}
+	}
+
+	return Eval(node.Index, env)
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
+	if record, ok := left.(object.Record); ok {
+		value, err := record.Get(index)
+
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			return NULL
+		}
+
+		return value
+	}
+
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
@@ -576,15 +1234,13 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 		return newError("type of %s cannot be used to index %s", index.Type(), arr.Type())
 	}
 
-	max := int64(len(arr.Elements) - 1)
+	i, ok := object.Index(idx.Value, int64(len(arr.Elements)))
 
-	if idx.Value == -1 {
-		return arr.Elements[max]
-	} else if idx.Value < 0 || idx.Value > max {
+	if !ok {
 		return NULL
 	}
 
-	return arr.Elements[idx.Value]
+	return arr.Elements[i]
 }
 
 func evalHashMapIndexExpression(hashMap, index object.Object) object.Object {
@@ -612,15 +1268,45 @@ func evalStringIndexExpression(str, index object.Object) object.Object {
 		return newError("type of %s cannot be used to index %s", index.Type(), strObject.Type())
 	}
 
-	max := int64(len(strObject.Value) - 1)
+	// Strings are indexed by character rather than by byte
+	chars := []rune(strObject.Value)
+	i, ok := object.Index(idx.Value, int64(len(chars)))
 
-	if idx.Value == -1 {
-		return &object.String{Value: string(strObject.Value[max])}
-	} else if idx.Value < 0 || idx.Value > max {
+	if !ok {
 		return NULL
 	}
 
-	return &object.String{Value: string(strObject.Value[idx.Value])}
+	return &object.String{Value: string(chars[i])}
+}
+
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := evalOperand(node.Left, env)
+
+	if isError(left) {
+		return left
+	}
+
+	var bounds [3]object.Object
+
+	for i, exp := range []ast.Expression{node.Start, node.End, node.Step} {
+		if exp == nil {
+			continue
+		}
+
+		bounds[i] = Eval(exp, env)
+
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	result, err := object.Slice(left, bounds[0], bounds[1], bounds[2])
+
+	if err != nil {
+		return err
+	}
+
+	return result
 }
 
 func evalDotExpression(left, fn object.Object, args []object.Object) object.Object {
@@ -682,10 +1368,35 @@ func nativeBooleanToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
+func warnShadowing(name *ast.Identifier) {
+	if Warnings == nil || warned[name.Token.Pos] {
+		return
+	}
+
+	warned[name.Token.Pos] = true
+
+	fmt.Fprintf(Warnings, "%s: warning: '%s' shadows a variable of an enclosing scope\n", name.Token.Pos, name.Value)
+}
+
 func newError(format string, a ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	}
+
+	return 0
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -2,10 +2,13 @@ package evaluator
 
 import (
 	"bytes"
+	"dodo-lang/ast"
 	"dodo-lang/lexer"
 	"dodo-lang/object"
 	"dodo-lang/parser"
+	"dodo-lang/token"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +32,12 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"5 ** 0", 1},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +46,35 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"0.5 * 4.0", 2.0},
+		{"7.0 / 2.0", 3.5},
+		{"10 - 0.5", 9.5},
+		{"7 / 2.0", 3.5},
+		{"2.5 * 2", 5.0},
+		{"(1 + 2) / 2.0", 1.5},
+		{"float(3)", 3.0},
+		{`float("2.25")`, 2.25},
+		{"float(1.5)", 1.5},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 3", 8.0},
+		{"4 ** 0.5", 2.0},
+		{"2 ** -1", 0.5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -66,12 +104,64 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1.5 < 2.5", true},
+		{"1.5 > 2", false},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"2.0 == 2.0", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"1 <= 0.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"!(1 > 2) && 5", true},
+		{"0 && false", false},
+		{"[] || false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestShortCircuitEvaluation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"false && (1 + true)", false},
+		{"true || (1 + true)", true},
+		{"let f = fn() { 1 + true }; false && f()", false},
 	}
 
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
+
+	evaluated := testEval("true && undefined")
+
+	errObj, ok := evaluated.(*object.Error)
+
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "identifier not found: undefined" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
 }
 
 func TestEvalStringExpression(t *testing.T) {
@@ -83,6 +173,27 @@ func TestEvalStringExpression(t *testing.T) {
 		{`"hello world!"`, "hello world!"},
 		{`"5"`, "5"},
 		{`"-5"`, "-5"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{"`raw \\n`", "raw \\n"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testStringObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let xs = [1, 2, 3]; "sum is ${xs[0] + xs[1] + xs[2]}"`, "sum is 6"},
+		{`let name = "dodo"; "hello ${name}!"`, "hello dodo!"},
+		{`"${1.5} ${true} ${[1, "a"]}"`, "1.5 true [1, a]"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`"\${not} ${"interpolated"}"`, "${not} interpolated"},
+		{`let f = fn(x) { x * 2 }; "${f(2)}${f(3)}"`, "46"},
 	}
 
 	for _, tt := range tests {
@@ -107,6 +218,32 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"foo" + "bar" == "foobar"`, true},
+		{`let s = "a"; s + "b" == "ab"`, true},
+		{`"${1 + 1}" == "2"`, true},
+		{`"" == ""`, true},
+		{`"1" == 1`, false},
+		{`enum Shape { Circle(r), Empty }; variant_of(Circle(1)) == "Circle"`, true},
+		{`enum Shape { Circle(r), Empty }; variant_of(Empty) != "Circle"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+
+	testError(t, testEval(`"a" < "b"`), "unknown operator: STRING < STRING")
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -157,6 +294,9 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { return 10 }", nil},
 		{"if (1 > 2) { return 10 } else { return 20 }", 20},
 		{"if (1 < 2) { return 10 } else { return 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
 	}
 
 	for _, tt := range tests {
@@ -170,6 +310,62 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestMatchExpressions(t *testing.T) {
+	describe := `let describe = fn(x) {
+	  match x {
+	    0 => "zero",
+	    -1 => "minus one",
+	    2.5 => "two and a half",
+	    true => "yes",
+	    "dodo" => "bird",
+	    [] => "empty",
+	    [a, b] => "pair ${a} ${b}",
+	    [first, ...rest] => "list of ${len(rest) + 1} from ${first}",
+	    {"name": n, "age": [years, _]} => "${n} is ${years}",
+	    {"name": n} => "named ${n}",
+	    n if n > 100 => { let big = "big"; big }
+	    _ => "other",
+	  }
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"describe(0)", "zero"},
+		{"describe(-1)", "minus one"},
+		{"describe(0.0)", "zero"},
+		{"describe(2.5)", "two and a half"},
+		{"describe(true)", "yes"},
+		{`describe("dodo")`, "bird"},
+		{"describe([])", "empty"},
+		{"describe([1, 2])", "pair 1 2"},
+		{"describe([1, 2, 3])", "list of 3 from 1"},
+		{`describe({"name": "Ada", "age": [36, 0]})`, "Ada is 36"},
+		{`describe({"name": "Ada", "age": 36})`, "named Ada"},
+		{"describe(1000)", "big"},
+		{"describe(5)", "other"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(describe+tt.input), tt.expected)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"match 5 { 1 => 2, n if n > 5 => 3 }", "no pattern matched 5"},
+		{"match [1] { [a] if b => a }", "identifier not found: b"},
+		{"match 1 { a => a }; a", "identifier not found: a"},
+	}
+
+	for _, tt := range errors {
+		testError(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestForExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -183,6 +379,8 @@ func TestForExpressions(t *testing.T) {
 
 		  count;
 			`, 10},
+		// A bare return leaves the whole program rather than the loop, so the
+		// final count is never reached and the result is null
 		{`let mut count = 0;
 
 		  for (count < 10) {
@@ -193,8 +391,83 @@ func TestForExpressions(t *testing.T) {
 			}
 		  }
 
+		  count;
+			`, nil},
+		{`let mut count = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+
+			if (count == 5) {
+			  break;
+			}
+		  }
+
 		  count;
 			`, 5},
+		{`let mut count = 0;
+		  let mut sum = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+
+		    if (count % 2 == 0) {
+		      continue;
+		    }
+
+		    sum = sum + count;
+		  }
+
+		  sum;
+			`, 25},
+		{`let mut i = 0;
+		  let mut j = 0;
+		  let mut total = 0;
+
+		  outer: for (i < 5) {
+		    i = i + 1;
+		    j = 0;
+
+		    for (j < 5) {
+		      j = j + 1;
+
+		      if (j == 3) {
+		        continue outer;
+		      }
+
+		      if (i == 4) {
+		        break outer;
+		      }
+
+		      total = total + 1;
+		    }
+		  }
+
+		  total;
+			`, 6},
+		{`let f = fn() {
+		    let mut count = 0;
+
+		    for (count < 10) {
+		      count = count + 1;
+
+		      if (count == 5) {
+		        return count;
+		      }
+		    }
+
+		    return 0;
+		  };
+
+		  f();
+			`, 5},
+		{`let mut count = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+		    break;
+		  }
+			`, nil},
 	}
 
 	for _, tt := range tests {
@@ -209,6 +482,85 @@ func TestForExpressions(t *testing.T) {
 	}
 }
 
+func TestForInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let mut sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum", 6},
+		{"let mut sum = 0; for (i, x in [10, 20, 30]) { sum = sum + i * x; } sum", 80},
+		{`let mut out = ""; for (ch in "héllo") { out = ch + out; } out`, "olléh"},
+		{`let mut out = ""; for (i, ch in "ab") { out = out + "${i}${ch}"; } out`, "0a1b"},
+		{`let mut out = ""; for (k in {"b": 2, "a": 1, "c": 3}) { out = out + k; } out`, "abc"},
+		{`let mut out = ""; for (k, v in {"b": 2, "a": 1}) { out = out + "${k}=${v} "; } out`, "a=1 b=2 "},
+		{"let mut sum = 0; for (x in []) { sum = sum + 1; } sum", 0},
+		{"for (x in [1, 2]) { x }", nil},
+		{"for (x in [1, 2]) { let y = x * 2; y }", nil},
+		{"let mut sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } sum = sum + x; } sum", 4},
+		{"let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } 0 }; f([1, 5, 7])", 5},
+		{"let x = 100; for (x in [1, 2]) {} x", 100},
+		{"for (x in 5) {}", "cannot iterate over INTEGER"},
+		{"for (x in [1]) { x = 2; }", "identifier 'x' is not mutable"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+			} else {
+				testStringObject(t, evaluated, expected)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestThreeClauseForExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let mut sum = 0; for (let mut i = 0; i < 5; i = i + 1) { sum = sum + i; } sum", 10},
+		{"let mut i = 0; for (i = 10; i > 0; i = i - 3) {} i", -2},
+		{"let mut n = 0; for (;;) { n = n + 1; if (n == 3) { break; } } n", 3},
+		{"let mut sum = 0; for (let mut i = 0; i < 5; i = i + 1) { if (i % 2 == 0) { continue; } sum = sum + i; } sum", 4},
+		{"let mut fns = []; for (let mut i = 0; i < 3; i = i + 1) { fns = push(fns, fn() { i }); } fns[0]() + fns[1]() + fns[2]()", 3},
+		{"for (let mut i = 0; i < 3; i = i + 1) { let doubled = i * 2; }", nil},
+		{"for (let mut i = 0; i < 3; i = i + 1) {} i", "identifier not found: i"},
+		{"for (let i = 0; i < 3; i = i + 1) {}", "identifier 'i' is not mutable"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+
+			if !ok {
+				t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -255,7 +607,15 @@ func TestIndexExpressions(t *testing.T) {
 			"[1, 2, 3][-1]",
 			3,
 		},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][-1]", nil},
+		{`""[-1]`, nil},
+		{`"hello"[-2]`, "l"},
 		{`"hello world"[2]`, "l"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`"héllo"[5]`, nil},
 		{
 			`let myStr = "foobar"; let i = 1; myStr[i]`,
 			"o",
@@ -304,6 +664,99 @@ func TestIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3, 4, 5][1:3]", "[2, 3]"},
+		{"[1, 2, 3, 4, 5][:2]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][3:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][-2:]", "[4, 5]"},
+		{"[1, 2, 3, 4, 5][:-3]", "[1, 2]"},
+		{"[1, 2, 3, 4, 5][::2]", "[1, 3, 5]"},
+		{"[1, 2, 3, 4, 5][1::2]", "[2, 4]"},
+		{"[1, 2, 3, 4, 5][::-1]", "[5, 4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][3:0:-1]", "[4, 3, 2]"},
+		{"[1, 2, 3, 4, 5][-10:10]", "[1, 2, 3, 4, 5]"},
+		{"[1, 2, 3, 4, 5][3:1]", "[]"},
+		{"[][1:]", "[]"},
+		{"let i = 1; let arr = [1, 2, 3]; arr[i:i + 1]", "[2]"},
+		{`"hello world"[:5]`, "hello"},
+		{`"hello"[:-2]`, "hel"},
+		{`"héllo"[1:3]`, "él"},
+		{`"hello"[::-1]`, "olleh"},
+		{`""[1:]`, ""},
+		{`[1, 2][::0]`, "slice step cannot be zero"},
+		{`[1, 2]["a":]`, "slice indices must be INTEGER, got STRING"},
+		{`5[1:2]`, "cannot slice INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch evaluated := evaluated.(type) {
+		case *object.Array:
+			testArrayObject(t, evaluated, tt.expected)
+		case *object.Error:
+			if evaluated.Message != tt.expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, evaluated.Message)
+			}
+		default:
+			testStringObject(t, evaluated, tt.expected)
+		}
+	}
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"1..5", "1..5"},
+		{"1..=5", "1..=5"},
+		{"let n = 3; 0..n + 1", "0..4"},
+		{"len(0..10)", 10},
+		{"len(0..=10)", 11},
+		{"len(5..1)", 0},
+		{"len(-2..2)", 4},
+		{"len(-1..9223372036854775806)", 9223372036854775807},
+		{"len(-9223372036854775807 - 1..9223372036854775807)", "length of range -9223372036854775808..9223372036854775807 does not fit in an integer"},
+		{"len(-9223372036854775807 - 1..=9223372036854775807)", "length of range -9223372036854775808..=9223372036854775807 does not fit in an integer"},
+		{"let mut n = 0; for (i in -9223372036854775807 - 1..9223372036854775807) { if (n == 3) { break; } n += 1; } n", 3},
+		{"typeof(1..2)", "RANGE"},
+		{"let mut sum = 0; for (i in 1..5) { sum = sum + i; } sum", 10},
+		{"let mut sum = 0; for (i in 1..=5) { sum = sum + i; } sum", 15},
+		{"let mut sum = 0; for (i, x in 10..13) { sum = sum + i * x; } sum", 35},
+		{"let mut n = 0; for (i in 0..1000000000) { if (i == 3) { break; } n = n + 1; } n", 3},
+		{"let mut n = 0; for (i in 3..0) { n = n + 1; } n", 0},
+		{`1.."a"`, "range bounds must be INTEGER, got INTEGER .. STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch evaluated := evaluated.(type) {
+			case *object.Range:
+				if evaluated.Inspect() != expected {
+					t.Errorf("wrong range. expected=%q, got=%q", expected, evaluated.Inspect())
+				}
+			case *object.Error:
+				if evaluated.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, evaluated.Message)
+				}
+			default:
+				testStringObject(t, evaluated, expected)
+			}
+		}
+	}
+}
+
 func TestDotExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -468,6 +921,13 @@ if (10 > 1) {
 		},
 		{"foobar", "identifier not found: foobar"},
 		{`{"name": "Dodo"}[fn(x) { x }];`, "type of FUNCTION cannot be used as hash key"},
+		{"1.5 + true;", "type mismatch: FLOAT + BOOLEAN"},
+		{`2.5 + "a"`, "type mismatch: FLOAT + STRING"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"1 / 0", "division by zero"},
+		{"let x = 0; 10 % x", "division by zero"},
+		{"fn(x, y) { x }(1)", "wrong number of arguments: want=2, got=1"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", "stack overflow: exceeded 20000 nested calls"},
 	}
 
 	for _, tt := range tests {
@@ -477,6 +937,101 @@ if (10 > 1) {
 	}
 }
 
+func TestMaxCallDepth(t *testing.T) {
+	input := "let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };"
+
+	// Deep but legitimate recursion, such as folding a long array
+	testIntegerObject(t, testEval(input+"count(15000)"), 15000)
+	testIntegerObject(t, testEval(`
+	let fold = fn(arr, init, f) {
+	  let iter = fn(arr, result) {
+	    if (arr.len() == 0) {
+	      return result;
+	    } else {
+	      iter(arr.rest(), f(result, arr.first()));
+	    }
+	  }
+
+	  iter(arr, init);
+	}
+
+	let mut arr = [];
+	for (i in 0..2000) { arr = push(arr, 1); }
+
+	fold(arr, 0, fn(acc, el) { acc + el });`), 2000)
+
+	defer func(depth int) { MaxCallDepth = depth }(MaxCallDepth)
+	MaxCallDepth = 10
+
+	testError(t, testEval(input+"count(10)"), "stack overflow: exceeded 10 nested calls")
+	testIntegerObject(t, testEval(input+"count(9)"), 9)
+
+	// The depth of the calls that failed is given back
+	testIntegerObject(t, testEval(input+"try { count(20) } catch (e) { 0 }; count(9)"), 9)
+}
+
+func TestEvalIncompleteProgram(t *testing.T) {
+	// The programs fail to parse, but are evaluated regardless
+	tests := []string{
+		"let = 1;",
+		"let x = 1;\nlet = x;",
+		"if (true) { let = 1; }",
+		"fn() { let = 1; }()",
+		"let x = 1 + ;",
+		"println(99999999999999999999)",
+		`"${1 + }"`,
+	}
+
+	for _, input := range tests {
+		testError(t, testEval(input), "cannot evaluate incomplete program")
+	}
+}
+
+func TestEvalRecoversFromPanics(t *testing.T) {
+	// A let statement without a name, which the parser never makes
+	node := &ast.LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Value: &ast.Boolean{Value: true}}
+
+	evaluated := Eval(node, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedInspect string
+	}{
+		{"foobar", "ERROR: 1:1: identifier not found: foobar"},
+		{"let x = 5;\nlet y = x + true;", "ERROR: 2:11: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(x) {\n  x + y;\n};\nf(1);", "ERROR: 2:7: identifier not found: y"},
+		{"let a = 1;\n\n  len(a);", "ERROR: 3:6: argument to `len` not supported, got INTEGER"},
+		{"let x = 1;\nlet y = x + ;", "ERROR: 2:11: cannot evaluate incomplete program"},
+		{"let x = 1;\nlet = x;", "ERROR: cannot evaluate incomplete program"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
 func testError(t *testing.T, obj object.Object, expectedError string) bool {
 	errObj, ok := obj.(*object.Error)
 
@@ -510,6 +1065,15 @@ func TestLetStatements(t *testing.T) {
 		{"let mut a = 5; let b = a; let c = a + b + 5; c;", 15},
 		{"let mut a = 5; let a = 5; a;", "identifier 'a' already exists"},
 		{"let a = 5; let a = 5; a;", "identifier 'a' already exists"},
+		{"let a = 1; let f = fn() { let a = 2; a }; f() * 10 + a;", 21},
+		{"let a = 1; let f = fn(a) { a * 2 }; f(5) + a;", 11},
+		{"let a = 1; if (true) { let a = 2; } a;", 1},
+		{"let a = 1; let mut b = 0; if (true) { let a = 2; b = a; } b;", 2},
+		{"let mut a = 1; for (x in [1, 2]) { let a = x * 10; } a;", 1},
+		{"let x = 100; for (x in [1, 2]) { let x = 3; } x;", 100},
+		{"let f = fn() { let a = 1; let a = 2; a }; f();", "identifier 'a' already exists"},
+		{"let f = fn(a) { let a = 2; a }; f(1);", "identifier 'a' already exists"},
+		{"if (true) { let a = 1; let a = 2; }", "identifier 'a' already exists"},
 	}
 
 	for _, tt := range tests {
@@ -522,6 +1086,276 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [first, ...rest] = [1, 2, 3]; first + len(rest)", 3},
+		{"let [_, [x, y]] = [0, [3, 4]]; x * y", 12},
+		{`let {"name": n, "age": age} = {"name": "dodo", "age": 3}; len(n) + age`, 7},
+		{"let mut [a, b] = [1, 2]; a = 5; a + b", 7},
+		{`let f = fn([a, b], {"k": v}) { a + b + v }; f([1, 2], {"k": 3})`, 6},
+		{"let f = fn([a, b] = [1, 2]) { a * b }; f()", 2},
+		{"let f = fn([x, ...xs]) { fn() { x + len(xs) } }; f([5, 6])()", 6},
+		{"let mut total = 0; for (let mut [i, n] = [0, 3]; i < n; i += 1) { total += i; } total", 3},
+		{"let a = 1; if (true) { let [a] = [2]; } a", 1},
+		{"let [a, b] = [1, 2]; a = 5;", "identifier 'a' is not mutable"},
+		{"let [a, b] = [1];", "cannot destructure [1]: expected an array of length 2 to match [a, b], got length 1"},
+		{"let [a, ...b] = [];", "cannot destructure []: expected an array of at least length 1 to match [a, ...b], got length 0"},
+		{"let [a] = 5;", "cannot destructure 5: expected ARRAY to match [a], got INTEGER"},
+		{`let {"name": n} = {"age": 3};`, "cannot destructure {age: 3}: missing key name to match {name: n}"},
+		{"let f = fn([a, b]) { a }; f([1]);", "cannot destructure [1]: expected an array of length 2 to match [a, b], got length 1"},
+		{"let a = 1; let [a, b] = [1, 2];", "identifier 'a' already exists"},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case string:
+			testError(t, testEval(tt.input), expected)
+		}
+	}
+}
+
+func TestStructs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age`, 36},
+		{`struct Person { name, age }; let p = Person(age: 36, name: "Ada"); p.name`, "Ada"},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age + 1`, 37},
+		{`struct Person { name, age }; let p = Person("Ada", 36); typeof(p)`, "Person"},
+		{"struct Person { name, age }; typeof(Person)", "STRUCT_TYPE"},
+		{`struct Person { name, age }; let p = Person("Ada", [1, 2]); p.age[1]`, 2},
+		{`struct Person { name, age }; let p = Person("Ada", 36); "${p}"`, "Person{name: Ada, age: 36}"},
+		{`struct Person { name, age }; "${Person}"`, "struct Person { name, age }"},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.age = 40; p.age`, 40},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.age += 1; p.age`, 37},
+		{`struct Person { name, age }; let p = Person("Ada", 36); let mut q = p; q.age = 1; p.age`, 36},
+		{`struct Line { from, to }; let mut l = Line({"x": 0}, {"x": 1}); l.to["x"] = 5; l.to["x"]`, 5},
+		{"let f = fn() { struct Point { x, y }; Point(1, 2) }; f().y", 2},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case string:
+			testStringObject(t, testEval(tt.input), expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Person { name, age }; Person("Ada")`, "wrong number of arguments: want=2, got=1"},
+		{`struct Person { name, age }; Person("Ada", height: 2)`, "unknown parameter 'height'"},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.height`, "Person has no field 'height'"},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.height = 1;`, "Person has no field 'height'"},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p[0]`, "type of INTEGER cannot be used to index Person"},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age = 1;`, "identifier 'p' is not mutable"},
+		{"struct Person { name, age }; struct Person { x }", "identifier 'Person' already exists"},
+	}
+
+	for _, tt := range errors {
+		testError(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(2).r", 2},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Rect(h: 3, w: 4).w * Rect(1, 5).h", 20},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(Circle(1))", "Circle"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(Empty)", "Empty"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; typeof(Rect(1, 2))", "Shape"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; typeof(Empty)", "Shape"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; "${Circle(1)} ${Rect(1, 2)} ${Empty}"`, "Circle(1) Rect(1, 2) Empty"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; "${Shape}"`, "enum Shape { Circle(r), Rect(w, h), Empty }"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; let area = fn(s) { match variant_of(s) { "Circle" => 3 * s.r * s.r, "Rect" => s.w * s.h, _ => 0 } }; area(Circle(2)) + area(Rect(2, 3)) + area(Empty)`, 18},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; impl Shape { fn scale(self, k) { match variant_of(self) { "Circle" => Circle(self.r * k), _ => self } } } Circle(2).scale(3).r`, 6},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; let mut s = Rect(1, 2); s.w = 5; s.w", 5},
+		{`enum State { Pending, Failed(reason) }; let states = [Pending, Failed("timeout")]; states[1].reason`, "timeout"},
+		{"enum Unit { Made() }; variant_of(Made())", "Made"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(1)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(1.0)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(2)", false},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) != Circle(2)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Rect(1, 2) == Rect(1, 2)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty == Empty", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty != Circle(1)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(Empty) == Circle(Empty)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == 1", false},
+		{"enum A { X(v) }; enum B { Y(v) }; X(1) == Y(1)", false},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case bool:
+			testBooleanObject(t, testEval(tt.input), expected)
+		case string:
+			testStringObject(t, testEval(tt.input), expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle()", "wrong number of arguments: want=1, got=0"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1).w", "Circle has no field 'w'"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty()", "not a function: ENUM"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(1)", "argument to `variant_of` not supported, got INTEGER"},
+		{"let Circle = 1; enum Shape { Circle(r) }", "identifier 'Circle' already exists"},
+		{"enum Shape { Shape }", "identifier 'Shape' already exists"},
+	}
+
+	for _, tt := range errors {
+		testError(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`try { 1 + "a" } catch (e) { e.message }`, "type mismatch: INTEGER + STRING"},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom" } catch (e) { e }`, "boom"},
+		{`try { throw error("boom") } catch (e) { e.message }`, "boom"},
+		{`try { throw error("outer", error("inner")) } catch (e) { e.cause.message }`, "inner"},
+		{`try { throw error("boom") } catch (e) { is_error(e) }`, true},
+		{`try { [1, 2].missing } catch (e) { typeof(e) }`, "ERROR_VALUE"},
+		{`let f = fn(n) { if (n == 0) { throw n } f(n - 1) }; try { f(10) } catch (e) { e + 1 }`, 1},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e + 1 }`, 3},
+		{`let mut log = ""; let r = try { throw "x" } catch (e) { log += "catch "; 1 } finally { log += "finally" }; "${r} ${log}"`, "1 catch finally"},
+		{`let mut log = ""; let r = try { try { throw "x" } finally { log += "inner " } } catch (e) { log += e }; log`, "inner x"},
+		{`let mut log = ""; try { try { throw "x" } catch (e) { throw e + "y" } finally { log += "finally " } } catch (e) { log += e }; log`, "finally xy"},
+		{`let mut log = ""; let f = fn() { try { return 1 } finally { log += "finally" } }; "${f()} ${log}"`, "1 finally"},
+		{`let mut n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } n += x } finally { n += 10 } }; n`, 34},
+		{`let mut n = 0; outer: for (x in [1, 2]) { for (y in [1, 2]) { try { if (y == 2) { break outer } n += 1 } finally { n += 10 } } }; n`, 21},
+		{`let mut n = 0; for (x in 0..100) { try { n += x } catch (e) { 0 } }; n`, 4950},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } s }; is_error(parse(""))`, true},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } s }; is_error(parse("x"))`, false},
+		{`unwrap(5)`, 5},
+		{`try { unwrap(error("bad")) } catch (e) { e.message }`, "bad"},
+		{`try { undefined_var } catch (e) { e.message }`, "identifier not found: undefined_var"},
+		{`let x = 1; try { x = 2 } catch (e) { e.message }`, "identifier 'x' is not mutable"},
+		{`try { let a = 1; let a = 2; a } catch (e) { e.message }`, "identifier 'a' already exists"},
+		{`let f = try { fn() { missing } } catch (e) { 0 }; try { f() } catch (e) { e.message }`, "identifier not found: missing"},
+		{`"${error("a", error("b"))}"`, "error: a: b"},
+		{`let mut e = error("a"); e.message = "b"; e.message`, "b"},
+		{`if (error("a").cause) { 1 } else { 2 }`, 2},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case bool:
+			testBooleanObject(t, testEval(tt.input), expected)
+		case string:
+			testStringObject(t, testEval(tt.input), expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom"`, "boom"},
+		{`throw error("outer", error("inner"))`, "outer: inner"},
+		{`unwrap(error("bad"))`, "bad"},
+		{`try { 1 + "a" } finally { 0 }`, "type mismatch: INTEGER + STRING"},
+		{`try { 1 } finally { throw "late" }`, "late"},
+		{`try { throw 1 } catch (e) { throw "again" }`, "again"},
+		{`error(1)`, "argument to `error` must be STRING, got INTEGER"},
+		{`error("a").code`, "error has no field 'code'"},
+		{`let mut e = error("a"); e.message = 1;`, "message of an error must be a STRING, got INTEGER"},
+		{`let f = try { fn() { missing } } catch (e) { 0 }; f()`, "identifier not found: missing"},
+	}
+
+	for _, tt := range errors {
+		testError(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet()`, "Hello, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet("Hi")`, "Hi, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet(greeting: "Hey")`, "Hey, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.older(2).older(3).age`, 41},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.len()`, 36},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); "dodo".len()`, 4},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); let twice = fn(x) { x * 2 }; p.age.twice()`, 72},
+		{"struct Counter { n }; let step = 10; impl Counter { fn next(self) { Counter(self.n + step) } } Counter(1).next().n", 11},
+		{"struct Node { value, next }; impl Node { fn sum(self) { if (self.next == 0) { self.value } else { self.value + self.next.sum() } } } Node(1, Node(2, Node(3, 0))).sum()", 6},
+		{"struct P { x }; impl P { fn get(self) { 1 } } impl P { fn get(self) { 2 } } P(0).get()", 2},
+		{"struct P { cb }; let p = P(fn(x) { x * 2 }); p.cb(4)", 8},
+		{"struct P { cb }; let p = P(fn(x) { x * 2 }); (p.cb)(4)", 8},
+		{"let cb = fn(x) { 0 }; struct P { cb }; P(fn(x) { x + 1 }).cb(4)", 5},
+		{"struct P { cb }; P(fn(x, y = 1) { x + y }).cb(1, y: 10)", 11},
+		{"struct P { len }; impl P { fn len(self) { 1 } } P(fn() { 2 }).len()", 1},
+		{"enum Op { Apply(f) }; Apply(fn(a, b) { a - b }).f(5, 3)", 2},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case string:
+			testStringObject(t, testEval(tt.input), expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.fly()`, "identifier not found: fly"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet(1, 2)`, "wrong number of arguments: want=1 to 2, got=3"},
+		{"impl Missing { fn f(self) { 1 } }", "identifier not found: Missing"},
+		{"let x = 5; impl x { fn f(self) { 1 } }", "cannot implement methods for INTEGER"},
+		{"struct P { cb }; P(1).cb()", "not a function: INTEGER"},
+		{"struct P { cb }; P(1).missing()", "identifier not found: missing"},
+	}
+
+	for _, tt := range errors {
+		testError(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestShadowingWarnings(t *testing.T) {
+	var out bytes.Buffer
+
+	Warnings = &out
+	defer func() { Warnings = nil }()
+
+	testEval("let a = 1; let f = fn(b) { let a = 2; for (x in [1, 2]) { let b = x; } }; f(1);")
+
+	expected := "1:32: warning: 'a' shadows a variable of an enclosing scope\n" +
+		"1:63: warning: 'b' shadows a variable of an enclosing scope\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong warnings. expected=%q, got=%q", expected, out.String())
+	}
+}
+
 func TestReassignmentStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -530,6 +1364,38 @@ func TestReassignmentStatements(t *testing.T) {
 		{"let mut a = 3; a = 5; a;", 5},
 		{"let mut a = 3; let b = a; a = a + b + 5; a;", 11},
 		{"let a = 5; a = 3; a;", "identifier 'a' is not mutable"},
+		{"let mut a = 3; a += 2; a;", 5},
+		{"let mut a = 3; a -= 5; a;", -2},
+		{"let mut a = 3; a *= 4; a;", 12},
+		{"let mut a = 12; a /= 4; a;", 3},
+		{"let mut arr = [1, 2, 3]; arr[0] = 5; arr[0] + arr[1];", 7},
+		{"let mut arr = [1, 2, 3]; arr[-1] = 10; arr[2];", 10},
+		{"let mut arr = [1, 2, 3]; arr[1] += 5; arr[1];", 7},
+		{"let mut arr = [[1, 2], [3, 4]]; arr[1][0] *= 10; arr[1][0] + arr[0][0];", 31},
+		{`let mut m = {"a": 1}; m["a"] = 2; m["b"] = 3; m["a"] + m["b"];`, 5},
+		{`let mut m = {"a": 1}; m["a"] += 1; m["a"];`, 2},
+		{`let mut m = {"xs": [1, 2]}; m["xs"][0] = 7; m["xs"][0];`, 7},
+		{`let mut m = {"a": 1}; let key = "a"; m.key = 4; m.key;`, 4},
+		{"let mut a = [1, 2]; let b = a; a[0] = 9; b[0];", 1},
+		{"let mut a = [1, 2]; let b = push(a, 3); a[0] = 9; len(a) + b[0];", 3},
+		{"let mut a = [1, 2]; a[0] = 5; let b = a; a[1] = 9; b[1];", 2},
+		{"let mut a = [[1], [2]]; a[0][0] = 5; let b = a[0]; a[0][0] = 7; b[0];", 5},
+		{"let mut a = [[1]]; a[0][0] = 2; let [x] = a; a[0][0] = 3; x[0];", 2},
+		{"let mut a = [1, 2]; a[0] = 5; let f = fn(x) { let mut y = x; y[1] = 9; y }; f(a); a[1];", 2},
+		{"let mut a = [1]; a[0] = 2; let b = push([], a); a[0] = 3; b[0][0];", 2},
+		{"let mut a = [1]; a[0] = 2; let b = unwrap(a); a[0] = 3; b[0];", 2},
+		{`let mut m = {"a": 1}; m["a"] = 2; let n = m; m["a"] = 3; n["a"];`, 2},
+		{"let mut a = [0, 0, 0]; let mut i = 1; for (i < len(a)) { a[i] = a[i - 1] + 1; i += 1; } a[2];", 2},
+		{"let mut fs = []; for (let mut xs = [0]; xs[0] < 2; xs[0] += 1) { fs = push(fs, fn() { xs[0] }); } fs[0]() + fs[1]();", 1},
+		{"let mut a = [1, 2]; for (i in 0..len(a)) { a[i] *= 2; } a[0] + a[1];", 6},
+		{"let mut i = 0; for (; i < 10; i += 3) {} i;", 12},
+		{"let arr = [1, 2]; arr[0] = 3;", "identifier 'arr' is not mutable"},
+		{"let mut arr = [1, 2]; arr[5] = 3;", "index 5 out of range for array of length 2"},
+		{`let mut arr = [1, 2]; arr["a"] = 3;`, "type of STRING cannot be used to index ARRAY"},
+		{`let mut s = "ab"; s[0] = "c";`, "cannot assign to an index of STRING"},
+		{`let mut m = {}; m[[1]] = 3;`, "type of ARRAY cannot be used as hash key"},
+		{`let mut a = "x"; a -= 1;`, "type mismatch: STRING - INTEGER"},
+		{"b += 1;", "identifier not found: b"},
 	}
 
 	for _, tt := range tests {
@@ -542,6 +1408,64 @@ func TestReassignmentStatements(t *testing.T) {
 	}
 }
 
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let mut i = 0; for (i < 3) { let doubled = i * 2; i = i + 1; } i", 3},
+		{"for (x in [1, 2, 3]) { let y = x; } 0", 0},
+		{"let mut n = 0; if (true) { let y = 5; n = y; } n", 5},
+		{"let mut n = 0; if (false) {} else { let y = 7; n = y; } n", 7},
+		{"let mut total = 0; for (x in [1, 2]) { for (y in [10, 20]) { let p = x * y; total += p; } } total", 90},
+		{`let counter = fn() {
+		    let mut count = 0;
+		    fn() { count += 1; count }
+		  };
+		  let next = counter();
+		  next(); next(); next()`, 3},
+		{`let make = fn() {
+		    let mut count = 0;
+		    let inc = fn() { count += 1; };
+		    inc(); inc();
+		    count
+		  };
+		  make()`, 2},
+		{`let f = fn() {
+		    let mut total = 0;
+		    let add = fn(x) { fn() { total += x; } };
+		    add(2)(); add(3)();
+		    total
+		  };
+		  f()`, 5},
+		{`let f = fn() {
+		    let mut fns = [];
+		    for (let mut i = 0; i < 3; i += 1) { fns = push(fns, fn() { i }); }
+		    fns[0]() + fns[1]() + fns[2]()
+		  };
+		  f()`, 3},
+		{`let f = fn() {
+		    let mut items = [];
+		    let add = fn(x) { items = push(items, x); };
+		    add(1); add(2);
+		    len(items)
+		  };
+		  f()`, 2},
+		{"if (true) { let y = 1; } y", "identifier not found: y"},
+		{"for (x in [1]) { let y = 1; } y", "identifier not found: y"},
+		{"let f = fn() { let a = 1; fn() { a = 2; } }; f()()", "identifier 'a' is not mutable"},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case string:
+			testError(t, testEval(tt.input), expected)
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -585,6 +1509,44 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let add = fn(x, y = 10) { x + y }; add(1)", 11},
+		{"let add = fn(x, y = 10) { x + y }; add(1, 2)", 3},
+		{"let f = fn(x, y = x * 2) { y }; f(4)", 8},
+		{"let base = 100; let f = fn(x = base) { x }; f()", 100},
+		{"let f = fn(first, ...rest) { first + len(rest) }; f(10, 1, 2, 3)", 13},
+		{"let f = fn(first, ...rest) { len(rest) }; f(10)", 0},
+		{"let sum = fn(...xs) { let mut t = 0; for (x in xs) { t += x; } t }; sum(1, 2, 3)", 6},
+		{"let f = fn(x, y = 2, ...rest) { x * 100 + y * 10 + len(rest) }; f(1, 3, 5, 6)", 132},
+		{"let sub = fn(x, y) { x - y }; sub(y: 1, x: 10)", 9},
+		{"let sub = fn(x, y) { x - y }; sub(10, y: 3)", 7},
+		{"let f = fn(a, b = 2, c = 3) { a * 100 + b * 10 + c }; f(1, c: 5)", 125},
+		{"let sub = fn(x, y) { x - y }; 1 |> sub(10, y: $)", 9},
+		{"let add = fn(x, y) { x + y }; add(1)", "wrong number of arguments: want=2, got=1"},
+		{"let add = fn(x, y) { x + y }; add(1, 2, 3)", "wrong number of arguments: want=2, got=3"},
+		{"let f = fn(x, y = 1) { x }; f()", "wrong number of arguments: want=1 to 2, got=0"},
+		{"let f = fn(x, ...rest) { x }; f()", "wrong number of arguments: want=at least 1, got=0"},
+		{"let f = fn(x, y) { x }; f(y: 1)", "missing argument for parameter 'x'"},
+		{"let f = fn(x) { x }; f(1, x: 2)", "argument 'x' given more than once"},
+		{"let f = fn(x) { x }; f(z: 2)", "unknown parameter 'z'"},
+		{"let f = fn(x = y) { x }; f()", "identifier not found: y"},
+		{`len(value: "abc")`, "builtin functions do not take named arguments"},
+	}
+
+	for _, tt := range tests {
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, testEval(tt.input), int64(expected))
+		case string:
+			testError(t, testEval(tt.input), expected)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 	let newAdder = fn(x) { fn(y) { x + y }; };
@@ -604,6 +1566,7 @@ func TestBuiltinFunction(t *testing.T) {
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
 		{`len("")`, 0},
+		{`len("héllo")`, 5},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
@@ -618,12 +1581,32 @@ func TestBuiltinFunction(t *testing.T) {
 		{`last([1, 2, 3])`, 3},
 		{`last([])`, NULL},
 		{`last("")`, NULL},
+		{`first("ñandú")`, "ñ"},
+		{`last("ñandú")`, "ú"},
+		{`rest("ñandú")`, "andú"},
+		{`bytes("hé")`, "[104, 195, 169]"},
+		{`bytes("")`, "[]"},
+		{`bytes(1)`, "argument to `bytes` not supported, got INTEGER"},
+		{`len(bytes("héllo"))`, 6},
 		{`push([1, 2, 3], 4);`, "[1, 2, 3, 4]"},
 		{`let myArray = [1, 2, 3];
 		  let newArray = push(myArray, 4);
 		  newArray;`, "[1, 2, 3, 4]"},
 		{`typeof("hello world")`, "STRING"},
 		{`typeof(9)`, "INTEGER"},
+		{`typeof(9.5)`, "FLOAT"},
+		{`int(3.99)`, 3},
+		{`int(-3.99)`, -3},
+		{`int("42")`, 42},
+		{`int(7)`, 7},
+		{`int("4.2")`, "could not convert \"4.2\" to an integer"},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{`int(1.0 / 0)`, "could not convert +Inf to an integer"},
+		{`int(0.0 / 0)`, "could not convert NaN to an integer"},
+		{`int(float("1e19"))`, "could not convert 1e+19 to an integer"},
+		{`int(float("-9223372036854775808"))`, -9223372036854775808},
+		{`float("abc")`, "could not convert \"abc\" to a float"},
+		{`float([])`, "argument to `float` not supported, got ARRAY"},
 		{`typeof(fn (x) { 420; })`, "FUNCTION"},
 		{`typeof(len)`, "BUILTIN"},
 		{`typeof("one", "two")`, "wrong number of arguments. got=2, expected=1"},
@@ -797,6 +1780,22 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, expected=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testStringObject(t *testing.T, obj object.Object, expected string) bool {
 	result, ok := obj.(*object.String)
 
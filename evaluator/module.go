@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"dodo-lang/ast"
+	"dodo-lang/lexer"
+	"dodo-lang/object"
+	"dodo-lang/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Modules are cached by their absolute path so each file is only evaluated
+// once, no matter how many files import it. The loading stack holds the
+// modules currently being evaluated and is used to detect import cycles.
+var (
+	modules = map[string]*object.Module{}
+	loading = []string{}
+)
+
+// EvalFile evaluates the program of the file being run. The file counts as
+// being loaded while it runs, so a module importing it is reported as an
+// import cycle rather than running the file a second time.
+func EvalFile(program *ast.Program, filename string, env *object.Environment) object.Object {
+	if absPath, err := filepath.Abs(filename); err == nil {
+		loading = append(loading, absPath)
+		defer func() { loading = loading[:len(loading)-1] }()
+	}
+
+	return Eval(program, env)
+}
+
+func evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	if env.Declared(node.Name.Value) {
+		return newError("identifier '%s' already exists", node.Name.Value)
+	}
+
+	module := loadModule(node)
+
+	if isError(module) {
+		return module
+	}
+
+	env.Set(node.Name.Value, false, module)
+
+	return nil
+}
+
+func loadModule(node *ast.ImportStatement) object.Object {
+	path := node.FilePath()
+	absPath, err := filepath.Abs(path)
+
+	if err != nil {
+		return newError("could not import %q: %s", node.Path, err)
+	}
+
+	if module, ok := modules[absPath]; ok {
+		return module
+	}
+
+	for i, loadingPath := range loading {
+		if loadingPath == absPath {
+			cycle := append([]string{}, loading[i:]...)
+			cycle = append(cycle, absPath)
+
+			for j := range cycle {
+				cycle[j] = filepath.Base(cycle[j])
+			}
+
+			return newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return newError("could not import %q: %s", node.Path, err)
+	}
+
+	p := parser.New(lexer.NewFile(path, string(content)))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return newError("could not import %q: %s", node.Path, strings.Join(p.Errors(), "; "))
+	}
+
+	loading = append(loading, absPath)
+	defer func() { loading = loading[:len(loading)-1] }()
+
+	module := &object.Module{Name: node.Name.Value, Path: absPath, Env: object.NewEnvironment()}
+
+	if result := Eval(program, module.Env); isError(result) {
+		return result
+	}
+
+	modules[absPath] = module
+
+	return module
+}
+
+func evalModuleMember(module *object.Module, name string) object.Object {
+	if val, ok := module.Env.Get(name); ok {
+		object.Share(val)
+		return val
+	}
+
+	return newError("module %s has no binding '%s'", module.Name, name)
+}
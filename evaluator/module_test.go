@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"dodo-lang/lexer"
+	"dodo-lang/object"
+	"dodo-lang/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportStatements(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/fold.dodo": `
+let fold = fn(arr, init, f) {
+  let iter = fn(arr, result) {
+    if (arr.len() == 0) {
+      return result;
+    } else {
+      iter(arr.rest(), f(result, arr.first()));
+    }
+  }
+
+  iter(arr, init);
+};
+
+let answer = 42;`,
+		"math.dodo": `let double = fn(x) { x * 2 };`,
+	})
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`import "lib/fold.dodo"; fold.fold([1, 2, 3, 4, 5], 0, fn(acc, el) { acc + el })`, 15},
+		{`import "lib/fold.dodo"; fold.answer`, 42},
+		{`import "lib/fold.dodo"; let a = fold.answer; a + 1`, 43},
+		{`import math; math.double(21)`, 42},
+		{`import math; typeof(math)`, "MODULE"},
+		{`import math; math.triple(1)`, "module math has no binding 'triple'"},
+		{`import math; math.triple`, "module math has no binding 'triple'"},
+		{`let math = 1; import math;`, "identifier 'math' already exists"},
+		{`import "missing.dodo";`, "could not import \"missing.dodo\": open " + filepath.Join(dir, "missing.dodo") + ": no such file or directory"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalFile(filepath.Join(dir, "main.dodo"), tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			switch result := evaluated.(type) {
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			default:
+				testStringObject(t, result, expected)
+			}
+		}
+	}
+}
+
+func TestImportsAreCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"counter.dodo": `let value = [1, 2, 3];`,
+		"a.dodo":       `import counter;`,
+		"b.dodo":       `import counter;`,
+	})
+
+	input := `import a;
+import b;
+(a.counter) == (b.counter);`
+
+	evaluated := testEvalFile(filepath.Join(dir, "main.dodo"), input)
+	testBooleanObject(t, evaluated, true)
+}
+
+func TestImportCycles(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.dodo": `import b;`,
+		"b.dodo": `import c;`,
+		"c.dodo": `import a;`,
+	})
+
+	evaluated := testEvalFile(filepath.Join(dir, "main.dodo"), `import a;`)
+
+	testError(t, evaluated, "import cycle: a.dodo -> b.dodo -> c.dodo -> a.dodo")
+
+	errObj := evaluated.(*object.Error)
+
+	if errObj.Pos.Filename != filepath.Join(dir, "c.dodo") || errObj.Pos.Line != 1 {
+		t.Errorf("wrong error position. got=%s", errObj.Pos)
+	}
+}
+
+func TestImportCyclesThroughTheFileRun(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.dodo": `import main;`,
+	})
+
+	evaluated := testEvalFile(filepath.Join(dir, "main.dodo"), `import a;`)
+
+	testError(t, evaluated, "import cycle: main.dodo -> a.dodo -> main.dodo")
+}
+
+func TestImportParseErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"broken.dodo": "let x = ;",
+	})
+
+	evaluated := testEvalFile(filepath.Join(dir, "main.dodo"), `import broken;`)
+	expected := "could not import \"broken.dodo\": " + filepath.Join(dir, "broken.dodo") + ":1:9: no prefix parse function for ; found"
+
+	testError(t, evaluated, expected)
+}
+
+// writeModules creates the given files in a fresh directory and returns it
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func testEvalFile(filename string, input string) object.Object {
+	l := lexer.NewFile(filename, input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return EvalFile(program, filename, env)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"dodo-lang/formatter"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runFmt implements `dodo fmt [-w] [-d] [files...]`, formatting standard
+// input to standard output when no files are given
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "Write the result to the file instead of standard output")
+	diff := flags.Bool("d", false, "Show a diff instead of the formatted source")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		formatted, err := formatter.Format(string(src))
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if *diff {
+			fmt.Print(formatter.Diff("<stdin>", string(src), formatted))
+		} else {
+			fmt.Print(formatted)
+		}
+
+		return 0
+	}
+
+	status := 0
+
+	for _, filename := range flags.Args() {
+		if err := formatFile(filename, *write, *diff); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+func formatFile(filename string, write, diff bool) error {
+	src, err := os.ReadFile(filename)
+
+	if err != nil {
+		return err
+	}
+
+	formatted, err := formatter.Format(string(src))
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if diff {
+		fmt.Print(formatter.Diff(filename, string(src), formatted))
+	}
+
+	if write {
+		if formatted == string(src) {
+			return nil
+		}
+
+		info, err := os.Stat(filename)
+
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filename, []byte(formatted), info.Mode().Perm())
+	}
+
+	if !diff {
+		fmt.Print(formatted)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// Diff returns a unified diff turning before into after, or an empty string
+// when they are equal. The diff is line based, computed from the longest
+// common subsequence of the two texts.
+func Diff(name string, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	a := splitLines(before)
+	b := splitLines(after)
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", name+".orig", name)
+
+	for start := 0; start < len(ops); {
+		// Find the next change and the run of changes close enough to it to
+		// share a hunk
+		first := start
+
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+
+		if first == len(ops) {
+			break
+		}
+
+		last := first
+
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*contextLines {
+				break
+			}
+		}
+
+		from := max(first-contextLines, 0)
+		to := min(last+contextLines+1, len(ops))
+		hunk := ops[from:to]
+
+		aStart, bStart := ops[from].aLine, ops[from].bLine
+		aCount, bCount := 0, 0
+
+		for _, op := range hunk {
+			if op.kind != '+' {
+				aCount++
+			}
+
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+
+		for _, op := range hunk {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+
+		start = to
+	}
+
+	return out.String()
+}
+
+// diffOp is a single line of a diff, kept (' '), removed ('-') or added ('+').
+// aLine and bLine are the 1-based line numbers the op starts at in each text.
+type diffOp struct {
+	kind  byte
+	text  string
+	aLine int
+	bLine int
+}
+
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i + 1, j + 1})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i + 1, j + 1})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i + 1, j + 1})
+			j++
+		}
+	}
+
+	return ops
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// Empty ranges refer to the line before the change
+		return fmt.Sprintf("%d,0", start-1)
+	}
+
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
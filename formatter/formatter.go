@@ -0,0 +1,896 @@
+// Package formatter prints Dodo source in its canonical form, with two space
+// indentation, consistent spacing and semicolons. Blank lines between
+// statements are kept, collapsed to a single one.
+//
+// Expressions are printed on a single line, except for blocks and for array
+// and hash literals broken over lines after their opening bracket, which are
+// printed with one element per line.
+//
+// Comments are kept where they are between statements, or at the end of the
+// line of a statement or of an element of a literal printed one per line.
+// Block comments inside an expression stay in front of the expression they
+// come before, other comments inside an expression are moved to after the
+// statement.
+package formatter
+
+import (
+	"bytes"
+	"dodo-lang/ast"
+	"dodo-lang/lexer"
+	"dodo-lang/parser"
+	"dodo-lang/token"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const indentation = "  "
+
+// Format parses src and returns it formatted. Source with parse errors is
+// not formatted, the errors are returned instead.
+func Format(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := newPrinter(src)
+	pr.statements(program.Statements, token.Position{})
+
+	return pr.buf.String(), nil
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+
+	// Tokens and comments of the source in order, used to find blank lines
+	// and the line a statement ends on
+	tokens     []token.Token
+	tokenIndex map[token.Position]int
+
+	comments []token.Token // Comments not printed yet
+}
+
+func newPrinter(src string) *printer {
+	pr := &printer{tokenIndex: map[token.Position]int{}}
+	l := lexer.New(src)
+
+	var tokens []token.Token
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		tokens = append(tokens, tok)
+	}
+
+	pr.comments = l.Comments()
+
+	// Merge the comments in between the tokens
+	comments := pr.comments
+
+	for _, tok := range tokens {
+		for len(comments) > 0 && before(comments[0].Pos, tok.Pos) {
+			pr.addToken(comments[0])
+			comments = comments[1:]
+		}
+
+		pr.addToken(tok)
+	}
+
+	for _, comment := range comments {
+		pr.addToken(comment)
+	}
+
+	return pr
+}
+
+func (pr *printer) addToken(tok token.Token) {
+	pr.tokenIndex[tok.Pos] = len(pr.tokens)
+	pr.tokens = append(pr.tokens, tok)
+}
+
+// sub returns an empty printer sharing the token information of pr, used to
+// render a node on its own. It leaves printing comments to pr.
+func (pr *printer) sub() *printer {
+	return &printer{tokens: pr.tokens, tokenIndex: pr.tokenIndex}
+}
+
+func (pr *printer) write(s string) {
+	pr.buf.WriteString(s)
+}
+
+func (pr *printer) writeIndent() {
+	pr.write(strings.Repeat(indentation, pr.indent))
+}
+
+// blankLineBefore reports whether the source has an empty line between the
+// token or comment at pos and the one before it
+func (pr *printer) blankLineBefore(pos token.Position) bool {
+	i, ok := pr.tokenIndex[pos]
+
+	if !ok || i == 0 {
+		return false
+	}
+
+	return pos.Line-endLine(pr.tokens[i-1]) > 1
+}
+
+// lineBreakAfter reports whether the source goes on to a new line after the
+// token at pos, not counting comments
+func (pr *printer) lineBreakAfter(pos token.Position) bool {
+	i, ok := pr.tokenIndex[pos]
+
+	if !ok {
+		return false
+	}
+
+	for i += 1; i < len(pr.tokens); i++ {
+		if pr.tokens[i].Type != token.COMMENT {
+			return pr.tokens[i].Pos.Line > pos.Line
+		}
+	}
+
+	return false
+}
+
+// lineBefore returns the line the token or comment before pos ends on
+func (pr *printer) lineBefore(pos token.Position) int {
+	i, ok := pr.tokenIndex[pos]
+
+	if !ok {
+		// pos is past the last token, eg. the end of the file
+		i = len(pr.tokens)
+	}
+
+	for i -= 1; i >= 0; i-- {
+		if pr.tokens[i].Type != token.COMMENT {
+			return endLine(pr.tokens[i])
+		}
+	}
+
+	return 0
+}
+
+// statements prints stmts, each on its own line, followed by the comments
+// left before end
+func (pr *printer) statements(stmts []ast.Statement, end token.Position) {
+	first := true
+
+	for i, stmt := range stmts {
+		start := startPos(stmt)
+
+		pr.commentsBefore(start, &first)
+
+		if !first && pr.blankLineBefore(start) {
+			pr.write("\n")
+		}
+
+		pr.writeIndent()
+		pr.statement(stmt)
+
+		next := end
+
+		if i+1 < len(stmts) {
+			next = startPos(stmts[i+1])
+		}
+
+		pr.trailingComment(next)
+		pr.write("\n")
+		first = false
+	}
+
+	pr.commentsBefore(end, &first)
+}
+
+// trailingComment prints the next comment at the end of the current line, if
+// it comes before next on the line the source before next ends on
+func (pr *printer) trailingComment(next token.Position) {
+	if len(pr.comments) > 0 && (!next.IsValid() || before(pr.comments[0].Pos, next)) &&
+		pr.comments[0].Pos.Line == pr.lineBefore(next) {
+		pr.write(" " + pr.comments[0].Literal)
+		pr.comments = pr.comments[1:]
+	}
+}
+
+// commentsBefore prints the comments before pos on lines of their own
+func (pr *printer) commentsBefore(pos token.Position, first *bool) {
+	for len(pr.comments) > 0 && (!pos.IsValid() || before(pr.comments[0].Pos, pos)) {
+		comment := pr.comments[0]
+		pr.comments = pr.comments[1:]
+
+		if !*first && pr.blankLineBefore(comment.Pos) {
+			pr.write("\n")
+		}
+
+		pr.writeIndent()
+		pr.write(comment.Literal)
+		pr.write("\n")
+
+		*first = false
+	}
+}
+
+// hasCommentsBetween reports whether any comment not printed yet lies between
+// start and end
+func (pr *printer) hasCommentsBetween(start, end token.Position) bool {
+	for _, comment := range pr.comments {
+		if before(start, comment.Pos) && before(comment.Pos, end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (pr *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement, *ast.ReassignmentStatement:
+		pr.simpleStatement(stmt)
+		pr.write(";")
+	case *ast.ReturnStatement:
+		pr.write("return")
+
+		if stmt.ReturnValue != nil {
+			pr.write(" ")
+			pr.expression(stmt.ReturnValue)
+		}
+
+		pr.write(";")
+	case *ast.ThrowStatement:
+		pr.write("throw ")
+		pr.expression(stmt.Value)
+		pr.write(";")
+	case *ast.ImportStatement, *ast.BreakStatement, *ast.ContinueStatement, *ast.StructStatement, *ast.EnumStatement:
+		pr.write(stmt.String())
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression)
+
+		// Statements ending in a block read like statements in other
+		// languages and go without a semicolon
+		switch stmt.Expression.(type) {
+		case *ast.IfExpression, *ast.MatchExpression, *ast.ForExpression, *ast.ForInExpression, *ast.TryExpression:
+		default:
+			pr.write(";")
+		}
+	case *ast.ImplStatement:
+		pr.impl(stmt)
+	case *ast.BlockStatement:
+		pr.block(stmt)
+	}
+}
+
+// simpleStatement prints a let or reassignment statement without the
+// semicolon, which the clauses of a for loop are separated by instead
+func (pr *printer) simpleStatement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		pr.write("let ")
+
+		if stmt.Mutable {
+			pr.write("mut ")
+		}
+
+		if stmt.Pattern != nil {
+			pr.pattern(stmt.Pattern)
+		} else {
+			pr.write(stmt.Name.Value)
+		}
+
+		pr.write(" = ")
+		pr.expression(stmt.Value)
+	case *ast.ReassignmentStatement:
+		pr.expression(stmt.Target)
+		pr.write(" " + stmt.Token.Literal + " ")
+		pr.expression(stmt.Value)
+	case *ast.ExpressionStatement:
+		pr.expression(stmt.Expression)
+	}
+}
+
+// parameters prints the parameter list of a function in parentheses
+func (pr *printer) parameters(fn *ast.FunctionLiteral) {
+	pr.write("(")
+
+	for i, param := range fn.Parameters {
+		if i > 0 {
+			pr.write(", ")
+		}
+
+		if pattern := fn.Pattern(i); pattern != nil {
+			pr.pattern(pattern)
+		} else {
+			pr.write(param.Value)
+		}
+
+		if def := fn.Default(i); def != nil {
+			pr.write(" = ")
+			pr.expression(def)
+		}
+	}
+
+	if fn.Rest != nil {
+		if len(fn.Parameters) > 0 {
+			pr.write(", ")
+		}
+
+		pr.write("..." + fn.Rest.Value)
+	}
+
+	pr.write(")")
+}
+
+// impl prints the methods of an impl block one after another, separated by
+// blank lines
+func (pr *printer) impl(stmt *ast.ImplStatement) {
+	pr.write("impl " + stmt.Name.Value + " {")
+
+	if len(stmt.Methods) == 0 {
+		pr.write("}")
+		return
+	}
+
+	pr.write("\n")
+	pr.indent += 1
+
+	for i, method := range stmt.Methods {
+		if i > 0 {
+			pr.write("\n")
+		}
+
+		first := true
+		pr.commentsBefore(method.Pos(), &first)
+		pr.writeIndent()
+		pr.write("fn " + method.Name)
+		pr.parameters(method)
+		pr.write(" ")
+		pr.block(method.Body)
+		pr.write("\n")
+	}
+
+	pr.indent -= 1
+	pr.writeIndent()
+	pr.write("}")
+}
+
+// block prints a block over multiple lines, unless it was written on a single
+// line in the source and holds no more than one short statement
+func (pr *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 && !pr.hasCommentsBetween(block.Token.Pos, block.End) {
+		pr.write("{}")
+		return
+	}
+
+	if len(block.Statements) == 1 && block.Token.Pos.Line == block.End.Line &&
+		!pr.hasCommentsBetween(block.Token.Pos, block.End) {
+		single := pr.sub()
+		single.statement(block.Statements[0])
+
+		if line := single.buf.String(); !strings.Contains(line, "\n") {
+			pr.write("{ " + line + " }")
+			return
+		}
+	}
+
+	pr.write("{\n")
+	pr.indent += 1
+	pr.statements(block.Statements, block.End)
+	pr.indent -= 1
+	pr.writeIndent()
+	pr.write("}")
+}
+
+func (pr *printer) expression(exp ast.Expression) {
+	// Block comments stay in front of the expression they were written before.
+	// Line comments would swallow the rest of the line, so they are left for
+	// after the statement.
+	start := expressionStart(exp)
+
+	for len(pr.comments) > 0 && before(pr.comments[0].Pos, start) &&
+		strings.HasPrefix(pr.comments[0].Literal, "/*") {
+		pr.write(pr.comments[0].Literal + " ")
+		pr.comments = pr.comments[1:]
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		pr.write(exp.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.Boolean, *ast.DollarLiteral:
+		pr.write(exp.TokenLiteral())
+	case *ast.StringLiteral:
+		if exp.Token.Type == token.RAW_STRING {
+			pr.write("`" + exp.Value + "`")
+		} else {
+			pr.write(quote(exp.Value))
+		}
+	case *ast.InterpolatedString:
+		pr.write(`"`)
+
+		for _, part := range exp.Parts {
+			if sl, ok := part.(*ast.StringLiteral); ok && sl.Token.Type == token.TEMPLATE {
+				pr.write(escape(sl.Value))
+				continue
+			}
+
+			pr.write("${")
+			pr.expression(part)
+			pr.write("}")
+		}
+
+		pr.write(`"`)
+	case *ast.ArrayLiteral:
+		if len(exp.Elements) > 0 && pr.lineBreakAfter(exp.Token.Pos) {
+			pr.elements("[", "]", exp.Elements, exp.End, func(i int) {
+				pr.expression(exp.Elements[i])
+			})
+			return
+		}
+
+		pr.write("[")
+		pr.list(exp.Elements)
+		pr.write("]")
+	case *ast.HashLiteral:
+		if len(exp.Keys) > 0 && pr.lineBreakAfter(exp.Token.Pos) {
+			pr.elements("{", "}", exp.Keys, exp.End, func(i int) {
+				pr.expression(exp.Keys[i])
+				pr.write(": ")
+				pr.expression(exp.Pairs[exp.Keys[i]])
+			})
+			return
+		}
+
+		pr.write("{")
+
+		for i, key := range exp.Keys {
+			if i > 0 {
+				pr.write(", ")
+			}
+
+			pr.expression(key)
+			pr.write(": ")
+			pr.expression(exp.Pairs[key])
+		}
+
+		pr.write("}")
+	case *ast.PrefixExpression:
+		pr.write(exp.Operator)
+		pr.operand(exp.Right, parser.PREFIX, false)
+	case *ast.InfixExpression:
+		precedence := parser.Precedence(exp.Token.Type)
+
+		// ** is right-associative, so it is its left operand that needs
+		// parentheses at equal precedence
+		rightAssoc := exp.Token.Type == token.POWER
+
+		pr.operand(exp.Left, precedence, rightAssoc)
+
+		// Ranges are written without spaces, eg. 0..10
+		if precedence == parser.RANGE {
+			pr.write(exp.Operator)
+		} else {
+			pr.write(" " + exp.Operator + " ")
+		}
+
+		pr.operand(exp.Right, precedence, !rightAssoc)
+	case *ast.IfExpression:
+		pr.write("if (")
+		pr.expression(exp.Condition)
+		pr.write(") ")
+		pr.block(exp.Consequence)
+
+		if exp.IsElseIf() {
+			pr.write(" else ")
+			pr.statement(exp.Alternative.Statements[0])
+		} else if exp.Alternative != nil {
+			pr.write(" else ")
+			pr.block(exp.Alternative)
+		}
+	case *ast.TryExpression:
+		pr.write("try ")
+		pr.block(exp.Body)
+
+		if exp.Catch != nil {
+			pr.write(" catch (" + exp.Param.Value + ") ")
+			pr.block(exp.Catch)
+		}
+
+		if exp.Finally != nil {
+			pr.write(" finally ")
+			pr.block(exp.Finally)
+		}
+	case *ast.MatchExpression:
+		pr.write("match ")
+		pr.expression(exp.Subject)
+
+		if len(exp.Arms) == 0 {
+			pr.write(" {}")
+			return
+		}
+
+		pr.write(" {\n")
+		pr.indent += 1
+
+		for _, arm := range exp.Arms {
+			pr.writeIndent()
+			pr.pattern(arm.Pattern)
+
+			if arm.Guard != nil {
+				pr.write(" if ")
+				pr.expression(arm.Guard)
+			}
+
+			pr.write(" => ")
+
+			// Expression bodies are held by a block starting at the expression
+			if arm.Body.Token.Type == token.LCURLY {
+				pr.block(arm.Body)
+			} else {
+				pr.simpleStatement(arm.Body.Statements[0])
+				pr.write(",")
+			}
+
+			pr.write("\n")
+		}
+
+		pr.indent -= 1
+		pr.writeIndent()
+		pr.write("}")
+	case *ast.ForExpression:
+		if exp.Label != nil {
+			pr.write(exp.Label.Value + ": ")
+		}
+
+		pr.write("for (")
+
+		if exp.IsThreeClause() {
+			if exp.Init != nil {
+				pr.simpleStatement(exp.Init)
+			}
+
+			pr.write(";")
+
+			if exp.Condition != nil {
+				pr.write(" ")
+				pr.expression(exp.Condition)
+			}
+
+			pr.write(";")
+
+			if exp.Post != nil {
+				pr.write(" ")
+				pr.simpleStatement(exp.Post)
+			}
+		} else {
+			pr.expression(exp.Condition)
+		}
+
+		pr.write(") ")
+		pr.block(exp.Body)
+	case *ast.ForInExpression:
+		if exp.Label != nil {
+			pr.write(exp.Label.Value + ": ")
+		}
+
+		pr.write("for (")
+
+		if exp.Key != nil {
+			pr.write(exp.Key.Value + ", ")
+		}
+
+		pr.write(exp.Value.Value + " in ")
+		pr.expression(exp.Iterable)
+		pr.write(") ")
+		pr.block(exp.Body)
+	case *ast.FunctionLiteral:
+		pr.write("fn")
+		pr.parameters(exp)
+		pr.write(" ")
+		pr.block(exp.Body)
+	case *ast.IndexExpression:
+		pr.operand(exp.Left, parser.INDEX, false)
+
+		if exp.Token.Type == token.PERIOD {
+			pr.write(".")
+			pr.dotIndex(exp.Index)
+		} else {
+			pr.write("[")
+			pr.expression(exp.Index)
+			pr.write("]")
+		}
+	case *ast.SliceExpression:
+		pr.operand(exp.Left, parser.INDEX, false)
+		pr.write("[")
+
+		if exp.Start != nil {
+			pr.expression(exp.Start)
+		}
+
+		pr.write(":")
+
+		if exp.End != nil {
+			pr.expression(exp.End)
+		}
+
+		if exp.Step != nil {
+			pr.write(":")
+			pr.expression(exp.Step)
+		}
+
+		pr.write("]")
+	case *ast.CallExpression:
+		pr.call(exp)
+	case *ast.NamedArgument:
+		pr.write(exp.Name.Value + ": ")
+		pr.expression(exp.Value)
+	}
+}
+
+func (pr *printer) call(exp *ast.CallExpression) {
+	switch exp.Token.Type {
+	case token.PERIOD:
+		// Dot calls take the receiver as their first argument
+		pr.operand(exp.Arguments[0], parser.INDEX, false)
+		pr.write(".")
+		pr.expression(exp.Function)
+		pr.write("(")
+		pr.list(exp.Arguments[1:])
+		pr.write(")")
+	case token.PIPE:
+		pr.operand(exp.Piped, parser.PIPE, false)
+		pr.write(" |> ")
+		pr.operand(exp.Function, parser.PIPE, true)
+		pr.write("(")
+
+		for i, arg := range exp.Arguments {
+			if i > 0 {
+				pr.write(", ")
+			}
+
+			if named, ok := arg.(*ast.NamedArgument); ok {
+				pr.write(named.Name.Value + ": ")
+				arg = named.Value
+			}
+
+			if arg == exp.Piped {
+				pr.write("$")
+			} else {
+				pr.expression(arg)
+			}
+		}
+
+		pr.write(")")
+	default:
+		pr.operand(exp.Function, parser.CALL, false)
+		pr.write("(")
+		pr.list(exp.Arguments)
+		pr.write(")")
+	}
+}
+
+func (pr *printer) pattern(pattern ast.Pattern) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		pr.write(pattern.Value)
+	case *ast.LiteralPattern:
+		pr.expression(pattern.Value)
+	case *ast.ArrayPattern:
+		pr.write("[")
+
+		for i, el := range pattern.Elements {
+			if i > 0 {
+				pr.write(", ")
+			}
+
+			pr.pattern(el)
+		}
+
+		if pattern.Rest != nil {
+			if len(pattern.Elements) > 0 {
+				pr.write(", ")
+			}
+
+			pr.write("..." + pattern.Rest.Value)
+		}
+
+		pr.write("]")
+	case *ast.HashPattern:
+		pr.write("{")
+
+		for i, key := range pattern.Keys {
+			if i > 0 {
+				pr.write(", ")
+			}
+
+			pr.expression(key)
+			pr.write(": ")
+			pr.pattern(pattern.Values[i])
+		}
+
+		pr.write("}")
+	}
+}
+
+func (pr *printer) list(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			pr.write(", ")
+		}
+
+		pr.expression(exp)
+	}
+}
+
+// elements prints the elements of a literal one per line between open and
+// close, calling element to print each of them. The elements are given by
+// the expressions they start with, and end is the position of close, which
+// place the comments inside the literal.
+func (pr *printer) elements(open, close string, starts []ast.Expression, end token.Position, element func(i int)) {
+	pr.write(open + "\n")
+	pr.indent += 1
+
+	for i := range starts {
+		first := true
+		pr.commentsBefore(expressionStart(starts[i]), &first)
+		pr.writeIndent()
+		element(i)
+
+		next := end
+
+		if i+1 < len(starts) {
+			pr.write(",")
+			next = expressionStart(starts[i+1])
+		}
+
+		pr.trailingComment(next)
+		pr.write("\n")
+	}
+
+	first := true
+	pr.commentsBefore(end, &first)
+	pr.indent -= 1
+	pr.writeIndent()
+	pr.write(close)
+}
+
+// operand prints exp as an operand of an operator binding with precedence,
+// adding parentheses where they are needed to parse back into the same tree.
+// Most operators are left-associative, so the right operand of an operator
+// also needs them at equal precedence, which is what right is for.
+func (pr *printer) operand(exp ast.Expression, precedence int, right bool) {
+	own := expressionPrecedence(exp)
+
+	if own < precedence || right && own == precedence || isDotIndex(exp) {
+		pr.write("(")
+		pr.expression(exp)
+		pr.write(")")
+		return
+	}
+
+	pr.expression(exp)
+}
+
+// dotIndex prints the index of a dot expression. Apart from field names, the
+// index of a dot is parsed as a whole expression, eg. `a.1 + 1` indexes a
+// with 1 + 1, so anything but simple operands is wrapped in parentheses.
+func (pr *printer) dotIndex(exp ast.Expression) {
+	switch exp.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean, *ast.PrefixExpression:
+		pr.expression(exp)
+	default:
+		pr.write("(")
+		pr.expression(exp)
+		pr.write(")")
+	}
+}
+
+// expressionPrecedence returns how tightly exp binds as an operand, with
+// literals and other self-contained expressions binding the tightest
+func expressionPrecedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		if exp.Token.Type == token.PIPE {
+			return parser.PIPE
+		}
+	}
+
+	return parser.INDEX + 1
+}
+
+// isDotIndex reports whether exp is a dot index expression other than a field
+// access, eg. `a.1`. Since the index swallows everything after the dot, these
+// need parentheses whenever anything follows them.
+func isDotIndex(exp ast.Expression) bool {
+	index, ok := exp.(*ast.IndexExpression)
+
+	if !ok || index.Token.Type != token.PERIOD {
+		return false
+	}
+
+	_, isField := index.Field()
+
+	return !isField
+}
+
+// expressionStart returns the position of the first token of exp, which for
+// operators and calls is in their leftmost operand
+func expressionStart(exp ast.Expression) token.Position {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return expressionStart(exp.Left)
+	case *ast.IndexExpression:
+		return expressionStart(exp.Left)
+	case *ast.SliceExpression:
+		return expressionStart(exp.Left)
+	case *ast.CallExpression:
+		switch exp.Token.Type {
+		case token.PERIOD:
+			return expressionStart(exp.Arguments[0])
+		case token.PIPE:
+			return expressionStart(exp.Piped)
+		}
+
+		return expressionStart(exp.Function)
+	}
+
+	return exp.Pos()
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func endLine(tok token.Token) int {
+	// Double quoted strings never span lines, newlines in their literal come
+	// from escape sequences
+	if tok.Type == token.STRING || tok.Type == token.TEMPLATE {
+		return tok.Pos.Line
+	}
+
+	return tok.Pos.Line + strings.Count(tok.Literal, "\n")
+}
+
+// quote returns s as a double quoted string literal
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
+
+// escape escapes the characters of s that cannot appear as is in a double
+// quoted string literal
+func escape(s string) string {
+	var out strings.Builder
+
+	for i, r := range s {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '$' && strings.HasPrefix(s[i+1:], "{"):
+			out.WriteString(`\$`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&out, "\\u{%x}", r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
+
+func startPos(stmt ast.Statement) token.Position {
+	if stmt, ok := stmt.(*ast.ReassignmentStatement); ok {
+		return stmt.Root().Token.Pos
+	}
+
+	return stmt.Pos()
+}
@@ -0,0 +1,263 @@
+package formatter
+
+import (
+	"dodo-lang/lexer"
+	"dodo-lang/parser"
+	"os"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=5", "let x = 5;\n"},
+		{"let mut x = 5; x = x+1", "let mut x = 5;\nx = x + 1;\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;", "let a = 1;\n\nlet b = 2;\nlet c = 3;\n"},
+		{"return 1", "return 1;\n"},
+		{`import "lib/math.dodo"`, "import \"lib/math.dodo\";\n"},
+		{"import math", "import math;\n"},
+		{"1 + 2 * 3", "1 + 2 * 3;\n"},
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"((1 + 2)) + 3", "1 + 2 + 3;\n"},
+		{"1 - (2 - 3)", "1 - (2 - 3);\n"},
+		{"-(1 + 2)", "-(1 + 2);\n"},
+		{"!true == false", "!true == false;\n"},
+		{"3.14*2", "3.14 * 2;\n"},
+		{`[1,2,  "three"]`, "[1, 2, \"three\"];\n"},
+		{`{"b":2,"a":1, true: 3}`, "{\"b\": 2, \"a\": 1, true: 3};\n"},
+		{"add(1,2)", "add(1, 2);\n"},
+		{"a&&b||c<=d", "a && b || c <= d;\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"2**3**2", "2 ** 3 ** 2;\n"},
+		{"(2 ** 3) ** 2", "(2 ** 3) ** 2;\n"},
+		{"(-2) ** 2 % 3", "(-2) ** 2 % 3;\n"},
+		{`"sum is ${ sum(xs)+1 }"`, "\"sum is ${sum(xs) + 1}\";\n"},
+		{`"\${x} \t${"a"}"`, "\"\\${x} \\t${\"a\"}\";\n"},
+		{"arr[1+1]", "arr[1 + 1];\n"},
+		{"arr.0", "arr.0;\n"},
+		{"(arr.0) + (arr.1)", "(arr.0) + (arr.1);\n"},
+		{"barfoo.4 + 3", "barfoo.(4 + 3);\n"},
+		{"a.b.c", "a.b.c;\n"},
+		{"a.b+1", "a.b + 1;\n"},
+		{"a.(b.c)", "a.(b.c);\n"},
+		{"struct Person {name,age,}", "struct Person { name, age }\n"},
+		{"struct Empty {}", "struct Empty {}\n"},
+		{"enum Shape {Circle(r),Rect(w,h),Empty,}", "enum Shape { Circle(r), Rect(w, h), Empty }\n"},
+		{
+			"impl Person { fn greet(self,g=1) { g }\nfn age(self) { let a = self.age; a } }",
+			"impl Person {\n  fn greet(self, g = 1) { g; }\n\n  fn age(self) {\n    let a = self.age;\n    a;\n  }\n}\n",
+		},
+		{"try{f()}catch(e){g(e)}", "try { f(); } catch (e) { g(e); }\n"},
+		{
+			"let x = try { f() } finally {\nclose()\n}",
+			"let x = try { f(); } finally {\n  close();\n};\n",
+		},
+		{"throw error(\"no\",e)", "throw error(\"no\", e);\n"},
+		{"arr.len()", "arr.len();\n"},
+		{"[1, 2].push(3)", "[1, 2].push(3);\n"},
+		{"(1 + 2).len()", "(1 + 2).len();\n"},
+		{"5 |> add(10, $)", "5 |> add(10, $);\n"},
+		{"sub(10, 3) |> add($, 10)", "sub(10, 3) |> add($, 10);\n"},
+		{"(1 + 2) |> add($, 10)", "(1 + 2) |> add($, 10);\n"},
+		{"let f = fn(x, y) { x + y }", "let f = fn(x, y) { x + y; };\n"},
+		{"let f = fn() {}", "let f = fn() {};\n"},
+		{"fn(x) { x }(5)", "fn(x) { x; }(5);\n"},
+		{"let f = fn(x, y=x*2, ...rest) {}", "let f = fn(x, y = x * 2, ...rest) {};\n"},
+		{"let f = fn( ...args ) {}", "let f = fn(...args) {};\n"},
+		{"let mut [a,_,...rest]=xs", "let mut [a, _, ...rest] = xs;\n"},
+		{`let {"name":n}=p`, "let {\"name\": n} = p;\n"},
+		{"let f = fn([x,y], {\"k\":v}=m) {}", "let f = fn([x, y], {\"k\": v} = m) {};\n"},
+		{"greet(\"Ada\", greeting:\"Hi\")", "greet(\"Ada\", greeting: \"Hi\");\n"},
+		{"5 |> add(10, y:$)", "5 |> add(10, y: $);\n"},
+		{"let f = fn(x) { let y = x; y }", "let f = fn(x) {\n  let y = x;\n  y;\n};\n"},
+		{"let f = fn(x) {\nx\n}", "let f = fn(x) {\n  x;\n};\n"},
+		{
+			"if (x > 1) { return 1 } else { return 2 }",
+			"if (x > 1) { return 1; } else { return 2; }\n",
+		},
+		{
+			"if (x > 1) {\nlet y = 1;\n\n\ny\n} else {\n2\n}",
+			"if (x > 1) {\n  let y = 1;\n\n  y;\n} else {\n  2;\n}\n",
+		},
+		{
+			"for (count < 10) {\ncount = count + 1;\n}",
+			"for (count < 10) {\n  count = count + 1;\n}\n",
+		},
+		{"for (let mut i=0;i<3;i=i+1) { x }", "for (let mut i = 0; i < 3; i = i + 1) { x; }\n"},
+		{"for (;;) {}", "for (;;) {}\n"},
+		{"if (a) { 1 } else if (b) { 2 } else { 3 }", "if (a) { 1; } else if (b) { 2; } else { 3; }\n"},
+		{"if (a) { 1 } else { if (b) { 2 } }", "if (a) { 1; } else { if (b) { 2; } }\n"},
+		{
+			"match x { 0=>\"zero\", -1 => 1,[a,...rest] if a>1 => a, {\"k\":v} => { v } _ => 0 }",
+			"match x {\n  0 => \"zero\",\n  -1 => 1,\n  [a, ...rest] if a > 1 => a,\n  {\"k\": v} => { v; }\n  _ => 0,\n}\n",
+		},
+		{"let y = match x {}", "let y = match x {};\n"},
+		{"for (x in [1,2]) { x }", "for (x in [1, 2]) { x; }\n"},
+		{"for (i in 0 .. n+1) {}", "for (i in 0..n + 1) {}\n"},
+		{"arr[ i ][0]+=1; m.key = 2", "arr[i][0] += 1;\nm.key = 2;\n"},
+		{"for (let mut i=0;i<3;i*=2) {}", "for (let mut i = 0; i < 3; i *= 2) {}\n"},
+		{"let r = (0..=10)", "let r = 0..=10;\n"},
+		{"a[ 1 : n-1 ]; a[::-1]; a[:]", "a[1:n - 1];\na[::-1];\na[:];\n"},
+		{"outer: for (k,v in m) { break outer }", "outer: for (k, v in m) { break outer; }\n"},
+		{
+			"outer :for (a) {\nfor (b) { if (c) { continue outer } else { break } }\n}",
+			"outer: for (a) {\n  for (b) { if (c) { continue outer; } else { break; } }\n}\n",
+		},
+		{
+			"let f = fn(x) {\n  if (x) {\n    for (x) {\n      x = 1;\n    }\n  }\n}",
+			"let f = fn(x) {\n  if (x) {\n    for (x) {\n      x = 1;\n    }\n  }\n};\n",
+		},
+		{`"tab\there \"quoted\" \\ \u{e9}"`, "\"tab\\there \\\"quoted\\\" \\\\ é\";\n"},
+		{`"bell \u{7}"`, "\"bell \\u{7}\";\n"},
+		{"let s = `raw \\n\n  multi`;\n\nlet x = 1;", "let s = `raw \\n\n  multi`;\n\nlet x = 1;\n"},
+		{"let s = `a\nb`;\nlet x = 1;", "let s = `a\nb`;\nlet x = 1;\n"},
+		{"// leading\nlet x = 1;", "// leading\nlet x = 1;\n"},
+		{"let x = 1;   // trailing\nlet y = 2;", "let x = 1; // trailing\nlet y = 2;\n"},
+		{"let x = 1;\n\n\n// spaced\n\nlet y = 2;", "let x = 1;\n\n// spaced\n\nlet y = 2;\n"},
+		{"/* a\n   b */\nlet x = 1;", "/* a\n   b */\nlet x = 1;\n"},
+		{
+			"let f = fn() {\n\n    // first\n    1 // one\n  // last\n}",
+			"let f = fn() {\n  // first\n  1; // one\n  // last\n};\n",
+		},
+		{"let f = fn() { /* empty */ }", "let f = fn() {\n  /* empty */\n};\n"},
+		{"let f = fn() { 1 } // same line\nf()", "let f = fn() { 1; }; // same line\nf();\n"},
+		{"let a = [\n  1, // one\n  2\n];", "let a = [\n  1, // one\n  2\n];\n"},
+		{
+			"let m = {\n \"a\": 1, // first\n \"b\": 2\n};",
+			"let m = {\n  \"a\": 1, // first\n  \"b\": 2\n};\n",
+		},
+		{
+			"let m = { // numbers\n\n// one\n1: [\n2 // two\n],\n\n/* three */ 3: 3 /* 3 */\n// end\n}",
+			"let m = {\n  // numbers\n\n  // one\n  1: [\n    2 // two\n  ],\n  /* three */\n  3: 3 /* 3 */\n  // end\n};\n",
+		},
+		{"let x = /* c */ 1;", "let x = /* c */ 1;\n"},
+		{"let x = 1 + /* c */ 2 * /* d */ f(/* e */ 3)", "let x = 1 + /* c */ 2 * /* d */ f(/* e */ 3);\n"},
+		{"let x = /* c */ xs[0] |> f($)", "let x = /* c */ xs[0] |> f($);\n"},
+		{"let x = f(1, // one\n2)", "let x = f(1, 2);\n// one\n"},
+		{"let a = [1,\n2]", "let a = [1, 2];\n"},
+		{"let a = [\n1, [2,\n3], [\n4]\n]", "let a = [\n  1,\n  [2, 3],\n  [\n    4\n  ]\n];\n"},
+		{"let a = [\n]", "let a = [];\n"},
+		{
+			"let f = fn() {\nlet m = {\n\"a\":1, \"b\": [\n2],\n};\n}",
+			"let f = fn() {\n  let m = {\n    \"a\": 1,\n    \"b\": [\n      2\n    ]\n  };\n};\n",
+		},
+		{"if (x) { [\n1] }", "if (x) {\n  [\n    1\n  ];\n}\n"},
+		{"let x = 1;\n// end of file", "let x = 1;\n// end of file\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Format(tt.input)
+
+		if err != nil {
+			t.Errorf("unexpected error formatting %q: %s", tt.input, err)
+			continue
+		}
+
+		if formatted != tt.expected {
+			t.Errorf("wrong output for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, formatted)
+			continue
+		}
+
+		testIdempotent(t, formatted)
+		testSameProgram(t, tt.input, formatted)
+	}
+}
+
+func TestFormatExample(t *testing.T) {
+	src, err := os.ReadFile("../examples/example.dodo")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	formatted, err := Format(string(src))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	testIdempotent(t, formatted)
+	testSameProgram(t, string(src), formatted)
+}
+
+func TestFormatParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = ;", "1:9: no prefix parse function for ; found"},
+		{"let x = 1; /* open", "1:12: unterminated block comment"},
+	}
+
+	for _, tt := range tests {
+		_, err := Format(tt.input)
+
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	after := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+
+	expected := `--- test.dodo.orig
++++ test.dodo
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+
+	if diff := Diff("test.dodo", before, after); diff != expected {
+		t.Errorf("wrong diff.\nexpected=%q\ngot=%q", expected, diff)
+	}
+
+	if diff := Diff("test.dodo", before, before); diff != "" {
+		t.Errorf("expected no diff for equal input. got=%q", diff)
+	}
+}
+
+func testIdempotent(t *testing.T, formatted string) {
+	t.Helper()
+
+	again, err := Format(formatted)
+
+	if err != nil {
+		t.Errorf("formatted source does not parse: %s", err)
+		return
+	}
+
+	if again != formatted {
+		t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", formatted, again)
+	}
+}
+
+// testSameProgram checks that formatting did not change what the source
+// means, by comparing the parsed programs
+func testSameProgram(t *testing.T, input, formatted string) {
+	t.Helper()
+
+	expected := parser.New(lexer.New(input)).ParseProgram().String()
+	got := parser.New(lexer.New(formatted)).ParseProgram().String()
+
+	if expected != got {
+		t.Errorf("formatting changed the program.\nexpected=%q\ngot=%q", expected, got)
+	}
+}
@@ -2,54 +2,110 @@ package lexer
 
 import (
 	"dodo-lang/token"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // current position in the input / pointer to current char
 	readPosition int  // current reading position (one char forward) / peeking position
-	ch           byte // char currently being read
+	ch           rune // char currently being read, decoded from UTF-8
+	line         int  // line of the current char
+	column       int  // column of the current char, counted in chars rather than bytes
+
+	comments []token.Token // Comments skipped so far, kept as trivia for tooling
+	errors   []Error
+}
+
+// Error is a problem found while reading the input, eg. an unterminated
+// comment
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a lexer whose token positions are attributed to filename
+func NewFile(filename string, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+
+	l.column += 1
+
+	l.position = l.readPosition
+
 	if l.readPosition >= len(l.input) {
 		// 0 = ASCII "NUL"
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.readPosition += 1
+		return
 	}
 
-	l.position = l.readPosition
-	l.readPosition += 1
+	ch, size := utf8.DecodeRuneInString(l.input[l.readPosition:])
+
+	if ch == utf8.RuneError && size == 1 {
+		l.addError(l.currentPosition(), "invalid UTF-8 encoding")
+	}
+
+	l.ch = ch
+	l.readPosition += size
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+
+	return ch
+}
+
+// Comments returns the comments read so far as COMMENT tokens, including
+// their delimiters
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Errors returns the errors found so far
+func (l *Lexer) Errors() []Error {
+	return l.errors
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	l.skipWhitespaceAndComments()
+
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal}
+			tok = l.twoCharToken(token.EQ)
+		} else if l.peekChar() == '>' {
+			tok = l.twoCharToken(token.FAT_ARROW)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -73,37 +129,85 @@ func (l *Lexer) NextToken() token.Token {
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '.':
-		tok = newToken(token.PERIOD, l.ch)
+		if l.peekChar() == '.' {
+			tok = l.twoCharToken(token.RANGE)
+
+			if l.peekChar() == '=' {
+				l.readChar()
+				tok = token.Token{Type: token.RANGE_INCLUSIVE, Literal: "..="}
+			} else if l.peekChar() == '.' {
+				l.readChar()
+				tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+			}
+		} else {
+			tok = newToken(token.PERIOD, l.ch)
+		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.PLUS_ASSIGN)
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.MINUS_ASSIGN)
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		switch l.peekChar() {
+		case '*':
+			tok = l.twoCharToken(token.POWER)
+		case '=':
+			tok = l.twoCharToken(token.ASTERISK_ASSIGN)
+		default:
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.SLASH_ASSIGN)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.LT_EQ)
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.twoCharToken(token.GT_EQ)
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.twoCharToken(token.AND)
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal, tok.Type = l.readString(pos)
+	case '`':
+		tok.Type = token.RAW_STRING
+		tok.Literal = l.readRawString(pos)
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal}
+			tok = l.twoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '|':
-		if l.peekChar() == '>' {
-			ch := l.ch
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.PIPE, Literal: literal}
+		switch l.peekChar() {
+		case '>':
+			tok = l.twoCharToken(token.PIPE)
+		case '|':
+			tok = l.twoCharToken(token.OR)
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	case '$':
 		tok = newToken(token.DOLLAR, l.ch)
@@ -114,10 +218,11 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -125,15 +230,88 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
+
 	return tok
 }
 
+// twoCharToken reads the next char as the second half of an operator like ==
+func (l *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
 	}
 }
 
+func (l *Lexer) skipWhitespaceAndComments() {
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return
+		}
+
+		pos := l.currentPosition()
+		position := l.position
+
+		if l.peekChar() == '/' {
+			l.skipLineComment()
+		} else {
+			l.skipBlockComment(pos)
+		}
+
+		l.comments = append(l.comments, token.Token{
+			Type:    token.COMMENT,
+			Literal: l.input[position:l.position],
+			Pos:     pos,
+		})
+	}
+}
+
+// skipLineComment skips a // comment up to, but not including, the newline
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a /* */ comment. Block comments nest, so that code
+// containing comments can be commented out as a whole.
+func (l *Lexer) skipBlockComment(start token.Position) {
+	depth := 0
+
+	for {
+		switch {
+		case l.ch == 0:
+			l.addError(start, "unterminated block comment")
+			return
+		case l.ch == '/' && l.peekChar() == '*':
+			depth += 1
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth -= 1
+			l.readChar()
+
+			if depth == 0 {
+				l.readChar()
+				return
+			}
+		}
+
+		l.readChar()
+	}
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 
@@ -144,22 +322,261 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or, when the digits are followed by a period
+// and another digit, a float. Requiring a digit after the period keeps dot
+// syntax on numbers (eg. `1.len`) lexing as before.
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
 
 	for isDigit(l.ch) {
 		l.readChar()
 	}
 
-	return l.input[position:l.position]
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
 }
 
-func (l *Lexer) readString() string {
+// readString reads a double quoted string, decoding its escape sequences.
+// The string has to end on the line it starts on, use a raw string for text
+// spanning multiple lines.
+//
+// A string embedding expressions with ${...} is read as a TEMPLATE, whose
+// literal is the source between the quotes, split up by SplitTemplate.
+func (l *Lexer) readString(start token.Position) (string, token.TokenType) {
+	var out strings.Builder
+
 	position := l.position + 1
+	tokenType := token.TokenType(token.STRING)
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case '"':
+			if tokenType == token.TEMPLATE {
+				return l.input[position:l.position], tokenType
+			}
+
+			return out.String(), tokenType
+		case '\n', 0:
+			l.addError(start, "unterminated string")
+
+			if tokenType == token.TEMPLATE {
+				return l.input[position:l.position], tokenType
+			}
+
+			return out.String(), tokenType
+		case '\\':
+			l.readEscape(&out)
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				continue
+			}
+
+			tokenType = token.TEMPLATE
+			l.readChar()
+			l.skipInterpolation()
+
+			if l.ch != '}' {
+				l.addError(start, "unterminated string")
+				return l.input[position:l.position], tokenType
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// skipInterpolation skips from the { of an embedded ${...} expression to its
+// closing }, stepping over nested braces and strings. It stops early at the
+// end of the line or input, leaving the current char there.
+func (l *Lexer) skipInterpolation() {
+	depth := 1
 
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+
+		switch l.ch {
+		case '\n', 0:
+			return
+		case '{':
+			depth += 1
+		case '}':
+			depth -= 1
+
+			if depth == 0 {
+				return
+			}
+		case '"':
+			l.readString(l.currentPosition())
+
+			if l.ch != '"' {
+				return
+			}
+		case '`':
+			l.readRawString(l.currentPosition())
+
+			if l.ch != '`' {
+				return
+			}
+		}
+	}
+}
+
+// TemplatePart is either literal text or an embedded expression of a
+// template string
+type TemplatePart struct {
+	Text         string // Literal text, with escape sequences decoded
+	Expression   string // Source of the embedded expression, between ${ and }
+	IsExpression bool
+	Pos          token.Position // Where the part starts in the source
+}
+
+// SplitTemplate splits a TEMPLATE token into its literal and expression
+// parts. Errors in the template are reported when it is first lexed, so they
+// are not reported again.
+func SplitTemplate(tok token.Token) []TemplatePart {
+	// Lex the literal as if it were at its place in the source, just after
+	// the opening quote
+	l := &Lexer{input: tok.Literal, filename: tok.Pos.Filename, line: tok.Pos.Line, column: tok.Pos.Column}
+	l.readChar()
+
+	var parts []TemplatePart
+	var out strings.Builder
+	textPos := l.currentPosition()
+
+	for l.ch != 0 {
+		switch {
+		case l.ch == '\\':
+			l.readEscape(&out)
+		case l.ch == '$' && l.peekChar() == '{':
+			if out.Len() > 0 {
+				parts = append(parts, TemplatePart{Text: out.String(), Pos: textPos})
+				out.Reset()
+			}
+
+			l.readChar()
+			pos := l.currentPosition()
+			pos.Column += 1
+			start := l.position + 1
+
+			l.skipInterpolation()
+
+			parts = append(parts, TemplatePart{Expression: l.input[start:l.position], IsExpression: true, Pos: pos})
+			textPos = l.currentPosition()
+			textPos.Column += 1
+		default:
+			out.WriteRune(l.ch)
+		}
+
+		l.readChar()
+	}
+
+	if out.Len() > 0 {
+		parts = append(parts, TemplatePart{Text: out.String(), Pos: textPos})
+	}
+
+	return parts
+}
+
+// NewAt creates a lexer for input found at pos in a larger source, eg. an
+// expression embedded in a template string, so its tokens have positions in
+// that source
+func NewAt(input string, pos token.Position) *Lexer {
+	l := &Lexer{input: input, filename: pos.Filename, line: pos.Line, column: pos.Column - 1}
+	l.readChar()
+
+	return l
+}
+
+// readEscape decodes the escape sequence starting at the current backslash
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.currentPosition()
+
+	switch l.peekChar() {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\':
+		out.WriteByte('\\')
+	case '"':
+		out.WriteByte('"')
+	case '$':
+		out.WriteByte('$')
+	case 'u':
+		l.readChar()
+		l.readUnicodeEscape(pos, out)
+		return
+	case '\n', 0:
+		// Leave the end of the line or input to readString
+		l.addError(pos, "unknown escape sequence")
+		return
+	default:
+		l.addError(pos, "unknown escape sequence \\%c", l.peekChar())
+	}
+
+	l.readChar()
+}
+
+// readUnicodeEscape decodes \u{...}, holding the hex code point of a character
+func (l *Lexer) readUnicodeEscape(pos token.Position, out *strings.Builder) {
+	if l.peekChar() != '{' {
+		l.addError(pos, "invalid unicode escape, expected \\u{...}")
+		return
+	}
+
+	l.readChar()
+
+	var digits strings.Builder
+
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		digits.WriteRune(l.ch)
+	}
+
+	if l.peekChar() != '}' {
+		l.addError(pos, "invalid unicode escape, expected \\u{...}")
+		return
+	}
+
+	l.readChar()
+
+	value, err := strconv.ParseUint(digits.String(), 16, 32)
+
+	if err != nil || digits.Len() > 6 || !utf8.ValidRune(rune(value)) {
+		l.addError(pos, "invalid unicode code point %q", digits.String())
+		return
+	}
+
+	out.WriteRune(rune(value))
+}
+
+// readRawString reads a backtick quoted string as is, including newlines
+func (l *Lexer) readRawString(start token.Position) string {
+	position := l.position + 1
+
+	for {
+		l.readChar()
+
+		if l.ch == '`' {
+			break
+		}
+
+		if l.ch == 0 {
+			l.addError(start, "unterminated raw string")
 			break
 		}
 	}
@@ -167,14 +584,24 @@ func (l *Lexer) readString() string {
 	return l.input[position:l.position]
 }
 
-func isDigit(ch byte) bool {
+func (l *Lexer) addError(pos token.Position, format string, a ...any) {
+	l.errors = append(l.errors, Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+// isLetter reports whether ch can appear in an identifier, which includes
+// letters outside of ASCII, eg. "café" or "π"
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T) {
 
 	let result = add(five, ten);
 
-	!-/*5;
+	!-/ *5;
 	5 < 10 > 5;
 
 	if (5 < 10) {
@@ -210,3 +210,419 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+let add = fn(x, y) {
+	x + y;
+};`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"five", 1, 5},
+		{"=", 1, 10},
+		{"5", 1, 12},
+		{";", 1, 13},
+		{"let", 2, 1},
+		{"add", 2, 5},
+		{"=", 2, 9},
+		{"fn", 2, 11},
+		{"(", 2, 13},
+		{"x", 2, 14},
+		{",", 2, 15},
+		{"y", 2, 17},
+		{")", 2, 18},
+		{"{", 2, 20},
+		{"x", 3, 2},
+		{"+", 3, 4},
+		{"y", 3, 6},
+		{";", 3, 7},
+		{"}", 4, 1},
+		{";", 4, 2},
+		{"", 4, 3},
+	}
+
+	l := NewFile("test.dodo", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i,
+				tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+
+		if tok.Pos.Filename != "test.dodo" {
+			t.Fatalf("tests[%d] - filename wrong. expected=%q, got=%q", i, "test.dodo", tok.Pos.Filename)
+		}
+	}
+}
+
+func TestNumberTokens(t *testing.T) {
+	input := `5 3.14 0.5 1.len [1].0 10.`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.INT, "1"},
+		{token.PERIOD, "."},
+		{token.IDENT, "len"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.PERIOD, "."},
+		{token.INT, "0"},
+		{token.INT, "10"},
+		{token.PERIOD, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// line comment
+let x = 5; // trailing
+/* block
+   comment */ x / 2
+/* outer /* nested */ still outer */ x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	expectedComments := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"// line comment", 1, 1},
+		{"// trailing", 2, 12},
+		{"/* block\n   comment */", 3, 1},
+		{"/* outer /* nested */ still outer */", 5, 1},
+	}
+
+	comments := l.Comments()
+
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expectedComments), len(comments))
+	}
+
+	for i, expected := range expectedComments {
+		comment := comments[i]
+
+		if comment.Type != token.COMMENT || comment.Literal != expected.literal {
+			t.Errorf("comments[%d] wrong. expected=%q, got=%s %q", i, expected.literal, comment.Type, comment.Literal)
+		}
+
+		if comment.Pos.Line != expected.line || comment.Pos.Column != expected.column {
+			t.Errorf("comments[%d] - position wrong. expected=%d:%d, got=%d:%d", i,
+				expected.line, expected.column, comment.Pos.Line, comment.Pos.Column)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 5;\n  /* never /* closed */")
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	if len(l.Errors()) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d", len(l.Errors()))
+	}
+
+	if err := l.Errors()[0].String(); err != "2:3: unterminated block comment" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"plain"`, token.STRING, "plain"},
+		{`"line\nbreak"`, token.STRING, "line\nbreak"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"\r"`, token.STRING, "\r"},
+		{`"\u{41}\u{e9}\u{1F600}"`, token.STRING, "Aé😀"},
+		{"`raw \\n \"quotes\"`", token.RAW_STRING, `raw \n "quotes"`},
+		{"`multi\nline`", token.RAW_STRING, "multi\nline"},
+		{`"cost: \${x}"`, token.STRING, "cost: ${x}"},
+		{`"$5 {}"`, token.STRING, "$5 {}"},
+		{`"sum is ${sum(xs)}!"`, token.TEMPLATE, "sum is ${sum(xs)}!"},
+		{`"${ {"a": "}"}.a }"`, token.TEMPLATE, `${ {"a": "}"}.a }`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Errorf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("tests[%d] - expected EOF after string, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "never closed`, "1:9: unterminated string"},
+		{"let s = \"ends at newline\nlet x = 1;", "1:9: unterminated string"},
+		{"let s = `never closed\n", "1:9: unterminated raw string"},
+		{`"\q"`, `1:2: unknown escape sequence \q`},
+		{`"\u41"`, `1:2: invalid unicode escape, expected \u{...}`},
+		{`"\u{41"`, `1:2: invalid unicode escape, expected \u{...}`},
+		{`"\u{110000}"`, `1:2: invalid unicode code point "110000"`},
+		{`"\u{}"`, `1:2: invalid unicode code point ""`},
+		{`"a ${x + 1`, "1:1: unterminated string"},
+		{"\"${`}\"", "1:4: unterminated raw string"},
+		{`"${"}`, "1:4: unterminated string"},
+		{`"${ f("a) }"`, "1:1: unterminated string"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		if len(l.Errors()) == 0 {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+
+		if err := l.Errors()[0].String(); err != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	input := `let s = "a\t${x + 1} is ${ "b" }";`
+
+	l := New(input)
+	l.NextToken() // let
+	l.NextToken() // s
+	l.NextToken() // =
+	tok := l.NextToken()
+
+	if tok.Type != token.TEMPLATE {
+		t.Fatalf("tok.Type wrong. expected=%q, got=%q", token.TEMPLATE, tok.Type)
+	}
+
+	expected := []TemplatePart{
+		{Text: "a\t", Pos: token.Position{Line: 1, Column: 10}},
+		{Expression: "x + 1", IsExpression: true, Pos: token.Position{Line: 1, Column: 15}},
+		{Text: " is ", Pos: token.Position{Line: 1, Column: 21}},
+		{Expression: ` "b" `, IsExpression: true, Pos: token.Position{Line: 1, Column: 27}},
+	}
+
+	parts := SplitTemplate(tok)
+
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. expected=%d, got=%d (%+v)", len(expected), len(parts), parts)
+	}
+
+	for i, part := range parts {
+		if part != expected[i] {
+			t.Errorf("parts[%d] wrong. expected=%+v, got=%+v", i, expected[i], part)
+		}
+	}
+}
+
+func TestUnicodeInput(t *testing.T) {
+	input := `let café = "naïve"; π + ö;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "café", 5},
+		{token.ASSIGN, "=", 10},
+		{token.STRING, "naïve", 12},
+		{token.SEMICOLON, ";", 19},
+		{token.IDENT, "π", 21},
+		{token.PLUS, "+", 23},
+		{token.IDENT, "ö", 25},
+		{token.SEMICOLON, ";", 26},
+		{token.EOF, "", 27},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors: %v", l.Errors())
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	l := New("let x = \"a\xffb\";")
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	if len(l.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(l.Errors()))
+	}
+
+	if err := l.Errors()[0].String(); err != "1:11: invalid UTF-8 encoding" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+}
+
+func TestOperatorTokens(t *testing.T) {
+	input := `a && b || c <= d >= e % f ** g * h | i & j |> k 1..2 3..=4 5.6 x.y += -= *= /= ** ...rest _ => 1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "d"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "e"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "f"},
+		{token.POWER, "**"},
+		{token.IDENT, "g"},
+		{token.ASTERISK, "*"},
+		{token.IDENT, "h"},
+		{token.ILLEGAL, "|"},
+		{token.IDENT, "i"},
+		{token.ILLEGAL, "&"},
+		{token.IDENT, "j"},
+		{token.PIPE, "|>"},
+		{token.IDENT, "k"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "2"},
+		{token.INT, "3"},
+		{token.RANGE_INCLUSIVE, "..="},
+		{token.INT, "4"},
+		{token.FLOAT, "5.6"},
+		{token.IDENT, "x"},
+		{token.PERIOD, "."},
+		{token.IDENT, "y"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.POWER, "**"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.IDENT, "_"},
+		{token.FAT_ARROW, "=>"},
+		{token.INT, "1"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
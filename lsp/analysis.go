@@ -0,0 +1,317 @@
+package lsp
+
+import (
+	"dodo-lang/ast"
+	"dodo-lang/lexer"
+	"dodo-lang/parser"
+	"dodo-lang/token"
+	"fmt"
+	"strings"
+)
+
+// document is an open file along with the result of analysing its content
+type document struct {
+	text    string
+	lines   []string
+	tokens  []token.Token
+	errors  []parser.Error
+	symbols []*symbol
+}
+
+// symbol is a name bound by a let statement, a function parameter, an import
+// or a struct or enum declaration, visible from its declaration until the end
+// of its scope
+type symbol struct {
+	name     string
+	kind     int
+	pos      token.Position
+	scopeEnd token.Position // Invalid for top-level symbols, which last until the end of the file
+	detail   string
+}
+
+// analyze lexes and parses text. A panic of the lexer or parser is reported
+// as an error of the document rather than taking down the server.
+func analyze(text string) (doc *document) {
+	doc = &document{text: text, lines: strings.Split(text, "\n")}
+
+	defer func() {
+		if r := recover(); r != nil {
+			doc.symbols = nil
+			doc.errors = append(doc.errors, parser.Error{Message: fmt.Sprintf("internal error: %v", r)})
+		}
+	}()
+
+	l := lexer.New(text)
+
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		doc.tokens = append(doc.tokens, tok)
+	}
+
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	doc.errors = p.ErrorList()
+	doc.collectSymbols(program, token.Position{})
+
+	return doc
+}
+
+func (d *document) define(ident *ast.Identifier, kind int, scopeEnd token.Position, detail string) {
+	if ast.IsNil(ident) {
+		return
+	}
+
+	d.symbols = append(d.symbols, &symbol{
+		name:     ident.Value,
+		kind:     kind,
+		pos:      ident.Token.Pos,
+		scopeEnd: scopeEnd,
+		detail:   detail,
+	})
+}
+
+// collectSymbols walks the tree, defining symbols in the scope ending at
+// scopeEnd. Function bodies and other blocks open a new scope.
+func (d *document) collectSymbols(node ast.Node, scopeEnd token.Position) {
+	if ast.IsNil(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			d.collectSymbols(stmt, scopeEnd)
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			d.collectSymbols(stmt, node.End)
+		}
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			for _, ident := range node.Bindings() {
+				if node.Mutable {
+					d.define(ident, kindVariable, scopeEnd, "let mut "+ident.Value)
+				} else {
+					d.define(ident, kindVariable, scopeEnd, "let "+ident.Value)
+				}
+			}
+		} else if fn, ok := node.Value.(*ast.FunctionLiteral); ok && !ast.IsNil(fn) {
+			d.define(node.Name, kindFunction, scopeEnd, functionSignature(node.Name.Value, fn))
+		} else if node.Mutable {
+			d.define(node.Name, kindVariable, scopeEnd, "let mut "+node.Name.Value)
+		} else {
+			d.define(node.Name, kindVariable, scopeEnd, "let "+node.Name.Value)
+		}
+
+		d.collectSymbols(node.Value, scopeEnd)
+	case *ast.ImportStatement:
+		d.define(node.Name, kindModule, scopeEnd, node.String())
+	case *ast.StructStatement:
+		d.define(node.Name, kindStruct, scopeEnd, node.String())
+	case *ast.EnumStatement:
+		d.define(node.Name, kindEnum, scopeEnd, node.String())
+
+		for _, v := range node.Variants {
+			d.define(v.Name, kindEnumMember, scopeEnd, "(variant of "+node.Name.Value+") "+v.String())
+		}
+	case *ast.ImplStatement:
+		for _, method := range node.Methods {
+			d.collectSymbols(method, scopeEnd)
+		}
+	case *ast.FunctionLiteral:
+		if ast.IsNil(node.Body) {
+			return
+		}
+
+		for i, param := range node.Parameters {
+			d.collectSymbols(node.Default(i), scopeEnd)
+
+			if pattern := node.Pattern(i); pattern != nil {
+				for _, ident := range ast.PatternBindings(pattern) {
+					d.define(ident, kindVariable, node.Body.End, "(parameter) "+ident.Value)
+				}
+
+				continue
+			}
+
+			d.define(param, kindVariable, node.Body.End, "(parameter) "+param.Value)
+		}
+
+		if node.Rest != nil {
+			d.define(node.Rest, kindVariable, node.Body.End, "(parameter) ..."+node.Rest.Value)
+		}
+
+		d.collectSymbols(node.Body, scopeEnd)
+	case *ast.ReassignmentStatement:
+		d.collectSymbols(node.Target, scopeEnd)
+		d.collectSymbols(node.Value, scopeEnd)
+	case *ast.ReturnStatement:
+		d.collectSymbols(node.ReturnValue, scopeEnd)
+	case *ast.ThrowStatement:
+		d.collectSymbols(node.Value, scopeEnd)
+	case *ast.ExpressionStatement:
+		d.collectSymbols(node.Expression, scopeEnd)
+	case *ast.PrefixExpression:
+		d.collectSymbols(node.Right, scopeEnd)
+	case *ast.InfixExpression:
+		d.collectSymbols(node.Left, scopeEnd)
+		d.collectSymbols(node.Right, scopeEnd)
+	case *ast.IfExpression:
+		d.collectSymbols(node.Condition, scopeEnd)
+		d.collectSymbols(node.Consequence, scopeEnd)
+		d.collectSymbols(node.Alternative, scopeEnd)
+	case *ast.MatchExpression:
+		d.collectSymbols(node.Subject, scopeEnd)
+
+		for _, arm := range node.Arms {
+			for _, ident := range ast.PatternBindings(arm.Pattern) {
+				d.define(ident, kindVariable, arm.Body.End, "(match binding) "+ident.Value)
+			}
+
+			d.collectSymbols(arm.Guard, scopeEnd)
+			d.collectSymbols(arm.Body, scopeEnd)
+		}
+	case *ast.TryExpression:
+		d.collectSymbols(node.Body, scopeEnd)
+
+		if !ast.IsNil(node.Catch) {
+			d.define(node.Param, kindVariable, node.Catch.End, "(caught error) "+node.Param.Value)
+			d.collectSymbols(node.Catch, scopeEnd)
+		}
+
+		d.collectSymbols(node.Finally, scopeEnd)
+	case *ast.ForExpression:
+		if ast.IsNil(node.Body) {
+			return
+		}
+
+		// Variables declared by init are only visible in the loop
+		d.collectSymbols(node.Init, node.Body.End)
+		d.collectSymbols(node.Condition, scopeEnd)
+		d.collectSymbols(node.Post, scopeEnd)
+		d.collectSymbols(node.Body, scopeEnd)
+	case *ast.ForInExpression:
+		if ast.IsNil(node.Body) {
+			return
+		}
+
+		d.collectSymbols(node.Iterable, scopeEnd)
+
+		if node.Key != nil {
+			d.define(node.Key, kindVariable, node.Body.End, "(loop variable) "+node.Key.Value)
+		}
+
+		d.define(node.Value, kindVariable, node.Body.End, "(loop variable) "+node.Value.Value)
+		d.collectSymbols(node.Body, scopeEnd)
+	case *ast.IndexExpression:
+		d.collectSymbols(node.Left, scopeEnd)
+		d.collectSymbols(node.Index, scopeEnd)
+	case *ast.SliceExpression:
+		d.collectSymbols(node.Left, scopeEnd)
+		d.collectSymbols(node.Start, scopeEnd)
+		d.collectSymbols(node.End, scopeEnd)
+		d.collectSymbols(node.Step, scopeEnd)
+	case *ast.CallExpression:
+		d.collectSymbols(node.Function, scopeEnd)
+
+		for _, arg := range node.Arguments {
+			d.collectSymbols(arg, scopeEnd)
+		}
+	case *ast.NamedArgument:
+		d.collectSymbols(node.Value, scopeEnd)
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			d.collectSymbols(part, scopeEnd)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			d.collectSymbols(el, scopeEnd)
+		}
+	case *ast.HashLiteral:
+		for key, value := range node.Pairs {
+			d.collectSymbols(key, scopeEnd)
+			d.collectSymbols(value, scopeEnd)
+		}
+	}
+}
+
+// visibleSymbols returns the symbols in scope at pos, with inner declarations
+// shadowing outer ones of the same name
+func (d *document) visibleSymbols(pos token.Position) []*symbol {
+	var visible []*symbol
+	seen := map[string]int{}
+
+	for _, sym := range d.symbols {
+		if comparePositions(sym.pos, pos) > 0 {
+			continue
+		}
+
+		if sym.scopeEnd.IsValid() && comparePositions(pos, sym.scopeEnd) > 0 {
+			continue
+		}
+
+		// Symbols are collected in source order, so a later visible symbol
+		// with the same name is always declared in an inner scope
+		if i, ok := seen[sym.name]; ok {
+			visible[i] = sym
+			continue
+		}
+
+		seen[sym.name] = len(visible)
+		visible = append(visible, sym)
+	}
+
+	return visible
+}
+
+func (d *document) resolve(name string, pos token.Position) *symbol {
+	for _, sym := range d.visibleSymbols(pos) {
+		if sym.name == name {
+			return sym
+		}
+	}
+
+	return nil
+}
+
+// identifierAt returns the identifier token under pos, including a cursor
+// placed right after the identifier's last character
+func (d *document) identifierAt(pos token.Position) (token.Token, bool) {
+	for _, tok := range d.tokens {
+		if tok.Type != token.IDENT || tok.Pos.Line != pos.Line {
+			continue
+		}
+
+		if tok.Pos.Column <= pos.Column && pos.Column <= tok.Pos.Column+len(tok.Literal) {
+			return tok, true
+		}
+	}
+
+	return token.Token{}, false
+}
+
+func functionSignature(name string, fn *ast.FunctionLiteral) string {
+	params := []string{}
+
+	for i, param := range fn.Parameters {
+		if def := fn.Default(i); def != nil {
+			params = append(params, param.Value+" = "+def.String())
+		} else {
+			params = append(params, param.Value)
+		}
+	}
+
+	if fn.Rest != nil {
+		params = append(params, "..."+fn.Rest.Value)
+	}
+
+	return fmt.Sprintf("fn %s(%s)", name, strings.Join(params, ", "))
+}
+
+func comparePositions(a, b token.Position) int {
+	if a.Line != b.Line {
+		return a.Line - b.Line
+	}
+
+	return a.Column - b.Column
+}
@@ -0,0 +1,390 @@
+// Package lsp implements a Language Server Protocol server for .dodo files,
+// speaking JSON-RPC over stdio. It provides parse diagnostics, completion,
+// go-to-definition and hover, all built on the lexer and parser.
+package lsp
+
+import (
+	"bufio"
+	"dodo-lang/object"
+	"dodo-lang/token"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: map[string]*document{},
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input. Exiting
+// without being asked to shut down first is an error, as the client did not
+// wait for the server to finish.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.readMessage()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		// A message that is not valid JSON is rejected, but the ones after it
+		// can still be read since its length was known
+		var invalid *invalidMessageError
+
+		if errors.As(err, &invalid) {
+			if err := s.write(errorResponse{JSONRPC: "2.0", Error: responseError{
+				Code: codeParseError, Message: invalid.Error(),
+			}}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+
+			return nil
+		}
+
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) readMessage() (*message, error) {
+	headers, err := textproto.NewReader(s.in).ReadMIMEHeader()
+
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	var msg message
+
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, &invalidMessageError{err}
+	}
+
+	return &msg, nil
+}
+
+// invalidMessageError is the error of a message whose body is not valid JSON
+type invalidMessageError struct {
+	err error
+}
+
+func (e *invalidMessageError) Error() string { return "invalid message: " + e.err.Error() }
+
+func (s *Server) write(v any) error {
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+
+	return err
+}
+
+func (s *Server) handle(msg *message) error {
+	// Requests carry an id and expect a response, notifications do not
+	if msg.ID == nil {
+		return s.handleNotification(msg)
+	}
+
+	if s.shutdown {
+		return s.write(errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: responseError{
+			Code: codeInvalidRequest, Message: "server is shutting down",
+		}})
+	}
+
+	var result any
+	var err error
+
+	switch msg.Method {
+	case "initialize":
+		result = s.initialize()
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/completion":
+		result, err = s.withPosition(msg, s.completion)
+	case "textDocument/definition":
+		result, err = s.withPosition(msg, s.definition)
+	case "textDocument/hover":
+		result, err = s.withPosition(msg, s.hover)
+	default:
+		return s.write(errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: responseError{
+			Code: codeMethodNotFound, Message: "method not found: " + msg.Method,
+		}})
+	}
+
+	if err != nil {
+		return s.write(errorResponse{JSONRPC: "2.0", ID: msg.ID, Error: responseError{
+			Code: codeInvalidParams, Message: err.Error(),
+		}})
+	}
+
+	return s.write(response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) handleNotification(msg *message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params didChangeParams
+
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+
+		// Documents are synced in full, so the last change holds the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+
+		return s.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params didCloseParams
+
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+
+		delete(s.documents, params.TextDocument.URI)
+
+		return s.publishDiagnostics(params.TextDocument.URI, []Diagnostic{})
+	}
+
+	return nil
+}
+
+func (s *Server) initialize() any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":   syncFull,
+			"completionProvider": map[string]any{"triggerCharacters": []string{"."}},
+			"definitionProvider": true,
+			"hoverProvider":      true,
+		},
+		"serverInfo": map[string]any{"name": "dodo-lsp"},
+	}
+}
+
+func (s *Server) update(uri string, text string) error {
+	doc := analyze(text)
+	s.documents[uri] = doc
+
+	diagnostics := []Diagnostic{}
+
+	for _, err := range doc.errors {
+		start := doc.toLSPPosition(err.Pos)
+		end := doc.toLSPPosition(token.Position{Line: err.Pos.Line, Column: err.Pos.Column + 1})
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: end},
+			Severity: severityError,
+			Source:   "dodo",
+			Message:  err.Message,
+		})
+	}
+
+	return s.publishDiagnostics(uri, diagnostics)
+}
+
+func (s *Server) publishDiagnostics(uri string, diagnostics []Diagnostic) error {
+	return s.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+// withPosition decodes the params of a text document position request and
+// hands the document and position to handler
+func (s *Server) withPosition(msg *message, handler func(uri string, doc *document, pos token.Position) any) (any, error) {
+	var params textDocumentPositionParams
+
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, err
+	}
+
+	doc := s.document(params.TextDocument.URI)
+
+	return handler(params.TextDocument.URI, doc, doc.fromLSPPosition(params.Position)), nil
+}
+
+func (s *Server) completion(uri string, doc *document, pos token.Position) any {
+	items := []CompletionItem{}
+
+	for _, sym := range doc.visibleSymbols(pos) {
+		items = append(items, CompletionItem{Label: sym.name, Kind: sym.kind, Detail: sym.detail})
+	}
+
+	for _, def := range object.Builtins {
+		items = append(items, CompletionItem{Label: def.Name, Kind: kindFunction, Detail: "builtin"})
+	}
+
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: kindKeyword})
+	}
+
+	return items
+}
+
+func (s *Server) definition(uri string, doc *document, pos token.Position) any {
+	tok, ok := doc.identifierAt(pos)
+
+	if !ok {
+		return nil
+	}
+
+	sym := doc.resolve(tok.Literal, pos)
+
+	if sym == nil {
+		return nil
+	}
+
+	return Location{URI: uri, Range: doc.nameRange(sym.pos, sym.name)}
+}
+
+func (s *Server) hover(uri string, doc *document, pos token.Position) any {
+	tok, ok := doc.identifierAt(pos)
+
+	if !ok {
+		return nil
+	}
+
+	var detail string
+
+	if sym := doc.resolve(tok.Literal, pos); sym != nil {
+		detail = sym.detail
+	} else if object.GetBuiltinByName(tok.Literal) != nil {
+		detail = "builtin " + tok.Literal
+	} else {
+		return nil
+	}
+
+	r := doc.nameRange(tok.Pos, tok.Literal)
+
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```dodo\n" + detail + "\n```"},
+		Range:    &r,
+	}
+}
+
+// document returns the analysed document for uri, or an empty one when the
+// client has not opened it
+func (s *Server) document(uri string) *document {
+	if doc, ok := s.documents[uri]; ok {
+		return doc
+	}
+
+	return analyze("")
+}
+
+func (d *document) nameRange(pos token.Position, name string) Range {
+	start := d.toLSPPosition(pos)
+	end := Position{Line: start.Line, Character: start.Character + utf16Len(name)}
+
+	return Range{Start: start, End: end}
+}
+
+// LSP positions are 0-based and count UTF-16 code units, while token
+// positions are 1-based and count characters
+func (d *document) toLSPPosition(pos token.Position) Position {
+	line := []rune(d.line(pos.Line))
+	column := max(pos.Column-1, 0)
+
+	// Errors at the end of the input may be positioned past the end of a line
+	character := max(column-len(line), 0)
+
+	for _, r := range line[:min(column, len(line))] {
+		character += utf16RuneLen(r)
+	}
+
+	return Position{Line: max(pos.Line-1, 0), Character: character}
+}
+
+func (d *document) fromLSPPosition(pos Position) token.Position {
+	column := 1
+	character := 0
+
+	for _, r := range d.line(pos.Line + 1) {
+		if character >= pos.Character {
+			break
+		}
+
+		character += utf16RuneLen(r)
+		column += 1
+	}
+
+	return token.Position{Line: pos.Line + 1, Column: column + max(pos.Character-character, 0)}
+}
+
+// line returns the text of the 1-based line n, or "" if there is no such line
+func (d *document) line(n int) string {
+	if n < 1 || n > len(d.lines) {
+		return ""
+	}
+
+	return d.lines[n-1]
+}
+
+func utf16Len(s string) int {
+	n := 0
+
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+
+	return n
+}
+
+// utf16RuneLen returns the number of UTF-16 code units encoding r, where
+// characters outside of the Basic Multilingual Plane take a surrogate pair
+func utf16RuneLen(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+
+	return 1
+}
@@ -0,0 +1,435 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+const testURI = "file:///test.dodo"
+
+// client drives a server over in-memory pipes the same way an editor would
+// over stdio, keeping notifications that arrive while waiting for responses
+type client struct {
+	t             *testing.T
+	in            io.WriteCloser
+	out           *bufio.Reader
+	nextID        int
+	notifications []map[string]any
+	done          chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, out: bufio.NewReader(clientIn), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+
+	t.Cleanup(func() { clientOut.Close() })
+
+	return c
+}
+
+func (c *client) send(v map[string]any) {
+	c.t.Helper()
+
+	v["jsonrpc"] = "2.0"
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) read() map[string]any {
+	c.t.Helper()
+
+	headers, err := textproto.NewReader(c.out).ReadMIMEHeader()
+
+	if err != nil {
+		c.t.Fatalf("could not read headers: %s", err)
+	}
+
+	length, _ := strconv.Atoi(headers.Get("Content-Length"))
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(c.out, body); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var msg map[string]any
+
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return msg
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(map[string]any{"method": method, "params": params})
+}
+
+func (c *client) request(method string, params any) map[string]any {
+	c.t.Helper()
+
+	c.nextID += 1
+	c.send(map[string]any{"id": c.nextID, "method": method, "params": params})
+
+	for {
+		msg := c.read()
+
+		if _, ok := msg["id"]; !ok {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+
+		if int(msg["id"].(float64)) != c.nextID {
+			c.t.Fatalf("response has wrong id. expected=%d, got=%v", c.nextID, msg["id"])
+		}
+
+		return msg
+	}
+}
+
+// open opens a document and returns the diagnostics published for it
+func (c *client) open(text string) []any {
+	c.t.Helper()
+
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": testURI, "languageId": "dodo", "version": 1, "text": text},
+	})
+
+	msg := c.read()
+
+	if msg["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %v", msg)
+	}
+
+	return msg["params"].(map[string]any)["diagnostics"].([]any)
+}
+
+func positionParams(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": testURI},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func TestInitializeAndShutdown(t *testing.T) {
+	c := newClient(t)
+
+	resp := c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	capabilities := resp["result"].(map[string]any)["capabilities"].(map[string]any)
+
+	for _, capability := range []string{"completionProvider", "definitionProvider", "hoverProvider"} {
+		if _, ok := capabilities[capability]; !ok {
+			t.Errorf("capability %s not advertised", capability)
+		}
+	}
+
+	c.notify("initialized", map[string]any{})
+
+	resp = c.request("shutdown", nil)
+
+	if result, ok := resp["result"]; !ok || result != nil {
+		t.Errorf("expected null shutdown result. got=%v", resp)
+	}
+
+	c.notify("exit", nil)
+
+	if err := <-c.done; err != nil {
+		t.Errorf("server exited with error: %s", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+
+	c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	c.notify("exit", nil)
+
+	if err := <-c.done; err == nil {
+		t.Errorf("server exited without error")
+	}
+}
+
+func TestMalformedMessage(t *testing.T) {
+	c := newClient(t)
+
+	body := "bogus"
+
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := c.read()
+	respErr, ok := resp["error"].(map[string]any)
+
+	if !ok {
+		t.Fatalf("expected error response. got=%v", resp)
+	}
+
+	if int(respErr["code"].(float64)) != codeParseError {
+		t.Errorf("wrong error code. got=%v", respErr["code"])
+	}
+
+	if id, ok := resp["id"]; !ok || id != nil {
+		t.Errorf("expected null id. got=%v", resp)
+	}
+
+	// The server keeps serving after the malformed message
+	resp = c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+
+	if _, ok := resp["result"]; !ok {
+		t.Errorf("expected result. got=%v", resp)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	c := newClient(t)
+
+	resp := c.request("textDocument/rename", positionParams(0, 0))
+	respErr, ok := resp["error"].(map[string]any)
+
+	if !ok {
+		t.Fatalf("expected error response. got=%v", resp)
+	}
+
+	if int(respErr["code"].(float64)) != codeMethodNotFound {
+		t.Errorf("wrong error code. got=%v", respErr["code"])
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open("let x = 5;\nlet y = ;")
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. expected=1, got=%d (%v)", len(diagnostics), diagnostics)
+	}
+
+	diagnostic := diagnostics[0].(map[string]any)
+	start := diagnostic["range"].(map[string]any)["start"].(map[string]any)
+
+	if start["line"] != 1.0 || start["character"] != 8.0 {
+		t.Errorf("wrong diagnostic position. got=%v", start)
+	}
+
+	if diagnostic["message"] != "no prefix parse function for ; found" {
+		t.Errorf("wrong diagnostic message. got=%q", diagnostic["message"])
+	}
+
+	// Fixing the document clears the diagnostics
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": testURI, "version": 2},
+		"contentChanges": []any{map[string]any{"text": "let x = 5;\nlet y = 10;"}},
+	})
+
+	msg := c.read()
+
+	if diagnostics := msg["params"].(map[string]any)["diagnostics"].([]any); len(diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared. got=%v", diagnostics)
+	}
+}
+
+const testDocument = `let total = 10;
+let add = fn(x, y) {
+  let sum = x + y;
+  sum
+};
+let result = add(total, 5);
+`
+
+func TestDiagnosticsForUnterminatedInterpolation(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open("\"${`}\"")
+
+	if len(diagnostics) == 0 {
+		t.Fatalf("expected diagnostics, got none")
+	}
+
+	if message := diagnostics[0].(map[string]any)["message"]; message != "unterminated raw string" {
+		t.Errorf("wrong diagnostic message. got=%q", message)
+	}
+}
+
+// Positions sent to and received from the client count UTF-16 code units
+func TestUnicodePositions(t *testing.T) {
+	c := newClient(t)
+
+	diagnostics := c.open("\"🦤\" + ;")
+	start := diagnostics[0].(map[string]any)["range"].(map[string]any)["start"].(map[string]any)
+
+	if start["line"] != 0.0 || start["character"] != 7.0 {
+		t.Errorf("wrong diagnostic position. got=%v", start)
+	}
+
+	c.open("let s = \"🦤\"; let héllo = s;\nhéllo;")
+
+	tests := []struct {
+		line, character int
+		expectedStart   float64
+		expectedEnd     float64
+	}{
+		{1, 2, 18, 23}, // héllo in `héllo;`
+		{0, 26, 4, 5},  // s in `= s`
+	}
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/definition", positionParams(tt.line, tt.character))
+		location, ok := resp["result"].(map[string]any)
+
+		if !ok {
+			t.Errorf("no definition found at %d:%d. got=%v", tt.line, tt.character, resp)
+			continue
+		}
+
+		r := location["range"].(map[string]any)
+		start := r["start"].(map[string]any)["character"]
+		end := r["end"].(map[string]any)["character"]
+
+		if start != tt.expectedStart || end != tt.expectedEnd {
+			t.Errorf("wrong definition range for %d:%d. expected=%v-%v, got=%v-%v", tt.line, tt.character,
+				tt.expectedStart, tt.expectedEnd, start, end)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        []string
+		unexpected      []string
+	}{
+		// Inside the body of add, after sum is declared
+		{3, 2, []string{"total", "add", "x", "y", "sum", "len", "push", "let", "fn"}, []string{"result"}},
+		// At the top level, where the function's locals are out of scope
+		{6, 0, []string{"total", "add", "result", "typeof", "return"}, []string{"x", "y", "sum"}},
+		// Before anything is declared
+		{0, 0, []string{"len", "let"}, []string{"total", "add"}},
+	}
+
+	c := newClient(t)
+	c.open(testDocument)
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/completion", positionParams(tt.line, tt.character))
+		labels := map[string]bool{}
+
+		for _, item := range resp["result"].([]any) {
+			labels[item.(map[string]any)["label"].(string)] = true
+		}
+
+		for _, label := range tt.expected {
+			if !labels[label] {
+				t.Errorf("completion at %d:%d is missing %q", tt.line, tt.character, label)
+			}
+		}
+
+		for _, label := range tt.unexpected {
+			if labels[label] {
+				t.Errorf("completion at %d:%d unexpectedly contains %q", tt.line, tt.character, label)
+			}
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expectedLine    float64
+		expectedChar    float64
+	}{
+		{5, 13, 1, 4},  // add in `add(total, 5)`
+		{5, 17, 0, 4},  // total in `add(total, 5)`
+		{2, 12, 1, 13}, // x in `x + y`
+		{3, 2, 2, 6},   // sum
+	}
+
+	c := newClient(t)
+	c.open(testDocument)
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/definition", positionParams(tt.line, tt.character))
+		location, ok := resp["result"].(map[string]any)
+
+		if !ok {
+			t.Errorf("no definition found at %d:%d. got=%v", tt.line, tt.character, resp)
+			continue
+		}
+
+		if location["uri"] != testURI {
+			t.Errorf("wrong uri. got=%v", location["uri"])
+		}
+
+		start := location["range"].(map[string]any)["start"].(map[string]any)
+
+		if start["line"] != tt.expectedLine || start["character"] != tt.expectedChar {
+			t.Errorf("wrong definition for %d:%d. expected=%v:%v, got=%v:%v", tt.line, tt.character,
+				tt.expectedLine, tt.expectedChar, start["line"], start["character"])
+		}
+	}
+
+	// Builtins and literals have no definition in the document
+	resp := c.request("textDocument/definition", positionParams(5, 24))
+
+	if resp["result"] != nil {
+		t.Errorf("expected no definition. got=%v", resp["result"])
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{5, 14, "```dodo\nfn add(x, y)\n```"},
+		{5, 18, "```dodo\nlet total\n```"},
+		{2, 12, "```dodo\n(parameter) x\n```"},
+	}
+
+	c := newClient(t)
+	c.open(testDocument + "len(result);\n")
+
+	for _, tt := range tests {
+		resp := c.request("textDocument/hover", positionParams(tt.line, tt.character))
+		hover, ok := resp["result"].(map[string]any)
+
+		if !ok {
+			t.Errorf("no hover at %d:%d. got=%v", tt.line, tt.character, resp)
+			continue
+		}
+
+		contents := hover["contents"].(map[string]any)["value"]
+
+		if contents != tt.expected {
+			t.Errorf("wrong hover at %d:%d. expected=%q, got=%q", tt.line, tt.character, tt.expected, contents)
+		}
+	}
+
+	resp := c.request("textDocument/hover", positionParams(6, 1))
+	hover := resp["result"].(map[string]any)
+
+	if contents := hover["contents"].(map[string]any)["value"]; contents != "```dodo\nbuiltin len\n```" {
+		t.Errorf("wrong hover for builtin. got=%q", contents)
+	}
+}
@@ -1,24 +1,47 @@
 package main
 
 import (
+	"dodo-lang/evaluator"
+	"dodo-lang/lsp"
 	"dodo-lang/repl"
+	"dodo-lang/vm"
 	"flag"
+	"fmt"
 	"os"
 )
 
 var filename string
 var verbose bool
+var engine string
 
 func init() {
 	flag.StringVar(&filename, "f", "", "Dodo file to run")
 	flag.BoolVar(&verbose, "v", false, "Verbose mode")
+	flag.StringVar(&engine, "engine", repl.EngineEval, "Engine used to run files (eval or vm)")
+	flag.IntVar(&evaluator.MaxCallDepth, "max-depth", evaluator.MaxCallDepth, "Maximum depth of nested function calls")
 	flag.Parse()
+
+	// Both engines share the limit
+	vm.MaxFrames = evaluator.MaxCallDepth
 }
 
 func main() {
+	switch flag.Arg(0) {
+	case "lsp":
+		// Language server, speaking LSP over stdio
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	case "fmt":
+		os.Exit(runFmt(flag.Args()[1:]))
+	}
+
 	if filename != "" {
 		// REPL / File mode
-		repl.FileMode(os.Stdin, os.Stdout, filename, verbose)
+		repl.FileMode(os.Stdin, os.Stdout, filename, engine, verbose)
 	} else {
 		// REPL / Interactive mode
 		repl.InteractiveMode(os.Stdin, os.Stdout, verbose)
@@ -0,0 +1,109 @@
+package object
+
+import (
+	"dodo-lang/ast"
+	"fmt"
+	"slices"
+)
+
+// Signature describes the parameters of a function, which both backends use
+// to bind the arguments of a call
+type Signature struct {
+	Parameters []string
+	Required   int    // Number of leading parameters without a default value
+	Rest       string // Name of the rest parameter, empty if there is none
+}
+
+// NewSignature describes a function with the given parameters, where defaults
+// holds the default values of the parameters, nil for those without one
+func NewSignature(params []*ast.Identifier, defaults []ast.Expression, rest *ast.Identifier) *Signature {
+	sig := &Signature{Parameters: []string{}}
+
+	for i, p := range params {
+		sig.Parameters = append(sig.Parameters, p.Value)
+
+		if sig.Required == i && (i >= len(defaults) || defaults[i] == nil) {
+			sig.Required += 1
+		}
+	}
+
+	if rest != nil {
+		sig.Rest = rest.Value
+	}
+
+	return sig
+}
+
+// Bind matches the arguments of a call to the parameters of the signature.
+// The last len(names) arguments are passed by name, the others by position.
+// The result holds a value for every parameter, nil for parameters left to
+// their default value, followed by an array of the remaining positional
+// arguments if the signature has a rest parameter.
+func (s *Signature) Bind(args []Object, names []string) ([]Object, *Error) {
+	positional := args[:len(args)-len(names)]
+
+	// Plain calls passing every parameter by position need no matching
+	if len(names) == 0 && s.Rest == "" && len(positional) == len(s.Parameters) {
+		return args, nil
+	}
+
+	if len(positional) > len(s.Parameters) && s.Rest == "" {
+		return nil, s.arityError(len(args))
+	}
+
+	bound := make([]Object, len(s.Parameters))
+	copy(bound, positional)
+
+	for i, name := range names {
+		index := slices.Index(s.Parameters, name)
+
+		if index < 0 {
+			return nil, newError("unknown parameter '%s'", name)
+		}
+
+		if bound[index] != nil {
+			return nil, newError("argument '%s' given more than once", name)
+		}
+
+		bound[index] = args[len(positional)+i]
+	}
+
+	for i, value := range bound[:s.Required] {
+		if value != nil {
+			continue
+		}
+
+		if len(names) == 0 {
+			return nil, s.arityError(len(args))
+		}
+
+		return nil, newError("missing argument for parameter '%s'", s.Parameters[i])
+	}
+
+	if s.Rest != "" {
+		rest := []Object{}
+
+		if len(positional) > len(s.Parameters) {
+			rest = append(rest, positional[len(s.Parameters):]...)
+		}
+
+		bound = append(bound, &Array{Elements: rest})
+	}
+
+	return bound, nil
+}
+
+func (s *Signature) arityError(got int) *Error {
+	var want string
+
+	switch {
+	case s.Rest != "":
+		want = fmt.Sprintf("at least %d", s.Required)
+	case s.Required == len(s.Parameters):
+		want = fmt.Sprintf("%d", s.Required)
+	default:
+		want = fmt.Sprintf("%d to %d", s.Required, len(s.Parameters))
+	}
+
+	return newError("wrong number of arguments: want=%s, got=%d", want, got)
+}
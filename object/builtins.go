@@ -0,0 +1,424 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins are shared by the evaluator and the virtual machine. The order of
+// the slice is significant since the compiler refers to builtins by index.
+//
+// A builtin returns nil to signal null, leaving it to the caller to turn that
+// into its own null value. Likewise, booleans are turned into the caller's own
+// true and false.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *String:
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *Range:
+					n, ok := arg.Len()
+
+					if !ok {
+						return newError("length of range %s does not fit in an integer", arg.Inspect())
+					}
+
+					return &Integer{Value: n}
+				default:
+					return newError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"rest",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if len(arg.Elements) > 0 {
+
+						arrLen := len(arg.Elements)
+						newArr := make([]Object, arrLen-1, arrLen-1)
+						copy(newArr, arg.Elements[1:])
+
+						return &Array{Elements: newArr}
+					}
+
+					return nil
+				case *String:
+					if len(arg.Value) > 0 {
+						_, size := utf8.DecodeRuneInString(arg.Value)
+						return &String{Value: arg.Value[size:]}
+					}
+
+					return nil
+				default:
+					return newError("argument to `rest` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"first",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					if len(arg.Elements) > 0 {
+						return arg.Elements[0]
+					}
+
+					return nil
+				case *String:
+					if len(arg.Value) > 0 {
+						r, _ := utf8.DecodeRuneInString(arg.Value)
+						return &String{Value: string(r)}
+					}
+
+					return nil
+				default:
+					return newError("argument to `first` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"last",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Array:
+					max := len(arg.Elements) - 1
+					if len(arg.Elements) > 0 {
+						return arg.Elements[max]
+					}
+
+					return nil
+				case *String:
+					if len(arg.Value) > 0 {
+						r, _ := utf8.DecodeLastRuneInString(arg.Value)
+						return &String{Value: string(r)}
+					}
+
+					return nil
+				default:
+					return newError("argument to `last` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		// Strings are indexed by character, bytes gives access to the UTF-8
+		// encoding underneath
+		"bytes",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				str, ok := args[0].(*String)
+
+				if !ok {
+					return newError("argument to `bytes` not supported, got %s", args[0].Type())
+				}
+
+				elements := make([]Object, len(str.Value))
+
+				for i := 0; i < len(str.Value); i++ {
+					elements[i] = &Integer{Value: int64(str.Value[i])}
+				}
+
+				return &Array{Elements: elements}
+			},
+		},
+	},
+	{
+		"push",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, expected=2", len(args))
+				}
+
+				// Arrays are values, so push returns a new array rather than
+				// changing the one passed in, like assigning to an element
+				// does. Use `arr = push(arr, x)` to add to a mutable array.
+				switch arg := args[0].(type) {
+				case *Array:
+					length := len(arg.Elements)
+					newArr := make([]Object, length+1, length+1)
+					copy(newArr, arg.Elements)
+					newArr[length] = args[1]
+					Share(args[1])
+
+					return &Array{Elements: newArr}
+				default:
+					return newError("argument to `last` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"typeof",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				// Structs and enums are of the type they were declared as
+				switch arg := args[0].(type) {
+				case *Struct:
+					return &String{Value: arg.Definition.Name}
+				case *Enum:
+					return &String{Value: arg.Variant.Enum.Name}
+				}
+
+				return &String{Value: string(args[0].Type())}
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return arg
+				case *Float:
+					// Converting a float out of the range of int64 is undefined
+					if math.IsNaN(arg.Value) || arg.Value < math.MinInt64 || arg.Value >= -math.MinInt64 {
+						return newError("could not convert %s to an integer", arg.Inspect())
+					}
+
+					return &Integer{Value: int64(arg.Value)}
+				case *String:
+					value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 0, 64)
+
+					if err != nil {
+						return newError("could not convert %q to an integer", arg.Value)
+					}
+
+					return &Integer{Value: value}
+				default:
+					return newError("argument to `int` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer:
+					return &Float{Value: float64(arg.Value)}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+
+					if err != nil {
+						return newError("could not convert %q to a float", arg.Value)
+					}
+
+					return &Float{Value: value}
+				default:
+					return newError("argument to `float` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"debug",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				arg := args[0].(Object)
+
+				fmt.Printf("%s\n", arg.Inspect())
+
+				return nil
+			},
+		},
+	},
+	{
+		"println",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				for _, arg := range args {
+					fmt.Println(arg.Inspect())
+				}
+
+				return nil
+			},
+		},
+	},
+	{
+		"printf",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) < 2 {
+					return newError("wrong number of arguments. got=%d, expected at least 2", len(args))
+				}
+
+				formatStr, ok := args[0].(*String)
+
+				if !ok {
+					return newError("first argument has to be a string. got=%s", args[0].Type())
+				}
+
+				var templateArgs []any
+
+				for _, arg := range args[1:] {
+					switch a := arg.(type) {
+					case *String:
+						templateArgs = append(templateArgs, a.Value)
+					case *Integer:
+						templateArgs = append(templateArgs, a.Value)
+					case *Float:
+						templateArgs = append(templateArgs, a.Value)
+					default:
+						return newError("only strings and numbers can be used with 'printf'. got=%s", a.Type())
+					}
+				}
+
+				fmt.Printf(formatStr.Value, templateArgs...)
+				fmt.Print("\n")
+
+				return nil
+			},
+		},
+	},
+	{
+		"variant_of",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				arg, ok := args[0].(*Enum)
+
+				if !ok {
+					return newError("argument to `variant_of` not supported, got %s", args[0].Type())
+				}
+
+				return &String{Value: arg.Variant.Name}
+			},
+		},
+	},
+	{
+		"error",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, expected=1 or 2", len(args))
+				}
+
+				message, ok := args[0].(*String)
+
+				if !ok {
+					return newError("argument to `error` must be STRING, got %s", args[0].Type())
+				}
+
+				ev := &ErrorValue{Message: message.Value}
+
+				if len(args) == 2 {
+					ev.Cause = args[1]
+					Share(ev.Cause)
+				}
+
+				return ev
+			},
+		},
+	},
+	{
+		"is_error",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				_, ok := args[0].(*ErrorValue)
+
+				return &Boolean{Value: ok}
+			},
+		},
+	},
+	{
+		// unwrap passes values through, but throws error values, for code
+		// returning errors to give up on them
+		"unwrap",
+		&Builtin{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, expected=1", len(args))
+				}
+
+				if _, ok := args[0].(*ErrorValue); ok {
+					return Throw(args[0])
+				}
+
+				Share(args[0])
+
+				return args[0]
+			},
+		},
+	},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+
+	return nil
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,172 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnumType is an enum declared with `enum Name { Variant(fields), ... }`.
+// Declaring it binds the name of every variant alongside the enum itself.
+type EnumType struct {
+	Name     string
+	Variants []*Variant
+	Methods  map[string]Object // Functions implemented for the enum by impl blocks
+}
+
+func NewEnumType(name string) *EnumType {
+	return &EnumType{Name: name, Methods: map[string]Object{}}
+}
+
+func (et *EnumType) Type() ObjectType { return ENUM_TYPE_OBJ }
+func (et *EnumType) Inspect() string {
+	variants := []string{}
+
+	for _, v := range et.Variants {
+		variants = append(variants, v.Inspect())
+	}
+
+	if len(variants) == 0 {
+		return fmt.Sprintf("enum %s {}", et.Name)
+	}
+
+	return fmt.Sprintf("enum %s { %s }", et.Name, strings.Join(variants, ", "))
+}
+
+// AddVariant adds a variant to the enum. Variants with fields, even an empty
+// list of them, are called like functions to construct values of them, so
+// the value bound to their name is the variant itself. Variants without are
+// values on their own.
+func (et *EnumType) AddVariant(name string, fields []string) Object {
+	variant := &Variant{Enum: et, Name: name}
+
+	if fields != nil {
+		variant.Signature = &Signature{Parameters: fields, Required: len(fields)}
+	}
+
+	et.Variants = append(et.Variants, variant)
+
+	if variant.Signature == nil {
+		return &Enum{Variant: variant}
+	}
+
+	return variant
+}
+
+// Variant is one of the variants of an enum, which constructs values of it
+// when called if it has fields
+type Variant struct {
+	Enum      *EnumType
+	Name      string
+	Signature *Signature // The fields of the variant, nil if it has none
+}
+
+func (v *Variant) Type() ObjectType { return VARIANT_OBJ }
+func (v *Variant) Inspect() string {
+	if v.Signature == nil {
+		return v.Name
+	}
+
+	return fmt.Sprintf("%s(%s)", v.Name, strings.Join(v.Signature.Parameters, ", "))
+}
+
+// New constructs a value of the variant from the arguments of a call to it,
+// where the last len(names) arguments are passed by name
+func (v *Variant) New(args []Object, names []string) (*Enum, *Error) {
+	bound, err := v.Signature.Bind(args, names)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The arguments may be a slice of the stack of the virtual machine
+	fields := make([]Object, len(bound))
+	copy(fields, bound)
+
+	return &Enum{Variant: v, Fields: fields}, nil
+}
+
+// Enum is a value of an enum, holding the variant it is and the values of the
+// fields of the variant
+type Enum struct {
+	Variant *Variant
+	Fields  []Object
+}
+
+func (e *Enum) Type() ObjectType { return ENUM_OBJ }
+func (e *Enum) Inspect() string {
+	if e.Variant.Signature == nil {
+		return e.Variant.Name
+	}
+
+	fields := []string{}
+
+	for _, f := range e.Fields {
+		fields = append(fields, f.Inspect())
+	}
+
+	return fmt.Sprintf("%s(%s)", e.Variant.Name, strings.Join(fields, ", "))
+}
+
+// Get returns the value of the field named by index, eg. `shape.r`
+func (e *Enum) Get(index Object) (Object, *Error) {
+	i, err := fieldIndex(e.Variant.Name, e.fieldNames(), index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Fields[i], nil
+}
+
+// Set returns a copy of the value with the field named by index set to value
+func (e *Enum) Set(index, value Object) (Object, *Error) {
+	i, err := fieldIndex(e.Variant.Name, e.fieldNames(), index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Object, len(e.Fields))
+	copy(fields, e.Fields)
+	fields[i] = value
+
+	return &Enum{Variant: e.Variant, Fields: fields}, nil
+}
+
+func (e *Enum) fieldNames() []string {
+	if e.Variant.Signature == nil {
+		return nil
+	}
+
+	return e.Variant.Signature.Parameters
+}
+
+// Equal reports whether other is the same variant with equal fields. Numbers,
+// strings, booleans and enums in the fields are compared by value, anything
+// else by identity like the == operator does.
+func (e *Enum) Equal(other Object) bool {
+	o, ok := other.(*Enum)
+
+	if !ok || o.Variant != e.Variant {
+		return false
+	}
+
+	for i, f := range e.Fields {
+		switch f := f.(type) {
+		case *Integer, *Float, *String, *Boolean:
+			if !literalEqual(f, o.Fields[i]) {
+				return false
+			}
+		case *Enum:
+			if !f.Equal(o.Fields[i]) {
+				return false
+			}
+		default:
+			if f != o.Fields[i] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
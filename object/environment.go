@@ -29,10 +29,44 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Declared reports whether name is bound in e itself, leaving out the
+// environments enclosing it
+func (e *Environment) Declared(name string) bool {
+	_, ok := e.store[name]
+	return ok
+}
+
 func (e *Environment) IsMutable(name string) bool {
 	return e.mutables[name]
 }
 
+// Resolve returns the environment name is defined in, which is either e or
+// one enclosing it, or nil when name is not defined at all
+func (e *Environment) Resolve(name string) *Environment {
+	if _, ok := e.store[name]; ok {
+		return e
+	}
+
+	if e.outer != nil {
+		return e.outer.Resolve(name)
+	}
+
+	return nil
+}
+
+// Clone copies the bindings of e into a new environment with the same outer
+// environment, eg. to give each iteration of a loop its own loop variables
+func (e *Environment) Clone() *Environment {
+	clone := NewEnclosedEnvironment(e.outer)
+
+	for name, val := range e.store {
+		Share(val)
+		clone.Set(name, e.mutables[name], val)
+	}
+
+	return clone
+}
+
 func (e *Environment) Set(name string, mutable bool, val Object) Object {
 	e.store[name] = val
 
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"dodo-lang/token"
+)
+
+// ErrorValue is an error as a value of the language, made by the error
+// builtin or bound by a catch block. Unlike Error, which unwinds the program
+// until it is caught, it can be passed around like any other value. Its
+// fields are its message and the value it was caused by, eg. `e.message`.
+type ErrorValue struct {
+	Message string
+	Cause   Object         // nil if the error has no cause
+	Pos     token.Position // Where the error was raised, if it was caught from the runtime
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string  { return "error: " + ev.chain() }
+
+// chain returns the message of the error followed by the messages of its
+// causes, eg. "loading config: file not found"
+func (ev *ErrorValue) chain() string {
+	switch cause := ev.Cause.(type) {
+	case nil:
+		return ev.Message
+	case *ErrorValue:
+		return ev.Message + ": " + cause.chain()
+	default:
+		return ev.Message + ": " + cause.Inspect()
+	}
+}
+
+// Get returns the message or cause of the error, or nil if it has no cause
+func (ev *ErrorValue) Get(index Object) (Object, *Error) {
+	i, err := fieldIndex("error", errorFields, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if i == 0 {
+		return &String{Value: ev.Message}, nil
+	}
+
+	return ev.Cause, nil
+}
+
+// Set returns a copy of the error with its message or cause set to value
+func (ev *ErrorValue) Set(index, value Object) (Object, *Error) {
+	i, err := fieldIndex("error", errorFields, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changed := *ev
+
+	if i == 1 {
+		changed.Cause = value
+		return &changed, nil
+	}
+
+	message, ok := value.(*String)
+
+	if !ok {
+		return nil, newError("message of an error must be a STRING, got %s", value.Type())
+	}
+
+	changed.Message = message.Value
+
+	return &changed, nil
+}
+
+var errorFields = []string{"message", "cause"}
+
+// Throw raises value as an error, which unwinds the program until a try
+// expression catches it. Uncaught, the error reads as the message of value if
+// it is an error value, or as value itself otherwise.
+func Throw(value Object) *Error {
+	if ev, ok := value.(*ErrorValue); ok {
+		return &Error{Message: ev.chain(), Pos: ev.Pos, Thrown: value}
+	}
+
+	return &Error{Message: value.Inspect(), Thrown: value}
+}
+
+// Caught returns the value a catch block binds for the error: the value that
+// was thrown, or an error value with the message of an error raised by the
+// runtime
+func (e *Error) Caught() Object {
+	if e.Thrown != nil {
+		return e.Thrown
+	}
+
+	return &ErrorValue{Message: e.Message, Pos: e.Pos}
+}
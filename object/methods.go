@@ -0,0 +1,32 @@
+package object
+
+// Implement adds a method to a user-defined type, replacing any method of the
+// same name implemented by an earlier impl block
+func Implement(target Object, name string, method Object) *Error {
+	switch target := target.(type) {
+	case *StructType:
+		target.Methods[name] = method
+		return nil
+	case *EnumType:
+		target.Methods[name] = method
+		return nil
+	default:
+		return newError("cannot implement methods for %s", target.Type())
+	}
+}
+
+// LookupMethod returns the method called name implemented for the type of
+// receiver, if there is one. Methods are called with the receiver as their
+// first argument.
+func LookupMethod(receiver Object, name string) (Object, bool) {
+	switch receiver := receiver.(type) {
+	case *Struct:
+		method, ok := receiver.Definition.Methods[name]
+		return method, ok
+	case *Enum:
+		method, ok := receiver.Variant.Enum.Methods[name]
+		return method, ok
+	default:
+		return nil, false
+	}
+}
@@ -3,8 +3,12 @@ package object
 import (
 	"bytes"
 	"dodo-lang/ast"
+	"dodo-lang/code"
+	"dodo-lang/token"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,16 +16,32 @@ import (
 type ObjectType string
 
 const (
-	INTEGER_OBJ      = "INTEGER"
-	BOOLEAN_OBJ      = "BOOLEAN"
-	STRING_OBJ       = "STRING"
-	ARRAY_OBJ        = "ARRAY"
-	HASHMAP_OBJ      = "HASHMAP"
-	FUNCTION_OBJ     = "FUNCTION"
-	BUILTIN_OBJ      = "BUILTIN"
-	RETURN_VALUE_OBJ = "RETURN_VALUE"
-	ERROR_OBJ        = "ERROR"
-	NULL_OBJ         = "NULL"
+	INTEGER_OBJ  = "INTEGER"
+	FLOAT_OBJ    = "FLOAT"
+	BOOLEAN_OBJ  = "BOOLEAN"
+	STRING_OBJ   = "STRING"
+	ARRAY_OBJ    = "ARRAY"
+	RANGE_OBJ    = "RANGE"
+	HASHMAP_OBJ  = "HASHMAP"
+	FUNCTION_OBJ = "FUNCTION"
+	BUILTIN_OBJ  = "BUILTIN"
+	MODULE_OBJ   = "MODULE"
+	STRUCT_OBJ   = "STRUCT"
+	ENUM_OBJ     = "ENUM"
+	VARIANT_OBJ  = "VARIANT"
+
+	ERROR_VALUE_OBJ = "ERROR_VALUE"
+
+	STRUCT_TYPE_OBJ = "STRUCT_TYPE"
+	ENUM_TYPE_OBJ   = "ENUM_TYPE"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	PATTERN_OBJ           = "PATTERN"
+	RETURN_VALUE_OBJ      = "RETURN_VALUE"
+	BREAK_OBJ             = "BREAK"
+	CONTINUE_OBJ          = "CONTINUE"
+	ERROR_OBJ             = "ERROR"
+	NULL_OBJ              = "NULL"
 )
 
 type Object interface {
@@ -36,6 +56,24 @@ type Integer struct {
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always includes a decimal point (or exponent) so floats with a
+// whole value can be told apart from integers, eg. 2.0 instead of 2
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+
+	return str
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -52,6 +90,8 @@ func (s *String) Inspect() string  { return s.Value }
 
 type Array struct {
 	Elements []Object
+
+	owned bool // Whether a single variable holds the array, see SetIndex
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -71,6 +111,64 @@ func (a *Array) Inspect() string {
 	return out.String()
 }
 
+// Range is the integers from Start up to End, only including End when
+// Inclusive is set. The values are produced when iterated over rather than
+// stored, so large ranges are cheap.
+type Range struct {
+	Start     int64
+	End       int64
+	Inclusive bool
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	if r.Inclusive {
+		return fmt.Sprintf("%d..=%d", r.Start, r.End)
+	}
+
+	return fmt.Sprintf("%d..%d", r.Start, r.End)
+}
+
+// Len returns the number of integers in the range, ranges that end before
+// they start are empty. When the number does not fit in an int64 it returns
+// math.MaxInt64 and false, which is still as far as a loop can count.
+func (r *Range) Len() (int64, bool) {
+	if r.End < r.Start || r.End == r.Start && !r.Inclusive {
+		return 0, true
+	}
+
+	// The difference always fits in an uint64, but adding one to it for an
+	// inclusive range of every int64 wraps around to 0
+	n := uint64(r.End) - uint64(r.Start)
+
+	if r.Inclusive {
+		n += 1
+	}
+
+	if n == 0 || n > math.MaxInt64 {
+		return math.MaxInt64, false
+	}
+
+	return int64(n), true
+}
+
+// At returns the i:th integer of the range
+func (r *Range) At(i int64) *Integer {
+	return &Integer{Value: r.Start + i}
+}
+
+// Module is an imported file, exposing its top-level bindings through Env, or
+// through Globals when it was compiled to bytecode
+type Module struct {
+	Name    string
+	Path    string
+	Env     *Environment
+	Globals map[string]int // Indexes of the globals of the virtual machine holding the bindings
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return fmt.Sprintf("module(%s)", m.Name) }
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
@@ -83,27 +181,76 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue are passed up from a break or continue statement to the
+// loop they refer to, like ReturnValue is passed up to the function
+type Break struct {
+	Label string // Label of the loop to leave, empty for the innermost loop
+}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct {
+	Label string // Label of the loop to continue, empty for the innermost loop
+}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+
 type Error struct {
 	Message string
+	Pos     token.Position // Where the error was raised, set by the evaluator
+	Thrown  Object         // The value of a throw statement, nil for errors raised by the runtime
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return fmt.Sprintf("ERROR: %s", e.Message) }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("ERROR: %s: %s", e.Pos, e.Message)
+	}
+
+	return fmt.Sprintf("ERROR: %s", e.Message)
+}
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // Evaluated in the function's environment when the argument is left out
+	Patterns   []ast.Pattern    // Patterns destructuring the arguments, nil for plain parameters
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
 
+// Default returns the default value of the i:th parameter, or nil if it has
+// none
+func (f *Function) Default(i int) ast.Expression {
+	if i >= len(f.Defaults) {
+		return nil
+	}
+
+	return f.Defaults[i]
+}
+
+func (f *Function) Signature() *Signature {
+	return NewSignature(f.Parameters, f.Defaults, f.Rest)
+}
+
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
 
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if def := f.Default(i); def != nil {
+			params = append(params, p.String()+" = "+def.String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -116,6 +263,31 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+type CompiledFunction struct {
+	Instructions code.Instructions
+	NumLocals    int
+	Signature    *Signature
+	Name         string
+	SourceMap    map[int]token.Position // Instruction offset -> position of the node it was compiled from
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is the virtual machine's counterpart to Function, it reports the
+// same type so that eg. typeof() behaves the same on both backends
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
 type BuiltinFunction func(args ...Object) Object
 
 type Builtin struct {
@@ -151,6 +323,10 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+func (f *Float) HashKey() HashKey {
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	// Small possibility exists that fnv generates the same hash for different strings
 	// with different content, resulting in a hash collision. This should be mitigated
@@ -168,10 +344,45 @@ type HashPair struct {
 
 type HashMap struct {
 	Pairs map[HashKey]HashPair
+
+	owned bool // Whether a single variable holds the hashmap, see SetIndex
 }
 
 func (hm *HashMap) Type() ObjectType { return HASHMAP_OBJ }
 
+// SortedPairs returns the pairs of the hashmap ordered by key, so iterating
+// over it is deterministic. Keys of different types are ordered by type name.
+func (hm *HashMap) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(hm.Pairs))
+
+	for _, pair := range hm.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+
+		switch a := a.(type) {
+		case *Integer:
+			return a.Value < b.(*Integer).Value
+		case *Float:
+			return a.Value < b.(*Float).Value
+		case *String:
+			return a.Value < b.(*String).Value
+		case *Boolean:
+			return !a.Value && b.(*Boolean).Value
+		}
+
+		return false
+	})
+
+	return pairs
+}
+
 func (hm *HashMap) Inspect() string {
 	var out bytes.Buffer
 
@@ -58,3 +58,62 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("strings with the different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	pi1 := &Float{Value: 3.14}
+	pi2 := &Float{Value: 3.14}
+	diff := &Float{Value: 2.71}
+
+	if pi1.HashKey() != pi2.HashKey() {
+		t.Errorf("floats with the same content have different hash keys")
+	}
+
+	if pi1.HashKey() == diff.HashKey() {
+		t.Errorf("floats with the different content have same hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong inspect output. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestSetIndexOwnership(t *testing.T) {
+	index := &Integer{Value: 0}
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+
+	first, _ := SetIndex(arr, index, &Integer{Value: 2})
+
+	if first == arr {
+		t.Fatalf("an array not owned by the variable was changed in place")
+	}
+
+	second, _ := SetIndex(first, index, &Integer{Value: 3})
+
+	if second != first {
+		t.Fatalf("an owned array was copied")
+	}
+
+	Share(second)
+
+	if third, _ := SetIndex(second, index, &Integer{Value: 4}); third == second {
+		t.Fatalf("a shared array was changed in place")
+	}
+
+	if arr.Elements[0].(*Integer).Value != 1 || second.(*Array).Elements[0].(*Integer).Value != 3 {
+		t.Errorf("a copied array was changed. got=%s and %s", arr.Inspect(), second.Inspect())
+	}
+}
@@ -0,0 +1,150 @@
+package object
+
+import (
+	"dodo-lang/ast"
+)
+
+// Pattern holds the pattern of a match arm among the constants of compiled
+// code, for the virtual machine to match values against
+type Pattern struct {
+	Node ast.Pattern
+}
+
+func (p *Pattern) Type() ObjectType { return PATTERN_OBJ }
+func (p *Pattern) Inspect() string  { return p.Node.String() }
+
+// Match matches value against pattern, calling bind for every identifier in
+// the pattern with the part of value it matched, in the order the identifiers
+// appear in the pattern. It returns an error describing the first part of
+// value that does not match, in which case some identifiers may already have
+// been bound.
+func Match(pattern ast.Pattern, value Object, bind func(name *ast.Identifier, value Object)) *Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			bind(pattern, value)
+		}
+
+		return nil
+	case *ast.LiteralPattern:
+		literal := literalValue(pattern.Value)
+
+		if !literalEqual(literal, value) {
+			return newError("%s does not match %s", value.Inspect(), literal.Inspect())
+		}
+
+		return nil
+	case *ast.ArrayPattern:
+		return matchArray(pattern, value, bind)
+	case *ast.HashPattern:
+		return matchHashMap(pattern, value, bind)
+	default:
+		return newError("unknown pattern %T", pattern)
+	}
+}
+
+func matchArray(pattern *ast.ArrayPattern, value Object, bind func(*ast.Identifier, Object)) *Error {
+	array, ok := value.(*Array)
+
+	if !ok {
+		return newError("expected ARRAY to match %s, got %s", pattern, value.Type())
+	}
+
+	switch {
+	case pattern.Rest == nil && len(array.Elements) != len(pattern.Elements):
+		return newError("expected an array of length %d to match %s, got length %d", len(pattern.Elements), pattern, len(array.Elements))
+	case len(array.Elements) < len(pattern.Elements):
+		return newError("expected an array of at least length %d to match %s, got length %d", len(pattern.Elements), pattern, len(array.Elements))
+	}
+
+	for i, el := range pattern.Elements {
+		if err := Match(el, array.Elements[i], bind); err != nil {
+			return err
+		}
+	}
+
+	if pattern.Rest != nil {
+		rest := make([]Object, len(array.Elements)-len(pattern.Elements))
+		copy(rest, array.Elements[len(pattern.Elements):])
+
+		return Match(pattern.Rest, &Array{Elements: rest}, bind)
+	}
+
+	return nil
+}
+
+func matchHashMap(pattern *ast.HashPattern, value Object, bind func(*ast.Identifier, Object)) *Error {
+	hashMap, ok := value.(*HashMap)
+
+	if !ok {
+		return newError("expected HASHMAP to match %s, got %s", pattern, value.Type())
+	}
+
+	for i, key := range pattern.Keys {
+		keyValue := literalValue(key)
+		pair, ok := hashMap.Pairs[keyValue.(Hashable).HashKey()]
+
+		if !ok {
+			return newError("missing key %s to match %s", keyValue.Inspect(), pattern)
+		}
+
+		if err := Match(pattern.Values[i], pair.Value, bind); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// literalValue converts a literal of a pattern, which the parser only allows
+// to be a number, string or boolean, into its value
+func literalValue(exp ast.Expression) Object {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return &Integer{Value: exp.Value}
+	case *ast.FloatLiteral:
+		return &Float{Value: exp.Value}
+	case *ast.StringLiteral:
+		return &String{Value: exp.Value}
+	case *ast.Boolean:
+		return &Boolean{Value: exp.Value}
+	case *ast.PrefixExpression:
+		switch right := literalValue(exp.Right).(type) {
+		case *Integer:
+			return &Integer{Value: -right.Value}
+		case *Float:
+			return &Float{Value: -right.Value}
+		}
+	}
+
+	return &Null{}
+}
+
+// literalEqual reports whether value is equal to a literal. Like the ==
+// operator, integers and floats with the same value are equal.
+func literalEqual(literal, value Object) bool {
+	switch literal := literal.(type) {
+	case *Integer:
+		switch value := value.(type) {
+		case *Integer:
+			return literal.Value == value.Value
+		case *Float:
+			return float64(literal.Value) == value.Value
+		}
+	case *Float:
+		switch value := value.(type) {
+		case *Integer:
+			return literal.Value == float64(value.Value)
+		case *Float:
+			return literal.Value == value.Value
+		}
+	case *String:
+		value, ok := value.(*String)
+		return ok && literal.Value == value.Value
+	case *Boolean:
+		value, ok := value.(*Boolean)
+		return ok && literal.Value == value.Value
+	}
+
+	return false
+}
@@ -0,0 +1,193 @@
+package object
+
+// Index converts an index into a position in a sequence of the given length,
+// where negative indices count from the end so -1 is the last element. It
+// reports false when the index is out of range.
+func Index(index, length int64) (int64, bool) {
+	if index < 0 {
+		index += length
+	}
+
+	return index, index >= 0 && index < length
+}
+
+// SetIndex returns an array, hashmap or record with the element at index set
+// to value. Arrays and hashmaps behave as values, so the original is copied
+// first unless it is owned by the variable assigned to. The copy is owned by
+// that variable until Share is called on it, and later assignments update it
+// in place.
+func SetIndex(obj, index, value Object) (Object, *Error) {
+	// The value can now be reached through the container as well
+	Share(value)
+
+	switch obj := obj.(type) {
+	case *Array:
+		idx, ok := index.(*Integer)
+
+		if !ok {
+			return nil, newError("type of %s cannot be used to index %s", index.Type(), obj.Type())
+		}
+
+		i, ok := Index(idx.Value, int64(len(obj.Elements)))
+
+		if !ok {
+			return nil, newError("index %d out of range for array of length %d", idx.Value, len(obj.Elements))
+		}
+
+		if !obj.owned {
+			elements := make([]Object, len(obj.Elements))
+			copy(elements, obj.Elements)
+			obj = &Array{Elements: elements, owned: true}
+		}
+
+		obj.Elements[i] = value
+
+		return obj, nil
+	case *HashMap:
+		key, ok := index.(Hashable)
+
+		if !ok {
+			return nil, newError("type of %s cannot be used as hash key", index.Type())
+		}
+
+		if !obj.owned {
+			pairs := make(map[HashKey]HashPair, len(obj.Pairs)+1)
+
+			for k, pair := range obj.Pairs {
+				pairs[k] = pair
+			}
+
+			obj = &HashMap{Pairs: pairs, owned: true}
+		}
+
+		obj.Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+
+		return obj, nil
+	case Record:
+		return obj.Set(index, value)
+	default:
+		return nil, newError("cannot assign to an index of %s", obj.Type())
+	}
+}
+
+// Share gives up the ownership of an array or hashmap made by SetIndex. It is
+// called whenever the value of a variable is read, as whatever it is read for
+// may hold on to it.
+func Share(obj Object) {
+	switch obj := obj.(type) {
+	case *Array:
+		obj.owned = false
+	case *HashMap:
+		obj.owned = false
+	}
+}
+
+// Slice picks the elements of an array or the characters of a string between
+// start and end, taking every step:th one
+func Slice(obj, start, end, step Object) (Object, *Error) {
+	switch obj := obj.(type) {
+	case *Array:
+		indices, err := SliceIndices(int64(len(obj.Elements)), start, end, step)
+
+		if err != nil {
+			return nil, err
+		}
+
+		elements := make([]Object, len(indices))
+
+		for i, idx := range indices {
+			elements[i] = obj.Elements[idx]
+		}
+
+		return &Array{Elements: elements}, nil
+	case *String:
+		chars := []rune(obj.Value)
+		indices, err := SliceIndices(int64(len(chars)), start, end, step)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sliced := make([]rune, len(indices))
+
+		for i, idx := range indices {
+			sliced[i] = chars[idx]
+		}
+
+		return &String{Value: string(sliced)}, nil
+	default:
+		return nil, newError("cannot slice %s", obj.Type())
+	}
+}
+
+// SliceIndices returns the positions picked out by slicing a sequence of the
+// given length with [start:end:step]. Bounds left out of the slice are nil or
+// null, negative bounds count from the end and bounds past either end are
+// clamped, so slicing never fails because of the length of the sequence.
+func SliceIndices(length int64, start, end, step Object) ([]int64, *Error) {
+	stepValue, err := sliceBound(step, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if stepValue == 0 {
+		return nil, newError("slice step cannot be zero")
+	}
+
+	// Going backwards the slice starts at the last element and may run all
+	// the way past the first one, which is position -1
+	lower, upper := int64(0), length
+
+	if stepValue < 0 {
+		lower, upper = -1, length-1
+	}
+
+	defaultStart, defaultEnd := lower, upper
+
+	if stepValue < 0 {
+		defaultStart, defaultEnd = upper, lower
+	}
+
+	startValue, err := sliceBound(start, defaultStart)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endValue, err := sliceBound(end, defaultEnd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	startValue = clampSliceBound(startValue, length, lower, upper, start)
+	endValue = clampSliceBound(endValue, length, lower, upper, end)
+
+	indices := []int64{}
+
+	for i := startValue; (stepValue > 0 && i < endValue) || (stepValue < 0 && i > endValue); i += stepValue {
+		indices = append(indices, i)
+	}
+
+	return indices, nil
+}
+
+func sliceBound(bound Object, defaultValue int64) (int64, *Error) {
+	switch bound := bound.(type) {
+	case nil, *Null:
+		return defaultValue, nil
+	case *Integer:
+		return bound.Value, nil
+	default:
+		return 0, newError("slice indices must be INTEGER, got %s", bound.Type())
+	}
+}
+
+func clampSliceBound(value, length, lower, upper int64, bound Object) int64 {
+	if _, ok := bound.(*Integer); ok && value < 0 {
+		value += length
+	}
+
+	return min(max(value, lower), upper)
+}
@@ -0,0 +1,122 @@
+package object
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// StructType is a struct declared with `struct Name { fields }`, which is
+// called like a function to construct values of it. Every field is a required
+// parameter of the constructor, so fields can be passed by position or name.
+type StructType struct {
+	Name      string
+	Signature *Signature
+	Methods   map[string]Object // Functions implemented for the struct by impl blocks
+}
+
+func NewStructType(name string, fields []string) *StructType {
+	return &StructType{
+		Name:      name,
+		Signature: &Signature{Parameters: fields, Required: len(fields)},
+		Methods:   map[string]Object{},
+	}
+}
+
+func (st *StructType) Type() ObjectType { return STRUCT_TYPE_OBJ }
+func (st *StructType) Inspect() string {
+	if len(st.Signature.Parameters) == 0 {
+		return fmt.Sprintf("struct %s {}", st.Name)
+	}
+
+	return fmt.Sprintf("struct %s { %s }", st.Name, strings.Join(st.Signature.Parameters, ", "))
+}
+
+// New constructs a value of the struct from the arguments of a call to it,
+// where the last len(names) arguments are passed by name
+func (st *StructType) New(args []Object, names []string) (*Struct, *Error) {
+	bound, err := st.Signature.Bind(args, names)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The arguments may be a slice of the stack of the virtual machine
+	fields := make([]Object, len(bound))
+	copy(fields, bound)
+
+	return &Struct{Definition: st, Fields: fields}, nil
+}
+
+// Struct is a value of a struct type, holding a value for each of its fields
+// in the order they were declared
+type Struct struct {
+	Definition *StructType
+	Fields     []Object
+}
+
+func (s *Struct) Type() ObjectType { return STRUCT_OBJ }
+func (s *Struct) Inspect() string {
+	fields := []string{}
+
+	for i, name := range s.Definition.Signature.Parameters {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, s.Fields[i].Inspect()))
+	}
+
+	return fmt.Sprintf("%s{%s}", s.Definition.Name, strings.Join(fields, ", "))
+}
+
+// Get returns the value of the field named by index, which dot access such as
+// `p.name` passes as a string
+func (s *Struct) Get(index Object) (Object, *Error) {
+	i, err := fieldIndex(s.Definition.Name, s.Definition.Signature.Parameters, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Fields[i], nil
+}
+
+// Set returns a copy of the struct with the field named by index set to value
+func (s *Struct) Set(index, value Object) (Object, *Error) {
+	i, err := fieldIndex(s.Definition.Name, s.Definition.Signature.Parameters, index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Object, len(s.Fields))
+	copy(fields, s.Fields)
+	fields[i] = value
+
+	return &Struct{Definition: s.Definition, Fields: fields}, nil
+}
+
+// Record is a value with named fields, such as a struct, a variant of an enum
+// or an error value. Dot access such as `p.name` picks out a field of a record
+// by its name, rather than evaluating the name as a variable. Like builtins,
+// Get returns nil for a field that is null.
+type Record interface {
+	Object
+	Get(index Object) (Object, *Error)
+	Set(index, value Object) (Object, *Error)
+}
+
+// fieldIndex returns the position of the field named by index among fields of
+// the record called owner
+func fieldIndex(owner string, fields []string, index Object) (int, *Error) {
+	name, ok := index.(*String)
+
+	if !ok {
+		return 0, newError("type of %s cannot be used to index %s", index.Type(), owner)
+	}
+
+	i := slices.Index(fields, name.Value)
+
+	if i < 0 {
+		return 0, newError("%s has no field '%s'", owner, name.Value)
+	}
+
+	return i, nil
+}
@@ -6,45 +6,79 @@ import (
 	"dodo-lang/token"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 const (
-	_ int = iota // Assings numbers 1-7 to the contants below (important: the order below denotes precedence)
+	_ int = iota // Assings increasing numbers to the contants below (important: the order below denotes precedence)
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // == (compare)
 	LESSGREATER // > or <
+	RANGE       // 1..10 or 1..=10
 	SUM         // + or -
 	PRODUCT     // * or /
 	PREFIX      // -1 or !ok
+	POWER       // 2 ** 3, binds tighter than prefix operators so -2 ** 2 is -(2 ** 2)
 	CALL        // myFunc()
 	PIPE        // |>
 	INDEX       // myArray[] or myArray.len
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.ASTERISK: PRODUCT,
-	token.SLASH:    PRODUCT,
-	token.LPAREN:   CALL, // Enables LPAREN as infix operator in function calls, eg. add(1, 2)
-	token.LBRACKET: INDEX,
-	token.PERIOD:   INDEX,
-	token.PIPE:     PIPE,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.RANGE:           RANGE,
+	token.RANGE_INCLUSIVE: RANGE,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.ASTERISK:        PRODUCT,
+	token.SLASH:           PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL, // Enables LPAREN as infix operator in function calls, eg. add(1, 2)
+	token.LBRACKET:        INDEX,
+	token.PERIOD:          INDEX,
+	token.PIPE:            PIPE,
+}
+
+// Precedence returns the binding power of an infix operator, or LOWEST for
+// tokens that are not operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
 }
 
 type Parser struct {
 	l *lexer.Lexer
 
-	errors []string
+	errors      []Error
+	lexerErrors int // Number of lexer errors already added to errors
 
 	currToken token.Token
 	peekToken token.Token
 
+	// Labels of the loops enclosing the current token, innermost last, with
+	// "" for unlabeled loops. Function bodies start without loops.
+	loops []string
+	label *ast.Identifier // Label read for the loop about to be parsed
+
+	// Whether the current token is in a finally block, which break, continue
+	// and return cannot leave
+	finally bool
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -54,17 +88,30 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// Error is a parse error together with the position it was found at
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []Error{},
 	}
 
 	// Prefix parse functions
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -72,6 +119,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FOR, p.parseForExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LCURLY, p.parseHashLiteral)
@@ -87,6 +136,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseInfixExpression)
+	p.registerInfix(token.RANGE_INCLUSIVE, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.PERIOD, p.parseDotExpression)
@@ -100,9 +157,25 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 func (p *Parser) Errors() []string {
+	errors := make([]string, 0, len(p.errors))
+
+	for _, err := range p.errors {
+		errors = append(errors, err.String())
+	}
+
+	return errors
+}
+
+// ErrorList returns the errors with their positions kept apart from the
+// messages, for tooling that needs to point at them (eg. the language server)
+func (p *Parser) ErrorList() []Error {
 	return p.errors
 }
 
+func (p *Parser) addError(pos token.Position, format string, a ...any) {
+	p.errors = append(p.errors, Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -114,11 +187,17 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// Errors found by the lexer are reported along with the parser's own
+	for _, err := range p.l.Errors()[p.lexerErrors:] {
+		p.addError(err.Pos, "%s", err.Message)
+	}
+
+	p.lexerErrors = len(p.l.Errors())
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -138,8 +217,7 @@ func (p *Parser) currPrecedence() int {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.currToken.Pos, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -169,16 +247,40 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.STRUCT:
+		return p.parseStructStatement()
+	case token.IMPL:
+		return p.parseImplStatement()
+	case token.ENUM:
+		return p.parseEnumStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 	case token.IDENT:
-		if p.peekTokenIs(token.ASSIGN) {
-			return p.parseReassignmentStatement()
+		if p.peekTokenIs(token.COLON) {
+			return p.parseLabeledLoop()
 		}
 		fallthrough
 	default:
-		return p.parseExpressionStatement()
+		return p.parseSimpleStatement()
 	}
 }
 
+// parseSimpleStatement parses an expression statement, or a reassignment when
+// the expression is followed by = or a compound assignment operator
+func (p *Parser) parseSimpleStatement() ast.Statement {
+	stmt := p.parseExpressionStatement()
+
+	if stmt.Expression == nil || !token.IsAssign(p.peekToken.Type) {
+		return stmt
+	}
+
+	return p.parseReassignmentStatement(stmt.Expression)
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currToken}
 
@@ -187,12 +289,20 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		p.nextToken()
 	}
 
-	if !p.expectPeek(token.IDENT) {
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LCURLY) {
+		p.nextToken()
+
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+
+		p.checkPatternBindings(stmt.Pattern)
+	} else if !p.expectPeek(token.IDENT) {
 		return nil
+	} else {
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -201,6 +311,10 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -208,9 +322,14 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.currToken}
 
+	if p.finally {
+		p.addError(stmt.Token.Pos, "return cannot leave a finally block")
+		return nil
+	}
+
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
@@ -222,10 +341,14 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.currToken}
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.currToken}
 
-	stmt.Expression = p.parseExpression(LOWEST)
+	p.nextToken()
+
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -234,252 +357,959 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpression(precedence int) ast.Expression {
-	prefix := p.prefixParseFns[p.currToken.Type]
+// parseLoopControlStatement parses break and continue, which are only allowed
+// inside of loops
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.currToken
 
-	if prefix == nil {
-		p.noPrefixParseFnError(p.currToken.Type)
-		return nil
+	var label *ast.Identifier
+
+	if p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		label = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 	}
 
-	leftExp := prefix()
+	if len(p.loops) == 0 && p.finally {
+		p.addError(tok.Pos, "%s cannot leave a finally block", tok.Literal)
+		return nil
+	}
 
-	for precedence < p.peekPrecedence() && !p.peekTokenIs(token.SEMICOLON) {
-		infix := p.infixParseFns[p.peekToken.Type]
+	if len(p.loops) == 0 {
+		p.addError(tok.Pos, "%s outside of a loop", tok.Literal)
+		return nil
+	}
 
-		if infix == nil {
-			return leftExp
-		}
+	if label != nil && !p.inLoop(label.Value) {
+		p.addError(label.Pos(), "undefined loop label '%s'", label.Value)
+		return nil
+	}
 
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
+	}
 
-		leftExp = infix(leftExp)
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok, Label: label}
 	}
 
-	return leftExp
+	return &ast.ContinueStatement{Token: tok, Label: label}
 }
 
-func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{Token: p.currToken}
+// parseLabeledLoop parses a loop with a label in front of it, eg.
+// `outer: for (...) {...}`, for break and continue to refer to
+func (p *Parser) parseLabeledLoop() ast.Statement {
+	labelToken := p.currToken
+	label := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+	p.nextToken()
 
-	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+	if !p.expectPeek(token.FOR) {
 		return nil
 	}
 
-	lit.Value = value
+	if p.inLoop(label.Value) {
+		p.addError(label.Pos(), "loop label '%s' is already in use", label.Value)
+		return nil
+	}
 
-	return lit
-}
+	p.label = label
 
-func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
-}
+	stmt := p.parseExpressionStatement()
+	stmt.Token = labelToken
 
-func (p *Parser) parseDollarLiteral() ast.Expression {
-	return &ast.DollarLiteral{Token: p.currToken}
+	return stmt
 }
 
-func (p *Parser) parseArrayLiteral() ast.Expression {
-	exp := &ast.ArrayLiteral{Token: p.currToken}
-	exp.Elements = p.parseExpressionList(token.RBRACKET, token.COMMA, nil)
-	return exp
+func (p *Parser) inLoop(label string) bool {
+	for _, l := range p.loops {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (p *Parser) parseHashLiteral() ast.Expression {
-	lit := &ast.HashLiteral{Token: p.currToken}
-	lit.Pairs = make(map[ast.Expression]ast.Expression)
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currToken}
 
-	for !p.peekTokenIs(token.RCURLY) {
-		p.nextToken()
-		key := p.parseExpression(LOWEST)
+	p.nextToken()
 
-		if !p.expectPeek(token.COLON) {
-			return nil
-		}
+	switch p.currToken.Type {
+	case token.IDENT:
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		stmt.Path = p.currToken.Literal + ".dodo"
+	case token.STRING:
+		// The module is named after the file, eg. "lib/math.dodo" becomes math
+		base := filepath.Base(p.currToken.Literal)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: name}
+		stmt.Path = p.currToken.Literal
+	default:
+		p.addError(p.currToken.Pos, "expected module path or name after import, got %s instead", p.currToken.Type)
+		return nil
+	}
 
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
-		value := p.parseExpression(LOWEST)
+	}
 
-		lit.Pairs[key] = value
+	return stmt
+}
 
-		if !p.peekTokenIs(token.RCURLY) && !p.expectPeek(token.COMMA) {
-			return nil
-		}
-	}
+// parseStructStatement parses `struct Name { field, ... }`, where the fields
+// may be followed by a trailing comma
+func (p *Parser) parseStructStatement() ast.Statement {
+	stmt := &ast.StructStatement{Token: p.currToken}
 
-	if !p.expectPeek(token.RCURLY) {
+	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
-	return lit
-}
-
-func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
-
-	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-	exp.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
 
-	if !p.expectPeek(token.RBRACKET) {
+	if stmt.Fields = p.parseFields(token.RCURLY, "struct "+stmt.Name.Value); stmt.Fields == nil {
 		return nil
 	}
 
-	return exp
-}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 
-func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
-	initTok := p.currToken
+	return stmt
+}
 
-	p.nextToken()
+// parseEnumStatement parses `enum Name { Variant, Variant(field, ...), ... }`,
+// where the variants may be followed by a trailing comma
+func (p *Parser) parseEnumStatement() ast.Statement {
+	stmt := &ast.EnumStatement{Token: p.currToken, Variants: []*ast.EnumVariant{}}
 
-	// Is function call
-	if p.currTokenIs(token.IDENT) && p.peekTokenIs(token.LPAREN) {
-		exp := &ast.CallExpression{Token: initTok}
-		exp.Function = p.parseIdentifier()
-		p.nextToken()
-		exp.Arguments = []ast.Expression{left}
-		exp.Arguments = append(exp.Arguments, p.parseExpressionList(token.RPAREN, token.COMMA, nil)...)
-		return exp
+	if !p.expectPeek(token.IDENT) {
+		return nil
 	}
 
-	exp := &ast.IndexExpression{Token: initTok, Left: left}
-	exp.Index = p.parseExpression(LOWEST)
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-	return exp
-}
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
 
-func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
-	// Pipe expressions are parsed into the result of the expression to the
-	// left of the pipe and placed instead of the dollar sign
+	seen := map[string]bool{}
 
-	// TODO: Make pipe expressions work for other expressions than function calls?
+	for !p.peekTokenIs(token.RCURLY) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	exp := &ast.CallExpression{Token: p.currToken}
+		variant := &ast.EnumVariant{Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
 
-	precendence := p.currPrecedence()
-	p.nextToken()
-	exp.Function = p.parseExpression(precendence)
-	p.expectPeek(token.LPAREN)
-	exp.Arguments = p.parseExpressionList(token.RPAREN, token.COMMA, left)
+		if seen[variant.Name.Value] {
+			p.addError(variant.Name.Token.Pos, "variant '%s' is declared more than once in enum %s", variant.Name.Value, stmt.Name.Value)
+		}
 
-	return exp
-}
+		seen[variant.Name.Value] = true
 
-func (p *Parser) parseExpressionList(end token.TokenType, separator token.TokenType, placeholderReplacement ast.Expression) []ast.Expression {
-	elements := []ast.Expression{}
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
 
-	if p.peekTokenIs(end) {
-		p.nextToken()
-		return elements
-	}
+			if variant.Fields = p.parseFields(token.RPAREN, "variant "+variant.Name.Value); variant.Fields == nil {
+				return nil
+			}
+		}
 
-	p.nextToken()
+		stmt.Variants = append(stmt.Variants, variant)
 
-	if placeholderReplacement != nil && p.currTokenIs(token.DOLLAR) {
-		elements = append(elements, placeholderReplacement)
-	} else {
-		elements = append(elements, p.parseExpression(LOWEST))
-	}
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 
-	for p.peekTokenIs(separator) {
 		p.nextToken()
-		p.nextToken()
-
-		if placeholderReplacement != nil && p.currTokenIs(token.DOLLAR) {
-			elements = append(elements, placeholderReplacement)
-		} else {
-			elements = append(elements, p.parseExpression(LOWEST))
-		}
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectPeek(token.RCURLY) {
 		return nil
 	}
 
-	return elements
-}
-
-func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{Token: p.currToken, Operator: p.currToken.Literal}
-
-	p.nextToken()
-
-	expression.Right = p.parseExpression(PREFIX)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 
-	return expression
+	return stmt
 }
 
-func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	expression := &ast.InfixExpression{
-		Token:    p.currToken,
-		Operator: p.currToken.Literal,
-		Left:     left,
-	}
+// parseFields parses the comma separated field names of a struct or variant
+// up to end, allowing a trailing comma. It returns nil if they fail to parse.
+func (p *Parser) parseFields(end token.TokenType, owner string) []*ast.Identifier {
+	fields := []*ast.Identifier{}
+	seen := map[string]bool{}
 
-	precendence := p.currPrecedence()
-	p.nextToken()
-	expression.Right = p.parseExpression(precendence)
+	for !p.peekTokenIs(end) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	return expression
-}
+		field := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
 
-func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Token: p.currToken, Value: p.currTokenIs(token.TRUE)}
-}
+		if seen[field.Value] {
+			p.addError(field.Token.Pos, "field '%s' is declared more than once in %s", field.Value, owner)
+		}
 
-func (p *Parser) parseGroupedExpression() ast.Expression {
-	p.nextToken()
+		seen[field.Value] = true
+		fields = append(fields, field)
 
-	exp := p.parseExpression(LOWEST)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		p.nextToken()
 	}
 
-	return exp
-}
-
-func (p *Parser) parseIfExpression() ast.Expression {
-	expression := &ast.IfExpression{Token: p.currToken}
-
-	if !p.expectPeek(token.LPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	p.nextToken()
+	return fields
+}
 
-	expression.Condition = p.parseExpression(LOWEST)
+// parseImplStatement parses `impl Name { fn method(self, ...) { ... } ... }`,
+// where every method takes the receiver as its first parameter, named self
+func (p *Parser) parseImplStatement() ast.Statement {
+	stmt := &ast.ImplStatement{Token: p.currToken, Methods: []*ast.FunctionLiteral{}}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
 
+	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
 	if !p.expectPeek(token.LCURLY) {
 		return nil
 	}
 
-	expression.Consequence = p.parseBlockStatement()
+	seen := map[string]bool{}
 
-	if p.peekTokenIs(token.ELSE) {
-		p.nextToken()
+	for !p.peekTokenIs(token.RCURLY) {
+		if !p.expectPeek(token.FUNCTION) {
+			return nil
+		}
 
-		if !p.expectPeek(token.LCURLY) {
+		method := &ast.FunctionLiteral{Token: p.currToken}
+
+		if !p.expectPeek(token.IDENT) {
 			return nil
 		}
 
-		expression.Alternative = p.parseBlockStatement()
-	}
+		name := p.currToken
+		method.Name = name.Literal
 
-	return expression
+		if seen[method.Name] {
+			p.addError(name.Pos, "method '%s' is defined more than once for %s", method.Name, stmt.Name.Value)
+		}
+
+		seen[method.Name] = true
+
+		if !p.parseFunction(method) {
+			return nil
+		}
+
+		if len(method.Parameters) == 0 || method.Parameters[0].Value != "self" {
+			p.addError(name.Pos, "method '%s' must take self as its first parameter", method.Name)
+		}
+
+		stmt.Methods = append(stmt.Methods, method)
+	}
+
+	p.nextToken()
+
+	return stmt
+}
+
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	stmt := &ast.ExpressionStatement{Token: p.currToken}
+
+	stmt.Expression = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExpression(precedence int) ast.Expression {
+	prefix := p.prefixParseFns[p.currToken.Type]
+
+	if prefix == nil {
+		p.noPrefixParseFnError(p.currToken.Type)
+		return nil
+	}
+
+	leftExp := prefix()
+
+	for precedence < p.peekPrecedence() && !p.peekTokenIs(token.SEMICOLON) {
+		infix := p.infixParseFns[p.peekToken.Type]
+
+		if infix == nil {
+			return leftExp
+		}
+
+		p.nextToken()
+
+		leftExp = infix(leftExp)
+	}
+
+	return leftExp
+}
+
+func (p *Parser) parseIntegerLiteral() ast.Expression {
+	lit := &ast.IntegerLiteral{Token: p.currToken}
+
+	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+
+	if err != nil {
+		p.addError(p.currToken.Pos, "could not parse %q as integer", p.currToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currToken}
+
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
+
+	if err != nil {
+		p.addError(p.currToken.Pos, "could not parse %q as float", p.currToken.Literal)
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+}
+
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currToken}
+
+	for _, part := range lexer.SplitTemplate(p.currToken) {
+		if !part.IsExpression {
+			tok := token.Token{Type: token.TEMPLATE, Literal: part.Text, Pos: part.Pos}
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: tok, Value: part.Text})
+			continue
+		}
+
+		// Embedded expressions are parsed on their own, keeping their
+		// positions in the template
+		sub := New(lexer.NewAt(part.Expression, part.Pos))
+
+		if sub.currTokenIs(token.EOF) {
+			p.addError(part.Pos, "expected expression in string interpolation")
+			continue
+		}
+
+		exp := sub.parseExpression(LOWEST)
+
+		if !sub.peekTokenIs(token.EOF) {
+			sub.addError(sub.peekToken.Pos, "unexpected %s in string interpolation", sub.peekToken.Type)
+		}
+
+		p.errors = append(p.errors, sub.errors...)
+
+		if exp != nil {
+			str.Parts = append(str.Parts, exp)
+		}
+	}
+
+	return str
+}
+
+func (p *Parser) parseDollarLiteral() ast.Expression {
+	return &ast.DollarLiteral{Token: p.currToken}
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	exp := &ast.ArrayLiteral{Token: p.currToken}
+	exp.Elements = p.parseExpressionList(token.RBRACKET, token.COMMA)
+	exp.End = p.currToken.Pos
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	lit := &ast.HashLiteral{Token: p.currToken}
+	lit.Pairs = make(map[ast.Expression]ast.Expression)
+	lit.Keys = []ast.Expression{}
+
+	for !p.peekTokenIs(token.RCURLY) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		lit.Pairs[key] = value
+		lit.Keys = append(lit.Keys, key)
+
+		if !p.peekTokenIs(token.RCURLY) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RCURLY) {
+		return nil
+	}
+
+	lit.End = p.currToken.Pos
+
+	return lit
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.currToken
+
+	var index ast.Expression
+
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	if index == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+// parseSliceExpression parses the rest of a slice after its start bound, with
+// the current token being the last one before the first colon
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	p.nextToken()
+
+	if !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.Step = p.parseExpression(LOWEST)
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	initTok := p.currToken
+
+	p.nextToken()
+
+	// Is function call
+	if p.currTokenIs(token.IDENT) && p.peekTokenIs(token.LPAREN) {
+		exp := &ast.CallExpression{Token: initTok}
+		exp.Function = p.parseIdentifier()
+		p.nextToken()
+		exp.Arguments = []ast.Expression{left}
+		exp.Arguments = append(exp.Arguments, p.parseCallArguments(nil)...)
+		return exp
+	}
+
+	exp := &ast.IndexExpression{Token: initTok, Left: left}
+
+	// A name after the dot is a field, binding as tightly as an index so that
+	// `a.b + 1` adds to a.b and `a.b.c` is (a.b).c, whereas any other index is
+	// a whole expression, eg. `a.1 + 1` is a[2]
+	if p.currTokenIs(token.IDENT) {
+		exp.Index = p.parseIdentifier()
+	} else {
+		exp.Index = p.parseExpression(LOWEST)
+	}
+
+	return exp
+}
+
+func (p *Parser) parsePipeExpression(left ast.Expression) ast.Expression {
+	// Pipe expressions are parsed into the result of the expression to the
+	// left of the pipe and placed instead of the dollar sign
+
+	// TODO: Make pipe expressions work for other expressions than function calls?
+
+	exp := &ast.CallExpression{Token: p.currToken, Piped: left}
+
+	precendence := p.currPrecedence()
+	p.nextToken()
+	exp.Function = p.parseExpression(precendence)
+	p.expectPeek(token.LPAREN)
+	exp.Arguments = p.parseCallArguments(left)
+
+	return exp
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType, separator token.TokenType) []ast.Expression {
+	elements := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return elements
+	}
+
+	p.nextToken()
+	elements = append(elements, p.parseExpression(LOWEST))
+
+	for p.peekTokenIs(separator) {
+		p.nextToken()
+		p.nextToken()
+		elements = append(elements, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return elements
+}
+
+// parseCallArguments parses the arguments of a call up to the closing
+// parenthesis. Named arguments like `y: 2` may follow the positional ones.
+func (p *Parser) parseCallArguments(placeholderReplacement ast.Expression) []ast.Expression {
+	args := []ast.Expression{}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return args
+	}
+
+	named := false
+
+	for {
+		p.nextToken()
+
+		if p.currTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+			arg := &ast.NamedArgument{Token: p.currToken, Name: &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}}
+
+			p.nextToken()
+			p.nextToken()
+
+			arg.Value = p.parseArgument(placeholderReplacement)
+			args = append(args, arg)
+			named = true
+		} else {
+			if named {
+				p.addError(p.currToken.Pos, "positional argument cannot follow named arguments")
+			}
+
+			args = append(args, p.parseArgument(placeholderReplacement))
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return args
+}
+
+func (p *Parser) parseArgument(placeholderReplacement ast.Expression) ast.Expression {
+	if placeholderReplacement != nil && p.currTokenIs(token.DOLLAR) {
+		return placeholderReplacement
+	}
+
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{Token: p.currToken, Operator: p.currToken.Literal}
+
+	p.nextToken()
+
+	expression.Right = p.parseExpression(PREFIX)
+
+	return expression
+}
+
+func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	expression := &ast.InfixExpression{
+		Token:    p.currToken,
+		Operator: p.currToken.Literal,
+		Left:     left,
+	}
+
+	precendence := p.currPrecedence()
+
+	// ** is right-associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+	if p.currTokenIs(token.POWER) {
+		precendence -= 1
+	}
+
+	p.nextToken()
+	expression.Right = p.parseExpression(precendence)
+
+	return expression
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	return &ast.Boolean{Token: p.currToken, Value: p.currTokenIs(token.TRUE)}
+}
+
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	p.nextToken()
+
+	exp := p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseIfExpression() ast.Expression {
+	expression := &ast.IfExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	expression.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	expression.Consequence = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+
+		// `else if` is an alternative holding just the next if
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+
+			block := &ast.BlockStatement{Token: p.currToken}
+			next := p.parseIfExpression()
+
+			if next == nil {
+				return nil
+			}
+
+			block.Statements = []ast.Statement{&ast.ExpressionStatement{Token: block.Token, Expression: next}}
+			block.End = p.currToken.Pos
+			expression.Alternative = block
+
+			return expression
+		}
+
+		if !p.expectPeek(token.LCURLY) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+	}
+
+	return expression
+}
+
+// parseTryExpression parses `try {...} catch (e) {...} finally {...}`, where
+// either the catch or the finally block may be left out
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	expression.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		expression.Param = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LCURLY) {
+			return nil
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LCURLY) {
+			return nil
+		}
+
+		// Loops around the try cannot be left from the finally block
+		loops, finally := p.loops, p.finally
+		p.loops, p.finally = nil, true
+		expression.Finally = p.parseBlockStatement()
+		p.loops, p.finally = loops, finally
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.addError(p.peekToken.Pos, "expected catch or finally after try block, got %s instead", p.peekToken.Type)
+		return nil
+	}
+
+	return expression
+}
+
+// parseMatchExpression parses `match subject { pattern => body, ... }`, where
+// the comma after an arm with a block body may be left out
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.currToken}
+
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RCURLY) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+
+		if arm == nil {
+			return nil
+		}
+
+		exp.Arms = append(exp.Arms, arm)
+
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		} else if arm.Body.Token.Type != token.LCURLY {
+			break
+		}
+	}
+
+	if !p.expectPeek(token.RCURLY) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.currToken}
+	arm.Pattern = p.parsePattern()
+
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	p.checkPatternBindings(arm.Pattern)
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.FAT_ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+
+	if p.currTokenIs(token.LCURLY) {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	tok := p.currToken
+	body := p.parseExpression(LOWEST)
+
+	arm.Body = &ast.BlockStatement{
+		Token:      tok,
+		Statements: []ast.Statement{&ast.ExpressionStatement{Token: tok, Expression: body}},
+		End:        p.currToken.Pos,
+	}
+
+	return arm
+}
+
+// parsePattern parses a pattern: an identifier binding the value, the
+// wildcard _, a literal, or an array or hashmap pattern destructuring the
+// value into further patterns
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	case token.INT, token.FLOAT, token.STRING, token.RAW_STRING, token.TRUE, token.FALSE:
+		return &ast.LiteralPattern{Token: p.currToken, Value: p.prefixParseFns[p.currToken.Type]()}
+	case token.MINUS:
+		pattern := &ast.LiteralPattern{Token: p.currToken}
+		prefix := &ast.PrefixExpression{Token: p.currToken, Operator: "-"}
+
+		if !p.peekTokenIs(token.INT) && !p.peekTokenIs(token.FLOAT) {
+			p.addError(p.peekToken.Pos, "expected number after - in pattern, got %s", p.peekToken.Type)
+			return nil
+		}
+
+		p.nextToken()
+		prefix.Right = p.prefixParseFns[p.currToken.Type]()
+		pattern.Value = prefix
+
+		return pattern
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LCURLY:
+		return p.parseHashPattern()
+	default:
+		p.addError(p.currToken.Pos, "unexpected %s in pattern", p.currToken.Type)
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		// The rest pattern has to be the last one
+		if p.currTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+
+			pattern.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+			break
+		}
+
+		el := p.parsePattern()
+
+		if el == nil {
+			return nil
+		}
+
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RCURLY) {
+		p.nextToken()
+
+		switch p.currToken.Type {
+		case token.INT, token.STRING, token.RAW_STRING, token.TRUE, token.FALSE:
+			pattern.Keys = append(pattern.Keys, p.prefixParseFns[p.currToken.Type]())
+		default:
+			p.addError(p.currToken.Pos, "hashmap pattern keys must be literals, got %s", p.currToken.Type)
+			return nil
+		}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+
+		value := p.parsePattern()
+
+		if value == nil {
+			return nil
+		}
+
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RCURLY) {
+		return nil
+	}
+
+	return pattern
+}
+
+// checkPatternBindings reports identifiers bound more than once by a pattern
+func (p *Parser) checkPatternBindings(pattern ast.Pattern) {
+	seen := map[string]bool{}
+
+	for _, ident := range ast.PatternBindings(pattern) {
+		if seen[ident.Value] {
+			p.addError(ident.Token.Pos, "identifier '%s' is bound more than once in the pattern", ident.Value)
+		}
+
+		seen[ident.Value] = true
+	}
 }
 
 func (p *Parser) parseForExpression() ast.Expression {
-	exp := &ast.ForExpression{Token: p.currToken}
+	tok := p.currToken
+	label := p.label
+	p.label = nil
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -487,6 +1317,15 @@ func (p *Parser) parseForExpression() ast.Expression {
 
 	p.nextToken()
 
+	switch {
+	case p.currTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)):
+		return p.parseForInExpression(tok, label)
+	case p.currTokenIs(token.LET) || p.currTokenIs(token.SEMICOLON) ||
+		p.currTokenIs(token.IDENT) && token.IsAssign(p.peekToken.Type):
+		return p.parseThreeClauseFor(tok, label)
+	}
+
+	exp := &ast.ForExpression{Token: tok, Label: label}
 	exp.Condition = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
@@ -497,11 +1336,122 @@ func (p *Parser) parseForExpression() ast.Expression {
 		return nil
 	}
 
-	exp.Body = p.parseBlockStatement()
+	exp.Body = p.parseLoopBody(label)
+
+	return exp
+}
+
+// parseThreeClauseFor parses `for (init; condition; post) {...}`, starting at
+// the init clause or the ; in its place
+func (p *Parser) parseThreeClauseFor(tok token.Token, label *ast.Identifier) ast.Expression {
+	exp := &ast.ForExpression{Token: tok, Label: label}
+
+	if !p.currTokenIs(token.SEMICOLON) {
+		if p.currTokenIs(token.LET) {
+			if init := p.parseLetStatement(); init != nil {
+				exp.Init = init
+			}
+		} else if init := p.parseSimpleStatement(); init != nil {
+			exp.Init = init
+		}
+
+		if exp.Init == nil {
+			return nil
+		}
+
+		if !p.currTokenIs(token.SEMICOLON) {
+			p.addError(p.peekToken.Pos, "expected ; after the init clause of for, got %s instead", p.peekToken.Type)
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		exp.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+
+		if post := p.parseSimpleStatement(); post != nil {
+			exp.Post = post
+		}
+
+		if exp.Post == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	exp.Body = p.parseLoopBody(label)
+
+	return exp
+}
+
+// parseForInExpression parses `for (x in iterable) {...}` and
+// `for (k, v in iterable) {...}`, starting at the first variable
+func (p *Parser) parseForInExpression(tok token.Token, label *ast.Identifier) ast.Expression {
+	exp := &ast.ForInExpression{Token: tok, Label: label}
+	exp.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+
+		exp.Key = exp.Value
+		exp.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LCURLY) {
+		return nil
+	}
+
+	exp.Body = p.parseLoopBody(label)
 
 	return exp
 }
 
+// parseLoopBody parses the body of a loop, where break and continue refer to
+// it
+func (p *Parser) parseLoopBody(label *ast.Identifier) *ast.BlockStatement {
+	name := ""
+
+	if label != nil {
+		name = label.Value
+	}
+
+	p.loops = append(p.loops, name)
+	body := p.parseBlockStatement()
+	p.loops = p.loops[:len(p.loops)-1]
+
+	return body
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 	block.Statements = []ast.Statement{}
@@ -518,80 +1468,149 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	block.End = p.currToken.Pos
+
 	return block
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.currToken}
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.parseFunction(lit) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	return lit
+}
+
+// parseFunction parses the parameters and body of a function, starting at the
+// token before the opening parenthesis
+func (p *Parser) parseFunction(lit *ast.FunctionLiteral) bool {
+	if !p.expectPeek(token.LPAREN) {
+		return false
+	}
+
+	if !p.parseFunctionParameters(lit) {
+		return false
+	}
 
 	if !p.expectPeek(token.LCURLY) {
-		return nil
+		return false
 	}
 
+	// Loops around the function cannot be left from within it, and neither
+	// can a finally block it is in
+	loops, finally := p.loops, p.finally
+	p.loops, p.finally = nil, false
 	lit.Body = p.parseBlockStatement()
+	p.loops, p.finally = loops, finally
 
-	return lit
+	return true
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionParameters parses the parameters of lit: names or array and
+// hashmap patterns destructuring the argument, each optionally with a default
+// value like `y = 10`, and a rest parameter like `...rest`, which has to be
+// the last one
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
-
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-	identifiers = append(identifiers, ident)
+	hasDefaults := false
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+	for {
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		if p.currTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+
+			lit.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+			return p.expectPeek(token.RPAREN)
+		}
+
+		var ident *ast.Identifier
+		var pattern ast.Pattern
+
+		switch p.currToken.Type {
+		case token.IDENT:
+			ident = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		case token.LBRACKET, token.LCURLY:
+			// The parameter is named after the pattern, which cannot clash
+			// with any identifier
+			tok := p.currToken
+
+			if pattern = p.parsePattern(); pattern == nil {
+				return false
+			}
+
+			p.checkPatternBindings(pattern)
+			ident = &ast.Identifier{Token: tok, Value: pattern.String()}
+		default:
+			p.addError(p.currToken.Pos, "expected parameter name, got %s", p.currToken.Type)
+			return false
+		}
+
+		var def ast.Expression
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+
+			def = p.parseExpression(LOWEST)
+			hasDefaults = true
+		} else if hasDefaults {
+			p.addError(ident.Token.Pos, "parameter '%s' without a default value follows one with a default value", ident.Value)
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Defaults = append(lit.Defaults, def)
+		lit.Patterns = append(lit.Patterns, pattern)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+
+		p.nextToken()
 	}
 
-	return identifiers
+	return p.expectPeek(token.RPAREN)
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN, token.COMMA, nil)
+	exp.Arguments = p.parseCallArguments(nil)
 	return exp
 }
 
-func (p *Parser) parseReassignmentStatement() *ast.ReassignmentStatement {
-	identExp := p.parseIdentifier()
+// parseReassignmentStatement parses the rest of a reassignment to target,
+// with the assignment operator as the next token
+func (p *Parser) parseReassignmentStatement(target ast.Expression) ast.Statement {
+	p.nextToken()
 
-	ident, ok := identExp.(*ast.Identifier)
+	stmt := &ast.ReassignmentStatement{Token: p.currToken, Target: target}
 
-	if !ok {
+	if stmt.Root() == nil {
+		p.addError(target.Pos(), "cannot assign to %s", target)
 		return nil
 	}
 
-	p.expectPeek(token.ASSIGN)
-
-	stmt := &ast.ReassignmentStatement{Token: p.currToken, Ident: ident}
-
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
 
 	stmt.Value = exp
 
-	p.nextToken()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 
 	return stmt
 }
@@ -615,17 +1634,11 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) PrintParserErrors(out io.Writer) {
-	for _, msg := range p.errors {
+	for _, msg := range p.Errors() {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
 
 func (p *Parser) GetParserErrors() []string {
-	var errors []string
-
-	for _, msg := range p.errors {
-		errors = append(errors, msg)
-	}
-
-	return errors
+	return p.Errors()
 }
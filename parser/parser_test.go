@@ -5,6 +5,7 @@ import (
 	"dodo-lang/lexer"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -119,6 +120,49 @@ func TestReassignmentStatements(t *testing.T) {
 	}
 }
 
+func TestAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		operator string
+		root     string
+	}{
+		{"x += 1;", "x += 1;", "+", "x"},
+		{"x -= y * 2;", "x -= (y * 2);", "-", "x"},
+		{"x *= 2;", "x *= 2;", "*", "x"},
+		{"x /= 2;", "x /= 2;", "/", "x"},
+		{"arr[0] = 5;", "(arr[0]) = 5;", "", "arr"},
+		{`m["k"] += v;`, "(m[k]) += v;", "+", "m"},
+		{"obj.field = v;", "(obj[field]) = v;", "", "obj"},
+		{"grid[i][j] = 0;", "((grid[i])[j]) = 0;", "", "grid"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ReassignmentStatement)
+
+		if !ok {
+			t.Fatalf("stmt is not *ast.ReassignmentStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("wrong statement. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+
+		if stmt.Operator() != tt.operator {
+			t.Errorf("wrong operator. expected=%q, got=%q", tt.operator, stmt.Operator())
+		}
+
+		if stmt.Root().Value != tt.root {
+			t.Errorf("wrong root. expected=%q, got=%q", tt.root, stmt.Root().Value)
+		}
+	}
+}
+
 func testReassignmentStatement(t *testing.T, s ast.Statement, ident string) bool {
 	reassignStmt, ok := s.(*ast.ReassignmentStatement)
 
@@ -132,17 +176,7 @@ func testReassignmentStatement(t *testing.T, s ast.Statement, ident string) bool
 		return false
 	}
 
-	if reassignStmt.Ident.Value != ident {
-		t.Errorf("reassignStmt.Ident.Value not '%s'. got=%s", ident, reassignStmt.Ident.Value)
-		return false
-	}
-
-	if reassignStmt.Ident.TokenLiteral() != ident {
-		t.Errorf("reassignStmt.Ident.TokenLiteral() not '%s'. got=%s", ident, reassignStmt.Ident.TokenLiteral())
-		return false
-	}
-
-	return true
+	return testIdentifier(t, reassignStmt.Target, ident)
 }
 
 func checkParserErrors(t *testing.T, p *Parser) {
@@ -197,6 +231,194 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestImportStatements(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+		expectedName string
+		expectedStr  string
+	}{
+		{`import "lib/math.dodo";`, "lib/math.dodo", "math", `import "lib/math.dodo";`},
+		{`import "helpers.dodo"`, "helpers.dodo", "helpers", `import "helpers.dodo";`},
+		{`import fold;`, "fold.dodo", "fold", `import fold;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+
+		if !ok {
+			t.Fatalf("stmt not *ast.ImportStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Path != tt.expectedPath {
+			t.Errorf("stmt.Path not %q. got=%q", tt.expectedPath, stmt.Path)
+		}
+
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedName, stmt.Name.Value)
+		}
+
+		if stmt.String() != tt.expectedStr {
+			t.Errorf("stmt.String() not %q. got=%q", tt.expectedStr, stmt.String())
+		}
+	}
+}
+
+func TestStructStatements(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedName   string
+		expectedFields []string
+		expectedStr    string
+	}{
+		{"struct Person { name, age }", "Person", []string{"name", "age"}, "struct Person { name, age }"},
+		{"struct Point {\n  x,\n  y,\n};", "Point", []string{"x", "y"}, "struct Point { x, y }"},
+		{"struct Empty {}", "Empty", []string{}, "struct Empty {}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.StructStatement)
+
+		if !ok {
+			t.Fatalf("stmt not *ast.StructStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name.Value not %q. got=%q", tt.expectedName, stmt.Name.Value)
+		}
+
+		if len(stmt.Fields) != len(tt.expectedFields) {
+			t.Fatalf("wrong number of fields. want=%d, got=%d", len(tt.expectedFields), len(stmt.Fields))
+		}
+
+		for i, field := range tt.expectedFields {
+			testIdentifier(t, stmt.Fields[i], field)
+		}
+
+		if stmt.String() != tt.expectedStr {
+			t.Errorf("stmt.String() not %q. got=%q", tt.expectedStr, stmt.String())
+		}
+	}
+}
+
+func TestEnumStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedName     string
+		expectedVariants []string
+	}{
+		{"enum Shape { Circle(r), Rect(w, h) }", "Shape", []string{"Circle(r)", "Rect(w, h)"}},
+		{"enum State {\n  Pending,\n  Running,\n  Failed(reason),\n}", "State", []string{"Pending", "Running", "Failed(reason)"}},
+		{"enum Unit { Made() }", "Unit", []string{"Made()"}},
+		{"enum Never {}", "Never", []string{}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.EnumStatement)
+
+		if !ok {
+			t.Fatalf("stmt not *ast.EnumStatement. got=%T", program.Statements[0])
+		}
+
+		testIdentifier(t, stmt.Name, tt.expectedName)
+
+		if len(stmt.Variants) != len(tt.expectedVariants) {
+			t.Fatalf("wrong number of variants. want=%d, got=%d", len(tt.expectedVariants), len(stmt.Variants))
+		}
+
+		for i, variant := range tt.expectedVariants {
+			if stmt.Variants[i].String() != variant {
+				t.Errorf("variants[%d] wrong. want=%q, got=%q", i, variant, stmt.Variants[i].String())
+			}
+		}
+	}
+}
+
+func TestImplStatement(t *testing.T) {
+	input := `impl Person {
+	  fn greet(self, greeting = "Hello") { greeting }
+	  fn age(self) { self.age }
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ImplStatement)
+
+	if !ok {
+		t.Fatalf("stmt not *ast.ImplStatement. got=%T", program.Statements[0])
+	}
+
+	testIdentifier(t, stmt.Name, "Person")
+
+	expected := []struct {
+		name   string
+		params []string
+	}{
+		{"greet", []string{"self", "greeting"}},
+		{"age", []string{"self"}},
+	}
+
+	if len(stmt.Methods) != len(expected) {
+		t.Fatalf("wrong number of methods. want=%d, got=%d", len(expected), len(stmt.Methods))
+	}
+
+	for i, tt := range expected {
+		method := stmt.Methods[i]
+
+		if method.Name != tt.name {
+			t.Errorf("methods[%d] name wrong. want=%q, got=%q", i, tt.name, method.Name)
+		}
+
+		if len(method.Parameters) != len(tt.params) {
+			t.Fatalf("methods[%d] has wrong number of parameters. want=%d, got=%d", i, len(tt.params), len(method.Parameters))
+		}
+
+		for j, param := range tt.params {
+			testIdentifier(t, method.Parameters[j], param)
+		}
+	}
+
+	expectedStr := "impl Person { fn greet(self, greeting = Hello) greeting fn age(self) (self[age]) }"
+
+	if stmt.String() != expectedStr {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", expectedStr, stmt.String())
+	}
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -250,6 +472,38 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.14;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != 3.14 {
+		t.Errorf("literal.Value not %f. got=%f", 3.14, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.14" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.14", literal.TokenLiteral())
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world!";`
 
@@ -279,6 +533,67 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestInterpolatedStringExpression(t *testing.T) {
+	input := `"sum is ${sum(xs)}, ${a + b}!";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	str, ok := stmt.Expression.(*ast.InterpolatedString)
+
+	if !ok {
+		t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+	}
+
+	if len(str.Parts) != 5 {
+		t.Fatalf("wrong number of parts. expected=5, got=%d", len(str.Parts))
+	}
+
+	testStringPart := func(exp ast.Expression, expected string) {
+		literal, ok := exp.(*ast.StringLiteral)
+
+		if !ok {
+			t.Fatalf("part not *ast.StringLiteral. got=%T", exp)
+		}
+
+		if literal.Value != expected {
+			t.Errorf("literal.Value not %q. got=%q", expected, literal.Value)
+		}
+	}
+
+	testStringPart(str.Parts[0], "sum is ")
+	testStringPart(str.Parts[2], ", ")
+	testStringPart(str.Parts[4], "!")
+
+	call, ok := str.Parts[1].(*ast.CallExpression)
+
+	if !ok {
+		t.Fatalf("str.Parts[1] not *ast.CallExpression. got=%T", str.Parts[1])
+	}
+
+	if !testIdentifier(t, call.Function, "sum") {
+		return
+	}
+
+	if call.Pos().Column != 14 {
+		t.Errorf("call has wrong column. expected=14, got=%d", call.Pos().Column)
+	}
+
+	testInfixExpression(t, str.Parts[3], "a", "+", "b")
+
+	if str.String() != "sum is ${sum(xs)}, ${(a + b)}!" {
+		t.Errorf("str.String() wrong. got=%q", str.String())
+	}
+}
+
 func TestParsingEmptyArrayLiterals(t *testing.T) {
 	input := "[]"
 
@@ -321,6 +636,61 @@ func TestParsingArrayLiterals(t *testing.T) {
 	testInfixExpression(t, array.Elements[2], 3, "+", 3)
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart string
+		expectedEnd   string
+		expectedStep  string
+	}{
+		{"arr[1:3]", "1", "3", ""},
+		{"arr[:3]", "", "3", ""},
+		{"arr[1:]", "1", "", ""},
+		{"arr[:]", "", "", ""},
+		{"arr[::2]", "", "", "2"},
+		{"arr[1:-1:2]", "1", "(-1)", "2"},
+		{"arr[i + 1::]", "(i + 1)", "", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.SliceExpression)
+
+		if !ok {
+			t.Fatalf("exp not *ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, exp.Left, "arr") {
+			return
+		}
+
+		for _, bound := range []struct {
+			name     string
+			exp      ast.Expression
+			expected string
+		}{
+			{"start", exp.Start, tt.expectedStart},
+			{"end", exp.End, tt.expectedEnd},
+			{"step", exp.Step, tt.expectedStep},
+		} {
+			actual := ""
+
+			if bound.exp != nil {
+				actual = bound.exp.String()
+			}
+
+			if actual != bound.expected {
+				t.Errorf("wrong %s bound in %q. expected=%q, got=%q", bound.name, tt.input, bound.expected, actual)
+			}
+		}
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input string
@@ -779,6 +1149,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
@@ -837,6 +1213,19 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"5 < 4 != 3 > 4", "((5 < 4) != (3 > 4))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c", "((a && b) || c)"},
+		{"a < b && c >= d", "((a < b) && (c >= d))"},
+		{"a == b || c != d", "((a == b) || (c != d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a.b + 1", "((a[b]) + 1)"},
+		{"a.b.c * 2", "(((a[b])[c]) * 2)"},
+		{"a.b[0]", "((a[b])[0])"},
+		{"a.1 + 1", "(a[(1 + 1)])"},
+		{"a ** b ** c", "(a ** (b ** c))"},
+		{"-a ** b", "(-(a ** b))"},
+		{"a ** -b", "(a ** (-b))"},
 		{"true", "true"},
 		{"false", "false"},
 		{"3 > 5 == false", "((3 > 5) == false)"},
@@ -850,6 +1239,11 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"add(a + b + c * d / f + g)", "add((((a + b) + ((c * d) / f)) + g))"},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"0..n + 1", "(0 .. (n + 1))"},
+		{"a..=b * 2 == c", "((a ..= (b * 2)) == c)"},
+		{"a[1:n - 1]", "(a[1:(n - 1)])"},
+		{"a[::-1]", "(a[::(-1)])"},
+		{"a[:2][0]", "((a[:2])[0])"},
 	}
 
 	for _, tt := range tests {
@@ -993,42 +1387,228 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
-func TestForStatement(t *testing.T) {
-	input := `for (x < y) { x }`
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { 0 }`
 
 	l := lexer.New(input)
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
 
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
-	}
-
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
 
 	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
 	}
 
-	exp, ok := stmt.Expression.(*ast.ForExpression)
-
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", program.Statements[0])
+	if !exp.IsElseIf() {
+		t.Fatalf("exp is not an else if chain")
 	}
 
-	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
-		return
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statement. got=%d", len(exp.Alternative.Statements))
 	}
 
-	if len(exp.Body.Statements) != 1 {
-		t.Errorf("consequence is not 1 statements. got=%d\n", len(exp.Body.Statements))
+	next, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+
+	if !ok {
+		t.Fatalf("alternative is not ast.IfExpression. got=%T", exp.Alternative.Statements[0])
 	}
 
-	consequence, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+	testInfixExpression(t, next.Condition, "x", ">", "y")
 
-	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", consequence)
+	if next.IsElseIf() || next.Alternative == nil {
+		t.Errorf("last alternative is not a plain else block")
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match x {
+	  0 => "zero",
+	  -1 => "minus one",
+	  [a, _, ...rest] => a,
+	  {"name": n, "tags": [t]} => n,
+	  n if n > 10 => { n }
+	  _ => "other",
+	}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	testIdentifier(t, exp.Subject, "x")
+
+	expected := []struct {
+		pattern  string
+		guard    string
+		bindings []string
+	}{
+		{"0", "", nil},
+		{"(-1)", "", nil},
+		{"[a, _, ...rest]", "", []string{"a", "rest"}},
+		{"{name: n, tags: [t]}", "", []string{"n", "t"}},
+		{"n", "(n > 10)", []string{"n"}},
+		{"_", "", nil},
+	}
+
+	if len(exp.Arms) != len(expected) {
+		t.Fatalf("wrong number of arms. want=%d, got=%d", len(expected), len(exp.Arms))
+	}
+
+	for i, tt := range expected {
+		arm := exp.Arms[i]
+
+		if arm.Pattern.String() != tt.pattern {
+			t.Errorf("arms[%d] pattern wrong. want=%q, got=%q", i, tt.pattern, arm.Pattern.String())
+		}
+
+		guard := ""
+
+		if arm.Guard != nil {
+			guard = arm.Guard.String()
+		}
+
+		if guard != tt.guard {
+			t.Errorf("arms[%d] guard wrong. want=%q, got=%q", i, tt.guard, guard)
+		}
+
+		bindings := []string{}
+
+		for _, ident := range ast.PatternBindings(arm.Pattern) {
+			bindings = append(bindings, ident.Value)
+		}
+
+		if strings.Join(bindings, ",") != strings.Join(tt.bindings, ",") {
+			t.Errorf("arms[%d] bindings wrong. want=%v, got=%v", i, tt.bindings, bindings)
+		}
+
+		if len(arm.Body.Statements) != 1 {
+			t.Errorf("arms[%d] body does not contain 1 statement. got=%d", i, len(arm.Body.Statements))
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { e }", "try f() catch (e) e"},
+		{"try { f() } finally { g() }", "try f() finally g()"},
+		{"try { f() } catch (e) { e } finally { g() }", "try f() catch (e) e finally g()"},
+		{"try {} finally { for (x in xs) { break; } }", "try  finally for(x in xs) break;"},
+		{"try {} finally { let h = fn() { return 1; }; }", "try  finally let h = fn()return 1;;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.TryExpression)
+
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.TryExpression. got=%T", stmt.Expression)
+		}
+
+		if exp.String() != tt.expected {
+			t.Errorf("wrong try expression. want=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestRejectedStatementsInFinallyBlocks(t *testing.T) {
+	tests := []string{
+		"try { 1 } finally { return 3; }",
+		"try { 1 } finally { break; }",
+		"try { 1 } finally { throw ; }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", input)
+		}
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp := stmt.Expression.(*ast.TryExpression)
+
+		// Statements that failed to parse are left out of the block
+		for _, s := range exp.Finally.Statements {
+			if ast.IsNil(s) {
+				t.Errorf("finally block of %q holds a nil statement", input)
+			}
+		}
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	l := lexer.New("throw error(message, cause);")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+
+	if !ok {
+		t.Fatalf("stmt not *ast.ThrowStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Value.String() != "error(message, cause)" {
+		t.Errorf("wrong thrown value. got=%q", stmt.Value.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.ForExpression)
+
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n", len(exp.Body.Statements))
+	}
+
+	consequence, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", consequence)
 	}
 
 	if !testIdentifier(t, consequence.Expression, "x") {
@@ -1036,6 +1616,142 @@ func TestForStatement(t *testing.T) {
 	}
 }
 
+func TestThreeClauseForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let mut i = 0; i < n; i = i + 1) { x }", "for(let mut i = 0; (i < n); i = (i + 1)) x"},
+		{"for (i = 0; i < n; i = i + 1) { x }", "for(i = 0; (i < n); i = (i + 1)) x"},
+		{"for (;;) { x }", "for(; ; ) x"},
+		{"for (let i = 0; ; f(i)) { x }", "for(let i = 0; ; f(i)) x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.ForExpression)
+
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+		}
+
+		if !exp.IsThreeClause() {
+			t.Errorf("loop %q should have three clauses", tt.input)
+		}
+
+		if exp.String() != tt.expected {
+			t.Errorf("wrong loop. expected=%q, got=%q", tt.expected, exp.String())
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+	}{
+		{"for (x in arr) { x }", "", "x"},
+		{"for (k, v in {\"a\": 1}) { v }", "k", "v"},
+		{"for (ch in \"hello\") { ch }", "", "ch"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.ForInExpression)
+
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.ForInExpression. got=%T", stmt.Expression)
+		}
+
+		if tt.expectedKey == "" && exp.Key != nil {
+			t.Errorf("exp.Key should be nil. got=%s", exp.Key)
+		}
+
+		if tt.expectedKey != "" && !testIdentifier(t, exp.Key, tt.expectedKey) {
+			return
+		}
+
+		if !testIdentifier(t, exp.Value, tt.expectedValue) {
+			return
+		}
+
+		if len(exp.Body.Statements) != 1 {
+			t.Errorf("body is not 1 statement. got=%d", len(exp.Body.Statements))
+		}
+	}
+}
+
+func TestLoopControlStatements(t *testing.T) {
+	input := `
+outer: for (a) {
+	for (b) {
+		break;
+		continue;
+		break outer;
+		continue outer
+	}
+}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	outer, ok := stmt.Expression.(*ast.ForExpression)
+
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ForExpression. got=%T", stmt.Expression)
+	}
+
+	if outer.Label == nil || outer.Label.Value != "outer" {
+		t.Fatalf("outer.Label wrong. got=%v", outer.Label)
+	}
+
+	if stmt.Pos().Column != 1 {
+		t.Errorf("labeled loop should start at its label. got column=%d", stmt.Pos().Column)
+	}
+
+	inner := outer.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForExpression)
+
+	if inner.Label != nil {
+		t.Errorf("inner.Label should be nil. got=%v", inner.Label)
+	}
+
+	expected := []string{"break;", "continue;", "break outer;", "continue outer;"}
+
+	if len(inner.Body.Statements) != len(expected) {
+		t.Fatalf("inner body does not contain %d statements. got=%d", len(expected), len(inner.Body.Statements))
+	}
+
+	for i, s := range inner.Body.Statements {
+		switch s.(type) {
+		case *ast.BreakStatement, *ast.ContinueStatement:
+		default:
+			t.Errorf("statement %d is not a break or continue statement. got=%T", i, s)
+		}
+
+		if s.String() != expected[i] {
+			t.Errorf("statement %d wrong. expected=%q, got=%q", i, expected[i], s.String())
+		}
+	}
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -1113,6 +1829,196 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedRest     string
+	}{
+		{"fn(x, y = 10) {}", []string{"x", "y"}, []string{"", "10"}, ""},
+		{"fn(x = 1, y = x * 2) {}", []string{"x", "y"}, []string{"1", "(x * 2)"}, ""},
+		{"fn(first, ...rest) {}", []string{"first"}, []string{""}, "rest"},
+		{"fn(...args) {}", []string{}, []string{}, "args"},
+		{"fn(x, y = 2, ...rest) {}", []string{"x", "y"}, []string{"", "2"}, "rest"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+
+			def := ""
+
+			if d := function.Default(i); d != nil {
+				def = d.String()
+			}
+
+			if def != tt.expectedDefaults[i] {
+				t.Errorf("default of %s wrong. want %q, got=%q", ident, tt.expectedDefaults[i], def)
+			}
+		}
+
+		rest := ""
+
+		if function.Rest != nil {
+			rest = function.Rest.Value
+		}
+
+		if rest != tt.expectedRest {
+			t.Errorf("rest parameter wrong. want %q, got=%q", tt.expectedRest, rest)
+		}
+	}
+}
+
+func TestParameterWithoutDefaultAfterDefault(t *testing.T) {
+	input := "let f = fn(a = 1, b) { b }; fn(a = 1, b) { b }"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	// The function literals are dropped rather than called with b unset
+	for _, stmt := range program.Statements {
+		var exp ast.Expression
+
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			exp = stmt.Value
+		case *ast.ExpressionStatement:
+			exp = stmt.Expression
+		}
+
+		if _, ok := exp.(*ast.FunctionLiteral); ok {
+			t.Errorf("function literal kept in %q", stmt.String())
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedPattern  string
+		expectedBindings []string
+		expectedMutable  bool
+	}{
+		{"let [a, b] = x;", "[a, b]", []string{"a", "b"}, false},
+		{"let mut [first, _, ...rest] = x;", "[first, _, ...rest]", []string{"first", "rest"}, true},
+		{`let {"name": n, "tags": [t]} = x;`, "{name: n, tags: [t]}", []string{"n", "t"}, false},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Pattern == nil || stmt.Pattern.String() != tt.expectedPattern {
+			t.Errorf("stmt.Pattern wrong. want=%q, got=%v", tt.expectedPattern, stmt.Pattern)
+		}
+
+		if stmt.Mutable != tt.expectedMutable {
+			t.Errorf("stmt.Mutable wrong. want=%t, got=%t", tt.expectedMutable, stmt.Mutable)
+		}
+
+		bindings := []string{}
+
+		for _, ident := range stmt.Bindings() {
+			bindings = append(bindings, ident.Value)
+		}
+
+		if strings.Join(bindings, ",") != strings.Join(tt.expectedBindings, ",") {
+			t.Errorf("bindings wrong. want=%v, got=%v", tt.expectedBindings, bindings)
+		}
+	}
+
+	l := lexer.New(`fn(x, [a, b], {"k": v} = {"k": 1}) {}`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	expected := []string{"", "[a, b]", "{k: v}"}
+
+	if len(function.Parameters) != len(expected) {
+		t.Fatalf("length parameters wrong. want %d, got=%d", len(expected), len(function.Parameters))
+	}
+
+	for i, want := range expected {
+		got := ""
+
+		if pattern := function.Pattern(i); pattern != nil {
+			got = pattern.String()
+		}
+
+		if got != want {
+			t.Errorf("pattern of parameter %d wrong. want %q, got=%q", i, want, got)
+		}
+	}
+
+	if function.Default(2) == nil {
+		t.Errorf("pattern parameter has no default value")
+	}
+}
+
+func TestNamedArgumentParsing(t *testing.T) {
+	input := "greet(\"Ada\", greeting: \"Hi\", times: 1 + 2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp := stmt.Expression.(*ast.CallExpression)
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	greeting, ok := exp.Arguments[1].(*ast.NamedArgument)
+
+	if !ok {
+		t.Fatalf("exp.Arguments[1] is not ast.NamedArgument. got=%T", exp.Arguments[1])
+	}
+
+	testIdentifier(t, greeting.Name, "greeting")
+
+	times, ok := exp.Arguments[2].(*ast.NamedArgument)
+
+	if !ok {
+		t.Fatalf("exp.Arguments[2] is not ast.NamedArgument. got=%T", exp.Arguments[2])
+	}
+
+	testIdentifier(t, times.Name, "times")
+	testInfixExpression(t, times.Value, 1, "+", 2)
+
+	if exp.String() != "greet(Ada, greeting: Hi, times: (1 + 2))" {
+		t.Errorf("exp.String() wrong. got=%q", exp.String())
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -1151,3 +2057,81 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		filename string
+		expected string
+	}{
+		{"let x 5;", "", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 5;\nlet = 10;", "", "2:5: expected next token to be IDENT, got = instead"},
+		{"add(1, 2;", "main.dodo", "main.dodo:1:9: expected next token to be ), got ; instead"},
+		{"let y = 1;\n  ;", "", "2:3: no prefix parse function for ; found"},
+		{"let y = 1; /* never closed", "main.dodo", "main.dodo:1:12: unterminated block comment"},
+		{"// comment\nlet x 5;", "", "2:7: expected next token to be =, got INT instead"},
+		{"break;", "", "1:1: break outside of a loop"},
+		{"if (x) { continue }", "", "1:10: continue outside of a loop"},
+		{"for (x) { let f = fn() { break; }; }", "", "1:26: break outside of a loop"},
+		{"for (x) { break outer; }", "", "1:17: undefined loop label 'outer'"},
+		{"a: for (x) { a: for (y) {} }", "", "1:14: loop label 'a' is already in use"},
+		{"a: 5", "", "1:4: expected next token to be FOR, got INT instead"},
+		{"for (x in) {}", "", "1:10: no prefix parse function for ) found"},
+		{"f() = 1;", "", "1:2: cannot assign to f()"},
+		{"a[1:2] = 1;", "", "1:2: cannot assign to (a[1:2])"},
+		{"1 += 1;", "", "1:1: cannot assign to 1"},
+		{"for (k, in arr) {}", "", "1:9: expected next token to be IDENT, got IN instead"},
+		{"for (let i = 0 i < 3; i = i + 1) {}", "", "1:16: expected ; after the init clause of for, got IDENT instead"},
+		{"for (let i = 0; i < 3; i = i + 1 {}", "", "1:34: expected next token to be ), got { instead"},
+		{`let s = "a ${}";`, "", "1:14: expected expression in string interpolation"},
+		{`let s = "a ${x y}";`, "", "1:16: unexpected IDENT in string interpolation"},
+		{`let s = "a ${x +}";`, "", "1:17: no prefix parse function for EOF found"},
+		{"match x { 1 => 2 3 => 4 }", "", "1:18: expected next token to be }, got INT instead"},
+		{"match x { 1 2 }", "", "1:13: expected next token to be =>, got INT instead"},
+		{"match x { x + 1 => 2 }", "", "1:13: expected next token to be =>, got + instead"},
+		{"match x { [a, a] => 1 }", "", "1:15: identifier 'a' is bound more than once in the pattern"},
+		{"match x { {k: 1} => 1 }", "", "1:12: hashmap pattern keys must be literals, got IDENT"},
+		{"match x { fn => 1 }", "", "1:11: unexpected FUNCTION in pattern"},
+		{"if (x) {} else 5", "", "1:16: expected next token to be {, got INT instead"},
+		{"fn(x = 1, y) {}", "", "1:11: parameter 'y' without a default value follows one with a default value"},
+		{"fn(...rest, x) {}", "", "1:11: expected next token to be ), got , instead"},
+		{"fn(1) {}", "", "1:4: expected parameter name, got INT"},
+		{"f(x: 1, 2)", "", "1:9: positional argument cannot follow named arguments"},
+		{"let [a, a] = x;", "", "1:9: identifier 'a' is bound more than once in the pattern"},
+		{"struct { x }", "", "1:8: expected next token to be IDENT, got { instead"},
+		{"struct P { x, 1 }", "", "1:15: expected next token to be IDENT, got INT instead"},
+		{"struct P { x, y, x }", "", "1:18: field 'x' is declared more than once in struct P"},
+		{"struct P { x y }", "", "1:14: expected next token to be }, got IDENT instead"},
+		{"enum E { A, A(x) }", "", "1:13: variant 'A' is declared more than once in enum E"},
+		{"enum E { A(x, x) }", "", "1:15: field 'x' is declared more than once in variant A"},
+		{"enum E { A(1) }", "", "1:12: expected next token to be IDENT, got INT instead"},
+		{"enum E { A B }", "", "1:12: expected next token to be }, got IDENT instead"},
+		{"impl P { fn f(x) {} }", "", "1:13: method 'f' must take self as its first parameter"},
+		{"impl P { fn f() {} }", "", "1:13: method 'f' must take self as its first parameter"},
+		{"impl P { fn f(self) {} fn f(self) {} }", "", "1:27: method 'f' is defined more than once for P"},
+		{"impl P { let x = 1; }", "", "1:10: expected next token to be FUNCTION, got LET instead"},
+		{"impl P { fn (self) {} }", "", "1:13: expected next token to be IDENT, got ( instead"},
+		{"try {} 5", "", "1:8: expected catch or finally after try block, got INT instead"},
+		{"try {} catch e {}", "", "1:14: expected next token to be (, got IDENT instead"},
+		{"for (x) { try {} finally { break; } }", "", "1:28: break cannot leave a finally block"},
+		{"fn() { try {} finally { return 1; } }", "", "1:25: return cannot leave a finally block"},
+		{"let [a, 1 + 2] = x;", "", "1:11: expected next token to be ], got + instead"},
+		{"fn({k: v}) {}", "", "1:5: hashmap pattern keys must be literals, got IDENT"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewFile(tt.filename, tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
@@ -1,11 +1,14 @@
 package repl
 
 import (
+	"dodo-lang/ast"
 	"dodo-lang/cli"
+	"dodo-lang/compiler"
 	"dodo-lang/evaluator"
 	"dodo-lang/lexer"
 	"dodo-lang/object"
 	"dodo-lang/parser"
+	"dodo-lang/vm"
 	"fmt"
 	"io"
 	"os"
@@ -15,32 +18,76 @@ type ExecMode = string
 
 const PROMPT = "\n>> "
 
+// Engines a file can be run with
+const (
+	EngineEval = "eval" // Tree-walking evaluator
+	EngineVM   = "vm"   // Bytecode compiler and virtual machine
+)
+
 func InteractiveMode(in io.Reader, out io.Writer, verbose bool) {
 	cli := cli.New(verbose)
 	cli.Init()
 }
 
-func FileMode(in io.Reader, out io.Writer, filename string, verbose bool) {
+func FileMode(in io.Reader, out io.Writer, filename string, engine string, verbose bool) {
 	content, err := os.ReadFile(filename)
 
 	if err != nil {
 		panic(err)
 	}
 
-	l := lexer.New(string(content))
+	l := lexer.NewFile(filename, string(content))
 	p := parser.New(l)
 
 	program := p.ParseProgram()
-	env := object.NewEnvironment()
 
 	if len(p.Errors()) != 0 && verbose {
 		p.PrintParserErrors(out)
 	}
 
-	switch evaluated := evaluator.Eval(program, env).(type) {
+	switch engine {
+	case EngineEval:
+		evalProgram(out, program, filename, verbose)
+	case EngineVM:
+		runProgram(out, program, filename, verbose)
+	default:
+		io.WriteString(out, fmt.Sprintf("unknown engine: %s\n", engine))
+	}
+}
+
+func evalProgram(out io.Writer, program *ast.Program, filename string, verbose bool) {
+	env := object.NewEnvironment()
+
+	if verbose {
+		evaluator.Warnings = out
+	}
+
+	switch evaluated := evaluator.EvalFile(program, filename, env).(type) {
 	case *object.Error:
 		if verbose && evaluated != nil {
 			io.WriteString(out, fmt.Sprintf("%s", evaluated.Inspect()))
 		}
 	}
 }
+
+func runProgram(out io.Writer, program *ast.Program, filename string, verbose bool) {
+	comp := compiler.New()
+
+	if verbose {
+		comp.Warnings = out
+	}
+
+	if err := comp.CompileFile(program, filename); err != nil {
+		if verbose {
+			io.WriteString(out, fmt.Sprintf("ERROR: %s", err))
+		}
+
+		return
+	}
+
+	machine := vm.New(comp.Bytecode())
+
+	if err := machine.Run(); err != nil && verbose {
+		io.WriteString(out, fmt.Sprintf("ERROR: %s", err))
+	}
+}
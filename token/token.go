@@ -1,21 +1,62 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position describes where a token starts in the source. Lines and columns
+// are 1-based, a zero Line means the position is unknown.
+type Position struct {
+	Filename string
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as "file:line:column", leaving out the file
+// name when it is unknown (eg. in the REPL).
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+
+		return "-"
+	}
+
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // Only used for comments kept as trivia, never returned by the lexer
 
 	// Identifiers and literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
+	RAW_STRING = "RAW_STRING" // `...`, spanning lines without escape sequences
+	TEMPLATE   = "TEMPLATE"   // "...${expr}...", literal holds the source between the quotes
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -23,15 +64,32 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 	DOLLAR   = "$"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ     = "=="
 	NOT_EQ = "!="
 
-	PIPE = "|>"
+	AND = "&&"
+	OR  = "||"
+
+	PIPE      = "|>"
+	FAT_ARROW = "=>"
+
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+
+	RANGE           = ".."
+	RANGE_INCLUSIVE = "..="
+	ELLIPSIS        = "..."
 
 	// Delimeters
 	COMMA     = ","
@@ -56,18 +114,71 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN       = "IN"
+	MATCH    = "MATCH"
+	STRUCT   = "STRUCT"
+	IMPL     = "IMPL"
+	ENUM     = "ENUM"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
 )
 
+// AssignOperators maps the compound assignment operators, eg. +=, to the
+// operator they apply
+var AssignOperators = map[TokenType]string{
+	PLUS_ASSIGN:     "+",
+	MINUS_ASSIGN:    "-",
+	ASTERISK_ASSIGN: "*",
+	SLASH_ASSIGN:    "/",
+}
+
+// IsAssign reports whether t is = or a compound assignment operator
+func IsAssign(t TokenType) bool {
+	_, ok := AssignOperators[t]
+
+	return ok || t == ASSIGN
+}
+
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"mut":    MUT,
-	"if":     IF,
-	"else":   ELSE,
-	"for":    FOR,
-	"true":   TRUE,
-	"false":  FALSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"mut":      MUT,
+	"if":       IF,
+	"else":     ELSE,
+	"for":      FOR,
+	"true":     TRUE,
+	"false":    FALSE,
+	"return":   RETURN,
+	"import":   IMPORT,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"in":       IN,
+	"match":    MATCH,
+	"struct":   STRUCT,
+	"impl":     IMPL,
+	"enum":     ENUM,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
+}
+
+// Keywords returns every keyword of the language in alphabetical order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+
+	for word := range keywords {
+		words = append(words, word)
+	}
+
+	sort.Strings(words)
+
+	return words
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,14 @@
+package vm
+
+import (
+	"dodo-lang/object"
+)
+
+// cell holds a mutable variable of a function. Closures capture the cell
+// rather than its value, so assignments on either side are seen by both.
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return "CELL" }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
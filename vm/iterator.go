@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"dodo-lang/object"
+)
+
+// iterator is kept on the stack by for-in loops, holding what is left to
+// iterate over. It never escapes to user code.
+type iterator struct {
+	keys   []object.Object // Indices of arrays and strings, keys of hashmaps
+	values []object.Object
+	index  int
+	hash   bool
+	rng    *object.Range // Set when iterating over a range, which has no keys or values stored
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// newIterator iterates over the elements of an array, the characters of a
+// string, the integers of a range or the pairs of a hashmap
+func newIterator(obj object.Object) (*iterator, error) {
+	it := &iterator{}
+
+	switch obj := obj.(type) {
+	case *object.Range:
+		it.rng = obj
+	case *object.Array:
+		it.values = obj.Elements
+
+		for i := range obj.Elements {
+			it.keys = append(it.keys, &object.Integer{Value: int64(i)})
+		}
+	case *object.String:
+		for i, ch := range []rune(obj.Value) {
+			it.keys = append(it.keys, &object.Integer{Value: int64(i)})
+			it.values = append(it.values, &object.String{Value: string(ch)})
+		}
+	case *object.HashMap:
+		it.hash = true
+
+		for _, pair := range obj.SortedPairs() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+	default:
+		return nil, newError("cannot iterate over %s", obj.Type())
+	}
+
+	return it, nil
+}
+
+// next returns the values for the loop variables of the next iteration,
+// reporting false when there are none left. A single variable is bound to the
+// elements of arrays and strings but to the keys of hashmaps, like in the
+// evaluator.
+func (it *iterator) next(numValues int) ([]object.Object, bool) {
+	if it.index >= it.len() {
+		return nil, false
+	}
+
+	i := it.index
+	it.index += 1
+
+	switch {
+	case it.rng != nil && numValues == 2:
+		return []object.Object{&object.Integer{Value: int64(i)}, it.rng.At(int64(i))}, true
+	case it.rng != nil:
+		return []object.Object{it.rng.At(int64(i))}, true
+	case numValues == 2:
+		return []object.Object{it.keys[i], it.values[i]}, true
+	case it.hash:
+		return []object.Object{it.keys[i]}, true
+	default:
+		return []object.Object{it.values[i]}, true
+	}
+}
+
+func (it *iterator) len() int {
+	if it.rng != nil {
+		n, _ := it.rng.Len()
+		return int(n)
+	}
+
+	return len(it.keys)
+}
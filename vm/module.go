@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"dodo-lang/object"
+)
+
+// memberFunction is a function held by the receiver of a dot call, such as a
+// function of a module, eg. `math.double(x)`, or a field of a record, eg.
+// `p.callback(x)`. Such a call is compiled like a method call, passing the
+// receiver along as the first argument, which calling the function leaves out.
+type memberFunction struct {
+	fn object.Object
+}
+
+func (mf *memberFunction) Type() object.ObjectType { return mf.fn.Type() }
+func (mf *memberFunction) Inspect() string         { return mf.fn.Inspect() }
+
+// moduleMember looks up a top-level binding of a module among the globals
+func (vm *VM) moduleMember(module *object.Module, name string) (object.Object, error) {
+	index, ok := module.Globals[name]
+
+	if !ok || vm.globals[index] == nil {
+		return nil, newError("module %s has no binding '%s'", module.Name, name)
+	}
+
+	object.Share(vm.globals[index])
+
+	return vm.globals[index], nil
+}
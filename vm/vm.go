@@ -0,0 +1,1130 @@
+package vm
+
+import (
+	"dodo-lang/ast"
+	"dodo-lang/code"
+	"dodo-lang/compiler"
+	"dodo-lang/object"
+	"dodo-lang/token"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const StackSize = 2048 // Initial size of the stack, which grows as calls need it
+const GlobalsSize = 65536
+
+// MaxFrames limits how deeply function calls may nest, so that runaway
+// recursion fails with an error rather than using up all memory
+var MaxFrames = 20000
+
+var (
+	Null  = &object.Null{}
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+)
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // Handlers of the try expressions being run, innermost last
+}
+
+// handler is where to continue when an error is raised in the body of a try
+// expression, installed by OpTry and removed by OpEndTry
+type handler struct {
+	framesIndex int // Number of frames when the handler was installed
+	sp          int
+	ip          int // Position of the code handling the error in the instructions of the frame
+}
+
+// Error is a runtime error raised while executing bytecode
+type Error struct {
+	Pos     token.Position
+	Message string
+	Thrown  object.Object // The value of a throw statement, nil for errors raised by the runtime
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+
+	return e.Message
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := []*Frame{mainFrame}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		stack:       make([]object.Object, StackSize),
+		sp:          0,
+		globals:     make([]object.Object, GlobalsSize),
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewWithGlobalsStore creates a VM sharing globals with a previous run, used
+// by the interactive mode to keep bindings between inputs
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return newError("stack overflow: exceeded %d nested calls", MaxFrames)
+	}
+
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.framesIndex] = f
+	}
+
+	vm.framesIndex += 1
+
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex -= 1
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		frame := vm.currentFrame()
+		frame.ip += 1
+
+		ip = frame.ip
+		ins = frame.Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.push(vm.constants[constIndex])
+		case code.OpPop:
+			vm.pop()
+		case code.OpDup:
+			n := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			start := vm.sp - n
+
+			for i := start; i < start+n && err == nil; i++ {
+				err = vm.push(vm.stack[i])
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			err = vm.executeBinaryOperation(op)
+		case code.OpRange, code.OpRangeInclusive:
+			err = vm.executeRange(op)
+
+		case code.OpTrue:
+			err = vm.push(True)
+		case code.OpFalse:
+			err = vm.push(False)
+		case code.OpNull:
+			err = vm.push(Null)
+
+		case code.OpBang:
+			err = vm.executeBangOperator()
+		case code.OpMinus:
+			err = vm.executeMinusOperator()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			condition := vm.pop()
+
+			if !isTruthy(condition) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpIfPassed:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			localIndex := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			if vm.stack[frame.basePointer+int(localIndex)] != nil {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.push(vm.globals[globalIndex])
+		case code.OpGetGlobalForward:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			nameIndex := code.ReadUint16(ins[ip+3:])
+			frame.ip += 4
+
+			if vm.globals[globalIndex] == nil {
+				err = newError("identifier not found: %s", vm.constants[nameIndex].Inspect())
+			} else {
+				// Whether the global is mutable was not known when compiling
+				object.Share(vm.globals[globalIndex])
+				err = vm.push(vm.globals[globalIndex])
+			}
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(object.Builtins[builtinIndex].Builtin)
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(frame.cl.Free[freeIndex])
+		case code.OpGetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)].(*cell).value)
+		case code.OpSetLocalCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			vm.stack[frame.basePointer+int(localIndex)].(*cell).value = vm.pop()
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(frame.cl.Free[freeIndex].(*cell).value)
+		case code.OpSetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			frame.cl.Free[freeIndex].(*cell).value = vm.pop()
+		case code.OpGetGlobalCell:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.push(vm.globals[globalIndex].(*cell).value)
+		case code.OpSetGlobalCell:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.globals[globalIndex].(*cell).value = vm.pop()
+		case code.OpNewCell:
+			err = vm.push(&cell{value: vm.pop()})
+		case code.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+
+			if err == nil {
+				vm.sp = vm.sp - numElements
+				err = vm.push(hash)
+			}
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			str := vm.buildString(vm.sp-numParts, vm.sp)
+			vm.sp = vm.sp - numParts
+
+			err = vm.push(str)
+		case code.OpIter:
+			var it *iterator
+			it, err = newIterator(vm.pop())
+
+			if err == nil {
+				err = vm.push(it)
+			}
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numValues := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			values, ok := vm.stack[vm.sp-1].(*iterator).next(int(numValues))
+
+			if !ok {
+				frame.ip = pos - 1
+			}
+
+			for _, value := range values {
+				if err = vm.push(value); err != nil {
+					break
+				}
+			}
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err = vm.executeIndexExpression(left, index)
+		case code.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			err = vm.executeSlice(left, start, end, step)
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+
+			err = vm.executeSetIndex(container, index, value)
+		case code.OpShare:
+			object.Share(vm.stack[vm.sp-1])
+
+		case code.OpField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			pushed := code.ReadUint8(ins[ip+3:]) == 1
+			frame.ip += 3
+
+			err = vm.executeField(vm.constants[nameIndex].(*object.String), pushed)
+		case code.OpMethod:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			pushed := code.ReadUint8(ins[ip+3:]) == 1
+			frame.ip += 3
+
+			err = vm.executeMethod(vm.constants[nameIndex].(*object.String), pushed)
+		case code.OpImpl:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			method := vm.pop()
+			target := vm.pop()
+
+			if implErr := object.Implement(target, vm.constants[nameIndex].(*object.String).Value, method); implErr != nil {
+				err = newError("%s", implErr.Message)
+			}
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			vm.handlers = append(vm.handlers, handler{framesIndex: vm.framesIndex, sp: vm.sp, ip: pos})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			err = fromObjectError(object.Throw(vm.pop()))
+		case code.OpMatch:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			pos := int(code.ReadUint16(ins[ip+3:]))
+			frame.ip += 4
+
+			err = vm.executeMatch(vm.constants[patternIndex].(*object.Pattern), pos)
+		case code.OpDestructure:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			err = vm.executeDestructure(vm.constants[patternIndex].(*object.Pattern))
+		case code.OpNoMatch:
+			err = newError("no pattern matched %s", vm.pop().Inspect())
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.executeCall(int(numArgs), nil)
+		case code.OpCallNamed:
+			namesIndex := code.ReadUint16(ins[ip+1:])
+			numArgs := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			names := []string{}
+
+			for _, name := range vm.constants[namesIndex].(*object.Array).Elements {
+				names = append(names, name.(*object.String).Value)
+			}
+
+			err = vm.executeCall(int(numArgs), names)
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// Returning from the top level ends the program, like in the evaluator
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			callerFrame := vm.popFrame()
+			vm.sp = callerFrame.basePointer - 1
+
+			err = vm.push(returnValue)
+		case code.OpReturn:
+			callerFrame := vm.popFrame()
+			vm.sp = callerFrame.basePointer - 1
+
+			err = vm.push(Null)
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+		default:
+			err = newError("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			err = withPosition(err, frame, ip)
+
+			if !vm.catch(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// catch unwinds the frames and the stack to the innermost handler, pushing the
+// value of err for it to bind. It reports false if there is no handler.
+func (vm *VM) catch(err error) bool {
+	vmErr, ok := err.(*Error)
+
+	if !ok || len(vm.handlers) == 0 {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+
+	caught := vmErr.Thrown
+
+	if caught == nil {
+		caught = &object.ErrorValue{Message: vmErr.Message, Pos: vmErr.Pos}
+	}
+
+	// The handler's stack pointer was below the current one, so there is room
+	vm.stack[vm.sp] = caught
+	vm.sp += 1
+
+	return true
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// fromObjectError converts an error raised by code shared with the evaluator,
+// keeping the value it throws if any
+func fromObjectError(err *object.Error) *Error {
+	return &Error{Pos: err.Pos, Message: err.Message, Thrown: err.Thrown}
+}
+
+// withPosition attributes an error to the source position of the instruction
+// at ip in the given frame
+func withPosition(err error, frame *Frame, ip int) error {
+	if vmErr, ok := err.(*Error); ok && !vmErr.Pos.IsValid() {
+		vmErr.Pos = frame.cl.Fn.SourceMap[ip]
+	}
+
+	return err
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.growStack(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp += 1
+
+	return nil
+}
+
+// growStack makes room for at least size values on the stack, doubling its
+// size so that deep recursion only copies it a few times
+func (vm *VM) growStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+
+	stack := make([]object.Object, max(size, 2*len(vm.stack)))
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp -= 1
+
+	return o
+}
+
+var operatorSymbols = map[code.Opcode]string{
+	code.OpAdd:            "+",
+	code.OpSub:            "-",
+	code.OpMul:            "*",
+	code.OpDiv:            "/",
+	code.OpMod:            "%",
+	code.OpPow:            "**",
+	code.OpEqual:          "==",
+	code.OpNotEqual:       "!=",
+	code.OpGreaterThan:    ">",
+	code.OpLessThan:       "<",
+	code.OpGreaterEqual:   ">=",
+	code.OpLessEqual:      "<=",
+	code.OpRange:          "..",
+	code.OpRangeInclusive: "..=",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeStringOperation(op, left, right)
+	case leftType == object.ENUM_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		return vm.push(nativeBoolToBooleanObject(left.(*object.Enum).Equal(right) == (op == code.OpEqual)))
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case leftType != rightType:
+		return newError("type mismatch: %s %s %s", leftType, operatorSymbols[op], rightType)
+	default:
+		return newError("unknown operator: %s %s %s", leftType, operatorSymbols[op], rightType)
+	}
+}
+
+func (vm *VM) executeIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Integer{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Integer{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Integer{Value: leftValue * rightValue})
+	case code.OpDiv, code.OpMod:
+		if rightValue == 0 {
+			return newError("division by zero")
+		}
+
+		if op == code.OpMod {
+			return vm.push(&object.Integer{Value: leftValue % rightValue})
+		}
+
+		return vm.push(&object.Integer{Value: leftValue / rightValue})
+	case code.OpPow:
+		if rightValue < 0 {
+			return vm.push(&object.Float{Value: math.Pow(float64(leftValue), float64(rightValue))})
+		}
+
+		return vm.push(&object.Integer{Value: intPow(leftValue, rightValue)})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+// executeFloatOperation handles float-float as well as mixed int-float
+// operands, promoting the integer side to a float
+func (vm *VM) executeFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpPow:
+		return vm.push(&object.Float{Value: math.Pow(leftValue, rightValue)})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpGreaterEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+// intPow raises base to a non-negative exponent by repeated squaring
+func intPow(base, exp int64) int64 {
+	result := int64(1)
+
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+
+		base *= base
+		exp >>= 1
+	}
+
+	return result
+}
+
+func (vm *VM) executeStringOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return newError("unknown operator: -%s", operand.Type())
+	}
+}
+
+// executeMethod leaves the function of a dot call, eg. `x.f(args)`, below the
+// receiver on the stack. A method f implemented for the type of x, or the
+// function f of a module x, replaces the function of the same name, which the
+// compiler pushed if there is one.
+func (vm *VM) executeMethod(name *object.String, pushed bool) error {
+	receiver := vm.stack[vm.sp-1]
+	method, ok := object.LookupMethod(receiver, name.Value)
+
+	if module, isModule := receiver.(*object.Module); isModule {
+		fn, err := vm.moduleMember(module, name.Value)
+
+		if err != nil {
+			return err
+		}
+
+		method, ok = &memberFunction{fn: fn}, true
+	} else if record, isRecord := receiver.(object.Record); isRecord && !ok {
+		// A field holding a function is called in favour of any function of
+		// the same name in scope, eg. `p.callback(x)`
+		if field, err := record.Get(name); err == nil {
+			if field == nil {
+				field = Null
+			}
+
+			method, ok = &memberFunction{fn: field}, true
+		}
+	}
+
+	switch {
+	case ok && pushed:
+		vm.stack[vm.sp-2] = method
+		return nil
+	case ok:
+		vm.stack[vm.sp-1] = method
+		return vm.push(receiver)
+	case pushed:
+		return nil
+	default:
+		return newError("identifier not found: %s", name.Value)
+	}
+}
+
+// executeField leaves the index of a field access, eg. `a.name`, on the stack.
+// Records and modules are indexed by the name itself, other values by the
+// variable of the same name, which the compiler pushed if there is one.
+func (vm *VM) executeField(name *object.String, pushed bool) error {
+	left := vm.stack[vm.sp-1]
+
+	if pushed {
+		left = vm.stack[vm.sp-2]
+	}
+
+	_, isRecord := left.(object.Record)
+
+	if _, ok := left.(*object.Module); ok {
+		isRecord = true
+	}
+
+	switch {
+	case isRecord && pushed:
+		vm.stack[vm.sp-1] = name
+		return nil
+	case isRecord:
+		return vm.push(name)
+	case pushed:
+		return nil
+	default:
+		return newError("identifier not found: %s", name.Value)
+	}
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	if module, ok := left.(*object.Module); ok {
+		name, ok := index.(*object.String)
+
+		if !ok {
+			return newError("cannot index %T", left)
+		}
+
+		value, err := vm.moduleMember(module, name.Value)
+
+		if err != nil {
+			return err
+		}
+
+		return vm.push(value)
+	}
+
+	if record, ok := left.(object.Record); ok {
+		value, err := record.Get(index)
+
+		if err != nil {
+			return newError("%s", err.Message)
+		}
+
+		if value == nil {
+			return vm.push(Null)
+		}
+
+		return vm.push(value)
+	}
+
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASHMAP_OBJ:
+		return vm.executeHashIndex(left, index)
+	case left.Type() == object.STRING_OBJ:
+		return vm.executeStringIndex(left, index)
+	default:
+		return newError("cannot index %T", left)
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arr := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	i, ok := object.Index(idx, int64(len(arr.Elements)))
+
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(arr.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.HashMap)
+	key, ok := index.(object.Hashable)
+
+	if !ok {
+		return newError("type of %s cannot be used as hash key", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	strObject := str.(*object.String)
+	idx, ok := index.(*object.Integer)
+
+	if !ok {
+		return newError("type of %s cannot be used to index %s", index.Type(), strObject.Type())
+	}
+
+	// Strings are indexed by character rather than by byte
+	chars := []rune(strObject.Value)
+	i, ok := object.Index(idx.Value, int64(len(chars)))
+
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(chars[i])})
+}
+
+func (vm *VM) executeSlice(left, start, end, step object.Object) error {
+	result, err := object.Slice(left, start, end, step)
+
+	if err != nil {
+		return newError("%s", err.Message)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeSetIndex(container, index, value object.Object) error {
+	if _, ok := container.(*object.Module); ok {
+		return newError("cannot assign to a member of %s", container.Inspect())
+	}
+
+	result, err := object.SetIndex(container, index, value)
+
+	if err != nil {
+		return newError("%s", err.Message)
+	}
+
+	return vm.push(result)
+}
+
+func (vm *VM) executeRange(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	start, ok := left.(*object.Integer)
+	end, ok2 := right.(*object.Integer)
+
+	if !ok || !ok2 {
+		return newError("range bounds must be INTEGER, got %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+
+	return vm.push(&object.Range{Start: start.Value, End: end.Value, Inclusive: op == code.OpRangeInclusive})
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildString(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+
+		if !ok {
+			return nil, newError("type of '%s' cannot be used as hash key", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.HashMap{Pairs: hashedPairs}, nil
+}
+
+// executeMatch pops a value and pushes the values bound by matching it against
+// pattern, or jumps to pos if it does not match
+func (vm *VM) executeMatch(pattern *object.Pattern, pos int) error {
+	bound, matchErr := matchPattern(pattern, vm.pop())
+
+	if matchErr != nil {
+		vm.currentFrame().ip = pos - 1
+		return nil
+	}
+
+	return vm.pushAll(bound)
+}
+
+// executeDestructure is executeMatch for let statements and parameters, which
+// fail when the value does not match
+func (vm *VM) executeDestructure(pattern *object.Pattern) error {
+	value := vm.pop()
+	bound, matchErr := matchPattern(pattern, value)
+
+	if matchErr != nil {
+		return newError("cannot destructure %s: %s", value.Inspect(), matchErr.Message)
+	}
+
+	return vm.pushAll(bound)
+}
+
+func matchPattern(pattern *object.Pattern, value object.Object) ([]object.Object, *object.Error) {
+	bound := []object.Object{}
+
+	err := object.Match(pattern.Node, value, func(name *ast.Identifier, value object.Object) {
+		bound = append(bound, value)
+	})
+
+	return bound, err
+}
+
+func (vm *VM) pushAll(objs []object.Object) error {
+	for _, obj := range objs {
+		if err := vm.push(obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// executeCall calls the function below the arguments on the stack, where the
+// last len(names) arguments are passed by name
+func (vm *VM) executeCall(numArgs int, names []string) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs, names)
+	case *memberFunction:
+		base := vm.sp - 1 - numArgs
+		vm.stack[base] = callee.fn
+		copy(vm.stack[base+1:], vm.stack[base+2:vm.sp])
+		vm.sp--
+
+		return vm.executeCall(numArgs-1, names)
+	case *object.Builtin:
+		if len(names) > 0 {
+			return newError("builtin functions do not take named arguments")
+		}
+
+		return vm.callBuiltin(callee, numArgs)
+	case *object.StructType:
+		value, err := callee.New(vm.stack[vm.sp-numArgs:vm.sp], names)
+
+		if err != nil {
+			return newError("%s", err.Message)
+		}
+
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.push(value)
+	case *object.Variant:
+		value, err := callee.New(vm.stack[vm.sp-numArgs:vm.sp], names)
+
+		if err != nil {
+			return newError("%s", err.Message)
+		}
+
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.push(value)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// callClosure binds the arguments to the parameters of the closure, which are
+// its first locals. Parameters left to their default value are set to nil for
+// OpJumpIfPassed to find.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, names []string) error {
+	args, bindErr := cl.Fn.Signature.Bind(vm.stack[vm.sp-numArgs:vm.sp], names)
+
+	if bindErr != nil {
+		return newError("%s", bindErr.Message)
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.growStack(frame.basePointer + cl.Fn.NumLocals)
+
+	copy(vm.stack[frame.basePointer:], args)
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	switch result := result.(type) {
+	case nil:
+		return vm.push(Null)
+	case *object.Boolean:
+		return vm.push(nativeBoolToBooleanObject(result.Value))
+	case *object.Error:
+		return fromObjectError(result)
+	default:
+		return vm.push(result)
+	}
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+
+	if !ok {
+		return newError("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	}
+
+	return 0
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case Null:
+		return false
+	case True:
+		return true
+	case False:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(native bool) *object.Boolean {
+	if native {
+		return True
+	}
+
+	return False
+}
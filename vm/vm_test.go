@@ -0,0 +1,1287 @@
+package vm
+
+import (
+	"bytes"
+	"dodo-lang/ast"
+	"dodo-lang/compiler"
+	"dodo-lang/lexer"
+	"dodo-lang/object"
+	"dodo-lang/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The cases below mirror evaluator_test.go so that both backends are held
+// to the same behaviour
+
+type vmTestCase struct {
+	input    string
+	expected any
+}
+
+// vmError marks an expected error message, compile and runtime errors alike
+type vmError string
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"2 ** -1", 0.5},
+		{"7.5 % 2", 1.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"7.0 / 2.0", 3.5},
+		{"10 - 0.5", 9.5},
+		{"7 / 2.0", 3.5},
+		{"2.5 * 2", 5.0},
+		{"float(3)", 3.0},
+		{"int(3.99)", 3},
+		{"int(1.0 / 0)", vmError("could not convert +Inf to an integer")},
+		{"1.5 < 2", true},
+		{"1 == 1.0", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 2.5", false},
+		{"true && 1 < 2", true},
+		{"true && false", false},
+		{"false || 5", true},
+		{"false || false", false},
+		{"false && (1 + true)", false},
+		{"true || (1 + true)", true},
+		{"true && (1 + true)", vmError("type mismatch: INTEGER + BOOLEAN")},
+		{"1.5 + true", vmError("type mismatch: FLOAT + BOOLEAN")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"!5", false},
+		{"!10", false},
+		{"!!5", true},
+		{"!-5", false},
+		{"!!-5", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"!true", false},
+		{"!!true", true},
+		{"!false", true},
+		{"!!false", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"foobar"`, "foobar"},
+		{`"hello world!"`, "hello world!"},
+		{`"5"`, "5"},
+		{`"foo" + "bar"`, "foobar"},
+		{`"foo" + "bar" + "baz"`, "foobarbaz"},
+		{`"foo " + "bar!"`, "foo bar!"},
+		{`let x = 2; "${x} + ${x} = ${x + x}"`, "2 + 2 = 4"},
+		{`"${[1, 2]} ${"a"}"`, "[1, 2] a"},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"foo" + "bar" == "foobar"`, true},
+		{`let s = "a"; s + "b" == "ab"`, true},
+		{`"${1 + 1}" == "2"`, true},
+		{`"" == ""`, true},
+		{`"1" == 1`, false},
+		{`enum Shape { Circle(r), Empty }; variant_of(Circle(1)) == "Circle"`, true},
+		{`enum Shape { Circle(r), Empty }; variant_of(Empty) != "Circle"`, true},
+		{`"a" < "b"`, vmError("unknown operator: STRING < STRING")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { return 10 }", 10},
+		{"if (false) { return 10 }", nil},
+		{"if (1) { return 10 }", 10},
+		{"if (1 < 2) { return 10 }", 10},
+		{"if (1 > 2) { return 10 }", nil},
+		{"if (1 > 2) { return 10 } else { return 20 }", 20},
+		{"if (1 < 2) { return 10 } else { return 20 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 < 2) { let a = 1; }", nil},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	describe := `let describe = fn(x) {
+	  match x {
+	    0 => "zero",
+	    -1 => "minus one",
+	    2.5 => "two and a half",
+	    true => "yes",
+	    "dodo" => "bird",
+	    [] => "empty",
+	    [a, b] => "pair ${a} ${b}",
+	    [first, ...rest] => "list of ${len(rest) + 1} from ${first}",
+	    {"name": n, "age": [years, _]} => "${n} is ${years}",
+	    {"name": n} => "named ${n}",
+	    n if n > 100 => { let big = "big"; big }
+	    _ => "other",
+	  }
+	};
+	`
+
+	tests := []vmTestCase{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + "describe(0.0)", "zero"},
+		{describe + "describe(2.5)", "two and a half"},
+		{describe + "describe(true)", "yes"},
+		{describe + `describe("dodo")`, "bird"},
+		{describe + "describe([])", "empty"},
+		{describe + "describe([1, 2])", "pair 1 2"},
+		{describe + "describe([1, 2, 3])", "list of 3 from 1"},
+		{describe + `describe({"name": "Ada", "age": [36, 0]})`, "Ada is 36"},
+		{describe + `describe({"name": "Ada", "age": 36})`, "named Ada"},
+		{describe + "describe(1000)", "big"},
+		{describe + "describe(5)", "other"},
+		{"let x = match [1, 2] { [a, b] => a + b }; x", 3},
+		{"let mut total = 0; for (p in [[1, 2], [3, 4]]) { match p { [a, b] => { total += a * b; } } } total", 14},
+		{"let f = fn(x) { match x { [a] => fn() { a } } }; f([7])()", 7},
+		{"let f = fn(xs) { for (x in xs) { match x { 0 => { return 100; } _ => {} } } 1 }; f([1, 0])", 100},
+		{"match 5 { 1 => 2, n if n > 5 => 3 }", vmError("no pattern matched 5")},
+		{"match 1 { a => a }; a", vmError("identifier not found: a")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let mut count = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+		  }
+
+		  count;
+			`, 10},
+		{`let mut count = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+		  }
+			`, nil},
+		{`let f = fn() {
+		    let mut count = 0;
+
+		    for (count < 10) {
+		      count = count + 1;
+
+		      if (count == 5) {
+		        return count;
+		      }
+		    }
+
+		    return 0;
+		  };
+
+		  f();
+			`, 5},
+		{`let mut count = 0;
+		  let mut sum = 0;
+
+		  for (count < 10) {
+		    count = count + 1;
+
+		    if (count % 2 == 0) {
+		      continue;
+		    }
+
+		    if (count > 7) {
+		      break;
+		    }
+
+		    sum = sum + count;
+		  }
+
+		  sum;
+			`, 16},
+		{`let mut i = 0;
+		  let mut j = 0;
+		  let mut total = 0;
+
+		  outer: for (i < 5) {
+		    i = i + 1;
+		    j = 0;
+
+		    for (j < 5) {
+		      j = j + 1;
+
+		      if (j == 3) {
+		        continue outer;
+		      }
+
+		      if (i == 4) {
+		        break outer;
+		      }
+
+		      total = total + 1;
+		    }
+		  }
+
+		  total;
+			`, 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let mut sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum", 6},
+		{"let mut sum = 0; for (i, x in [10, 20, 30]) { sum = sum + i * x; } sum", 80},
+		{`let mut out = ""; for (ch in "héllo") { out = ch + out; } out`, "olléh"},
+		{`let mut out = ""; for (k in {"b": 2, "a": 1, "c": 3}) { out = out + k; } out`, "abc"},
+		{`let mut out = ""; for (k, v in {"b": 2, "a": 1}) { out = out + "${k}=${v} "; } out`, "a=1 b=2 "},
+		{"for (x in [1, 2]) { x }", nil},
+		{"let mut sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } sum = sum + x; } sum", 4},
+		{"let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } 0 }; f([1, 5, 7])", 5},
+		{`let f = fn() {
+		    let mut n = 0;
+
+		    outer: for (a in [1, 2, 3]) {
+		      for (b in [1, 2, 3]) {
+		        if (b == 2) { continue outer; }
+		        if (a == 3) { break outer; }
+		        n = n + 1;
+		      }
+		    }
+
+		    n
+		  };
+
+		  f()`, 2},
+		{"let x = 100; for (x in [1, 2]) {} x", 100},
+		{"for (x in 5) {}", vmError("cannot iterate over INTEGER")},
+		// Closures made at the top level capture the variables of their own iteration
+		{"let mut fs = []; for (i in 0..3) { fs = push(fs, fn() { i }); } let r = [fs[0](), fs[1](), fs[2]()]; r", []int{0, 1, 2}},
+		{"let mut fs = []; for (k, v in [5, 6]) { fs = push(fs, fn() { k + v }); } let r = [fs[0](), fs[1]()]; r", []int{5, 7}},
+		{"let mut fs = []; for (x in [1, 2]) { fs = push(fs, fn() { fn() { x } }); } let r = [fs[0]()(), fs[1]()()]; r", []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestThreeClauseForExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let mut sum = 0; for (let mut i = 0; i < 5; i = i + 1) { sum = sum + i; } sum", 10},
+		{"let mut i = 0; for (i = 10; i > 0; i = i - 3) {} i", -2},
+		{"let mut n = 0; for (;;) { n = n + 1; if (n == 3) { break; } } n", 3},
+		{"let mut sum = 0; for (let mut i = 0; i < 5; i = i + 1) { if (i % 2 == 0) { continue; } sum = sum + i; } sum", 4},
+		{"for (let mut i = 0; i < 3; i = i + 1) {} for (let mut i = 0; i < 3; i = i + 1) {}", nil},
+		// Closures made at the top level capture the variables of their own iteration
+		{"let mut fs = []; for (let mut i = 0; i < 3; i += 1) { fs = push(fs, fn() { i }); } let r = [fs[0](), fs[2]()]; r", []int{0, 2}},
+		{"let mut fs = []; for (let mut i = 0; i < 3; i += 1) { let j = i; fs = push(fs, fn() { j }); } let r = [fs[0](), fs[2]()]; r", []int{0, 2}},
+		{"let mut fs = []; for (let mut i = 0; i < 3; i += 1) { let mut j = i; fs = push(fs, fn() { j += 10; j }); } let r = [fs[0](), fs[0](), fs[1]()]; r", []int{10, 20, 11}},
+		{"if (true) { let mut x = 1; let f = fn() { x += 1; }; f(); f(); x }", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][-1]", nil},
+		{`""[-1]`, nil},
+		{`"hello"[-2]`, "l"},
+		{`"hello world"[2]`, "l"},
+		{`"héllo"[1]`, "é"},
+		{`"日本語"[-1]`, "語"},
+		{`let myStr = "foobar"; let i = 1; myStr[i]`, "o"},
+		{"[1, 2, 3].0", 1},
+		{`"hello world".2`, "l"},
+		{`let str = "hello world"; (str.2) + (str.4) + (str.9);`, "lol"},
+		{"let myArray = [1, 2, 3]; myArray.2;", 3},
+		{"let myArray = [1, 2, 3]; (myArray.0) + (myArray.1) + (myArray.2);", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray.0; myArray.i", 2},
+		{"[1, 2, 3].3", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3, 4, 5][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4, 5][:2]", []int{1, 2}},
+		{"[1, 2, 3, 4, 5][3:]", []int{4, 5}},
+		{"[1, 2, 3, 4, 5][-2:]", []int{4, 5}},
+		{"[1, 2, 3, 4, 5][:-3]", []int{1, 2}},
+		{"[1, 2, 3, 4, 5][::2]", []int{1, 3, 5}},
+		{"[1, 2, 3, 4, 5][::-1]", []int{5, 4, 3, 2, 1}},
+		{"[1, 2, 3, 4, 5][3:0:-1]", []int{4, 3, 2}},
+		{"[1, 2, 3, 4, 5][-10:10]", []int{1, 2, 3, 4, 5}},
+		{"[1, 2, 3, 4, 5][3:1]", []int{}},
+		{"let i = 1; let arr = [1, 2, 3]; arr[i:i + 1]", []int{2}},
+		{`"hello"[:-2]`, "hel"},
+		{`"héllo"[1:3]`, "él"},
+		{`"hello"[::-1]`, "olleh"},
+		{`[1, 2][::0]`, vmError("slice step cannot be zero")},
+		{`5[1:2]`, vmError("cannot slice INTEGER")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRangeExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"len(0..10)", 10},
+		{"len(0..=10)", 11},
+		{"len(5..1)", 0},
+		{"let n = 3; len(0..n + 1)", 4},
+		{"len(-1..9223372036854775806)", 9223372036854775807},
+		{"len(-9223372036854775807 - 1..9223372036854775807)", vmError("length of range -9223372036854775808..9223372036854775807 does not fit in an integer")},
+		{"let mut n = 0; for (i in -9223372036854775807 - 1..=9223372036854775807) { if (n == 3) { break; } n += 1; } n", 3},
+		{"let mut sum = 0; for (i in 1..5) { sum = sum + i; } sum", 10},
+		{"let mut sum = 0; for (i in 1..=5) { sum = sum + i; } sum", 15},
+		{"let mut sum = 0; for (i, x in 10..13) { sum = sum + i * x; } sum", 35},
+		{"let mut n = 0; for (i in 0..1000000000) { if (i == 3) { break; } n = n + 1; } n", 3},
+		{`1.."a"`, vmError("range bounds must be INTEGER, got INTEGER .. STRING")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDotExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"hello world".len()`, 11},
+		{`"hello world".first()`, "h"},
+		{`"hello world".last()`, "d"},
+		{`"hello world".rest()`, "ello world"},
+		{`[1, 2, 3].push(4)`, []int{1, 2, 3, 4}},
+		{`[1, 2, 3].len()`, 3},
+		{`1.len`, vmError("cannot index *object.Integer")},
+		{`"hello world".doesnotexist()`, vmError("identifier not found: doesnotexist")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestPipeExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`let add = fn(x, y) {x + y};
+		  let result = 5 |> add(10, $);
+
+		  result;`, 15},
+		{`let add = fn(x, y) {x + y};
+		  let sub = fn(x, y) {x - y};
+		  let result = sub(10, 3) |> add($, 10);
+
+		  result;`, 17},
+		{`"hello".len() |> push([1, 2, 3, 4], $)`, []int{1, 2, 3, 4, 5}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { return 10; }", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []vmTestCase{
+		{"5 + true;", vmError("type mismatch: INTEGER + BOOLEAN")},
+		{"5 + true; 5;", vmError("type mismatch: INTEGER + BOOLEAN")},
+		{"-true", vmError("unknown operator: -BOOLEAN")},
+		{"true + false;", vmError("unknown operator: BOOLEAN + BOOLEAN")},
+		{"true + false + true + false;", vmError("unknown operator: BOOLEAN + BOOLEAN")},
+		{"5; true + false; 5", vmError("unknown operator: BOOLEAN + BOOLEAN")},
+		{"if (10 > 1) { true + false; }", vmError("unknown operator: BOOLEAN + BOOLEAN")},
+		{`"foo" - "bar"`, vmError("unknown operator: STRING - STRING")},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, vmError("unknown operator: BOOLEAN + BOOLEAN")},
+		{"foobar", vmError("identifier not found: foobar")},
+		{`{"name": "Dodo"}[fn(x) { x }];`, vmError("type of FUNCTION cannot be used as hash key")},
+		{`{fn(x) { x }: 1};`, vmError("type of 'FUNCTION' cannot be used as hash key")},
+		{`1(2)`, vmError("not a function: INTEGER")},
+		{`fn(x) { x }()`, vmError("wrong number of arguments: want=1, got=0")},
+		{"1 / 0", vmError("division by zero")},
+		{"let x = 0; 10 % x", vmError("division by zero")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallDepth(t *testing.T) {
+	count := "let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } };"
+
+	tests := []vmTestCase{
+		{count + "count(10000)", 10000},
+		{`
+	let fold = fn(arr, init, f) {
+	  let iter = fn(arr, result) {
+	    if (arr.len() == 0) {
+	      return result;
+	    } else {
+	      iter(arr.rest(), f(result, arr.first()));
+	    }
+	  }
+
+	  iter(arr, init);
+	}
+
+	let mut arr = [];
+	for (i in 0..2000) { arr = push(arr, 1); }
+
+	fold(arr, 0, fn(acc, el) { acc + el });`, 2000},
+		{"let f = fn(n) { f(n + 1) }; f(0)", vmError("stack overflow: exceeded 20000 nested calls")},
+	}
+
+	runVmTests(t, tests)
+
+	defer func(frames int) { MaxFrames = frames }(MaxFrames)
+	MaxFrames = 10
+
+	runVmTests(t, []vmTestCase{
+		{count + "count(20)", vmError("stack overflow: exceeded 10 nested calls")},
+		{count + "count(8)", 8},
+	})
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foobar", "1:1: identifier not found: foobar"},
+		{"let x = 5;\nlet y = x + true;", "2:11: type mismatch: INTEGER + BOOLEAN"},
+		{"let f = fn(x) {\n  x - \"a\";\n};\nf(1);", "2:5: type mismatch: INTEGER - STRING"},
+		{"let a = 1;\n\n  len(a);", "3:6: argument to `len` not supported, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(parse(tt.input))
+
+		if err == nil {
+			t.Errorf("expected error for %q, got none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let mut a = 5; a;", 5},
+		{"let mut a = 5 * 5; a;", 25},
+		{"let mut a = 5; let b = a; b;", 5},
+		{"let mut a = 5; let b = a; let c = a + b + 5; c;", 15},
+		{"let mut a = 5; let a = 5; a;", vmError("identifier 'a' already exists")},
+		{"let a = 5; let a = 5; a;", vmError("identifier 'a' already exists")},
+		{"let a = 1; let f = fn() { let a = 2; a }; f() * 10 + a;", 21},
+		{"let a = 1; let f = fn(a) { a * 2 }; f(5) + a;", 11},
+		{"let a = 1; if (true) { let a = 2; } a;", 1},
+		{"let a = 1; let mut b = 0; if (true) { let a = 2; b = a; } b;", 2},
+		{"let mut a = 1; for (x in [1, 2]) { let a = x * 10; } a;", 1},
+		{"let x = 100; for (x in [1, 2]) { let x = 3; } x;", 100},
+		{"let f = fn() { let a = 1; let a = 2; a }; f();", vmError("identifier 'a' already exists")},
+		{"let f = fn(a) { let a = 2; a }; f(1);", vmError("identifier 'a' already exists")},
+		{"if (true) { let a = 1; let a = 2; }", vmError("identifier 'a' already exists")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReassignmentStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let mut a = 3; a = 5; a;", 5},
+		{"let mut a = 3; let b = a; a = a + b + 5; a;", 11},
+		{"let a = 5; a = 3; a;", vmError("identifier 'a' is not mutable")},
+		{"let f = fn() { let mut a = 1; a = a + 1; a }; f();", 2},
+		{"let mut a = 3; a += 2; a;", 5},
+		{"let mut a = 3; a -= 5; a;", -2},
+		{"let mut a = 3; a *= 4; a;", 12},
+		{"let mut a = 12; a /= 4; a;", 3},
+		{"let mut arr = [1, 2, 3]; arr[0] = 5; arr[0] + arr[1];", 7},
+		{"let mut arr = [1, 2, 3]; arr[-1] = 10; arr[2];", 10},
+		{"let mut arr = [1, 2, 3]; arr[1] += 5; arr[1];", 7},
+		{"let mut arr = [[1, 2], [3, 4]]; arr[1][0] *= 10; arr[1][0] + arr[0][0];", 31},
+		{`let mut m = {"a": 1}; m["a"] = 2; m["b"] = 3; m["a"] + m["b"];`, 5},
+		{`let mut m = {"a": 1}; m["a"] += 1; m["a"];`, 2},
+		{`let mut m = {"xs": [1, 2]}; m["xs"][0] = 7; m["xs"][0];`, 7},
+		{`let mut m = {"a": 1}; let key = "a"; m.key = 4; m.key;`, 4},
+		{"let mut a = [1, 2]; let b = a; a[0] = 9; b[0];", 1},
+		{"let mut a = [1, 2]; let b = push(a, 3); a[0] = 9; len(a) + b[0];", 3},
+		{"let mut a = [1, 2]; a[0] = 5; let b = a; a[1] = 9; b[1];", 2},
+		{"let mut a = [[1], [2]]; a[0][0] = 5; let b = a[0]; a[0][0] = 7; b[0];", 5},
+		{"let mut a = [[1]]; a[0][0] = 2; let [x] = a; a[0][0] = 3; x[0];", 2},
+		{"let mut a = [1, 2]; a[0] = 5; let f = fn(x) { let mut y = x; y[1] = 9; y }; f(a); a[1];", 2},
+		{"let mut a = [1]; a[0] = 2; let b = push([], a); a[0] = 3; b[0][0];", 2},
+		{"let mut a = [1]; a[0] = 2; let b = unwrap(a); a[0] = 3; b[0];", 2},
+		{`let mut m = {"a": 1}; m["a"] = 2; let n = m; m["a"] = 3; n["a"];`, 2},
+		{"let mut a = [0, 0, 0]; let mut i = 1; for (i < len(a)) { a[i] = a[i - 1] + 1; i += 1; } a[2];", 2},
+		{"let mut fs = []; for (let mut xs = [0]; xs[0] < 2; xs[0] += 1) { fs = push(fs, fn() { xs[0] }); } fs[0]() + fs[1]();", 1},
+		{"let mut a = [1, 2]; for (i in 0..len(a)) { a[i] *= 2; } a[0] + a[1];", 6},
+		{"let mut i = 0; for (; i < 10; i += 3) {} i;", 12},
+		{"let f = fn() { let mut arr = [1, 2]; arr[1] += 1; arr }; f();", []int{1, 3}},
+		{"let arr = [1, 2]; arr[0] = 3;", vmError("identifier 'arr' is not mutable")},
+		{"let mut arr = [1, 2]; arr[5] = 3;", vmError("index 5 out of range for array of length 2")},
+		{`let mut s = "ab"; s[0] = "c";`, vmError("cannot assign to an index of STRING")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []vmTestCase{
+		{"let mut i = 0; for (i < 3) { let doubled = i * 2; i = i + 1; } i", 3},
+		{"for (x in [1, 2, 3]) { let y = x; } 0", 0},
+		{"let mut n = 0; if (true) { let y = 5; n = y; } n", 5},
+		{"let mut n = 0; if (false) {} else { let y = 7; n = y; } n", 7},
+		{"let mut total = 0; for (x in [1, 2]) { for (y in [10, 20]) { let p = x * y; total += p; } } total", 90},
+		{`let counter = fn() {
+		    let mut count = 0;
+		    fn() { count += 1; count }
+		  };
+		  let next = counter();
+		  next(); next(); next()`, 3},
+		{`let make = fn() {
+		    let mut count = 0;
+		    let inc = fn() { count += 1; };
+		    inc(); inc();
+		    count
+		  };
+		  make()`, 2},
+		{`let f = fn() {
+		    let mut total = 0;
+		    let add = fn(x) { fn() { total += x; } };
+		    add(2)(); add(3)();
+		    total
+		  };
+		  f()`, 5},
+		{`let f = fn() {
+		    let mut fns = [];
+		    for (let mut i = 0; i < 3; i += 1) { fns = push(fns, fn() { i }); }
+		    fns[0]() + fns[1]() + fns[2]()
+		  };
+		  f()`, 3},
+		{`let f = fn() {
+		    let mut items = [];
+		    let add = fn(x) { items = push(items, x); };
+		    add(1); add(2);
+		    len(items)
+		  };
+		  f()`, 2},
+		{"if (true) { let y = 1; } y", vmError("identifier not found: y")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []vmTestCase{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let noReturn = fn() { }; noReturn();", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let add = fn(x, y = 10) { x + y }; add(1)", 11},
+		{"let add = fn(x, y = 10) { x + y }; add(1, 2)", 3},
+		{"let f = fn(x, y = x * 2) { y }; f(4)", 8},
+		{"let base = 100; let f = fn(x = base) { x }; f()", 100},
+		{"let f = fn(x, y = fn() { x }) { y() }; f(7)", 7},
+		{"let f = fn(first, ...rest) { rest }; f(10, 1, 2, 3)", []int{1, 2, 3}},
+		{"let f = fn(first, ...rest) { len(rest) }; f(10)", 0},
+		{"let sum = fn(...xs) { let mut t = 0; for (x in xs) { t += x; } t }; sum(1, 2, 3)", 6},
+		{"let f = fn(x, y = 2, ...rest) { x * 100 + y * 10 + len(rest) }; f(1, 3, 5, 6)", 132},
+		{"let sub = fn(x, y) { x - y }; sub(y: 1, x: 10)", 9},
+		{"let sub = fn(x, y) { x - y }; sub(10, y: 3)", 7},
+		{"let f = fn(a, b = 2, c = 3) { a * 100 + b * 10 + c }; f(1, c: 5)", 125},
+		{"let sub = fn(x, y) { x - y }; 1 |> sub(10, y: $)", 9},
+		{"let add = fn(x, y) { x + y }; add(1)", vmError("wrong number of arguments: want=2, got=1")},
+		{"let add = fn(x, y) { x + y }; add(1, 2, 3)", vmError("wrong number of arguments: want=2, got=3")},
+		{"let f = fn(x, y = 1) { x }; f()", vmError("wrong number of arguments: want=1 to 2, got=0")},
+		{"let f = fn(x, ...rest) { x }; f()", vmError("wrong number of arguments: want=at least 1, got=0")},
+		{"let f = fn(x, y) { x }; f(y: 1)", vmError("missing argument for parameter 'x'")},
+		{"let f = fn(x) { x }; f(1, x: 2)", vmError("argument 'x' given more than once")},
+		{"let f = fn(x) { x }; f(z: 2)", vmError("unknown parameter 'z'")},
+		{`len(value: "abc")`, vmError("builtin functions do not take named arguments")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a * 10 + b", 12},
+		{"let [first, ...rest] = [1, 2, 3]; first + len(rest)", 3},
+		{"let [_, [x, y]] = [0, [3, 4]]; x * y", 12},
+		{`let {"name": n, "age": age} = {"name": "dodo", "age": 3}; len(n) + age`, 7},
+		{"let mut [a, b] = [1, 2]; a = 5; a + b", 7},
+		{`let f = fn([a, b], {"k": v}) { a + b + v }; f([1, 2], {"k": 3})`, 6},
+		{"let f = fn([a, b] = [1, 2]) { a * b }; f()", 2},
+		{"let f = fn([x, ...xs]) { fn() { x + len(xs) } }; f([5, 6])()", 6},
+		{"let mut total = 0; for (let mut [i, n] = [0, 3]; i < n; i += 1) { total += i; } total", 3},
+		{"let a = 1; if (true) { let [a] = [2]; } a", 1},
+		{"let [a, b] = [1, 2]; a = 5;", vmError("identifier 'a' is not mutable")},
+		{"let [a, b] = [1];", vmError("cannot destructure [1]: expected an array of length 2 to match [a, b], got length 1")},
+		{"let [a, ...b] = [];", vmError("cannot destructure []: expected an array of at least length 1 to match [a, ...b], got length 0")},
+		{"let [a] = 5;", vmError("cannot destructure 5: expected ARRAY to match [a], got INTEGER")},
+		{`let {"name": n} = {"age": 3};`, vmError("cannot destructure {age: 3}: missing key name to match {name: n}")},
+		{"let f = fn([a, b]) { a }; f([1]);", vmError("cannot destructure [1]: expected an array of length 2 to match [a, b], got length 1")},
+		{"let a = 1; let [a, b] = [1, 2];", vmError("identifier 'a' already exists")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStructs(t *testing.T) {
+	tests := []vmTestCase{
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age`, 36},
+		{`struct Person { name, age }; let p = Person(age: 36, name: "Ada"); p.name`, "Ada"},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age + 1`, 37},
+		{`struct Person { name, age }; let p = Person("Ada", 36); typeof(p)`, "Person"},
+		{"struct Person { name, age }; typeof(Person)", "STRUCT_TYPE"},
+		{`struct Person { name, age }; let p = Person("Ada", [1, 2]); p.age[1]`, 2},
+		{`struct Person { name, age }; let p = Person("Ada", 36); "${p}"`, "Person{name: Ada, age: 36}"},
+		{`struct Person { name, age }; "${Person}"`, "struct Person { name, age }"},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.age = 40; p.age`, 40},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.age += 1; p.age`, 37},
+		{`struct Person { name, age }; let p = Person("Ada", 36); let mut q = p; q.age = 1; p.age`, 36},
+		{`struct Line { from, to }; let mut l = Line({"x": 0}, {"x": 1}); l.to["x"] = 5; l.to["x"]`, 5},
+		{"let f = fn() { struct Point { x, y }; Point(1, 2) }; f().y", 2},
+		{`struct Person { name, age }; Person("Ada")`, vmError("wrong number of arguments: want=2, got=1")},
+		{`struct Person { name, age }; Person("Ada", height: 2)`, vmError("unknown parameter 'height'")},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.height`, vmError("Person has no field 'height'")},
+		{`struct Person { name, age }; let mut p = Person("Ada", 36); p.height = 1;`, vmError("Person has no field 'height'")},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p[0]`, vmError("type of INTEGER cannot be used to index Person")},
+		{`struct Person { name, age }; let p = Person("Ada", 36); p.age = 1;`, vmError("identifier 'p' is not mutable")},
+		{"struct Person { name, age }; struct Person { x }", vmError("identifier 'Person' already exists")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestEnums(t *testing.T) {
+	tests := []vmTestCase{
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(2).r", 2},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Rect(h: 3, w: 4).w * Rect(1, 5).h", 20},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(Circle(1))", "Circle"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(Empty)", "Empty"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; typeof(Rect(1, 2))", "Shape"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; typeof(Empty)", "Shape"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; "${Circle(1)} ${Rect(1, 2)} ${Empty}"`, "Circle(1) Rect(1, 2) Empty"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; "${Shape}"`, "enum Shape { Circle(r), Rect(w, h), Empty }"},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; let area = fn(s) { match variant_of(s) { "Circle" => 3 * s.r * s.r, "Rect" => s.w * s.h, _ => 0 } }; area(Circle(2)) + area(Rect(2, 3)) + area(Empty)`, 18},
+		{`enum Shape { Circle(r), Rect(w, h), Empty }; impl Shape { fn scale(self, k) { match variant_of(self) { "Circle" => Circle(self.r * k), _ => self } } } Circle(2).scale(3).r`, 6},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; let mut s = Rect(1, 2); s.w = 5; s.w", 5},
+		{`enum State { Pending, Failed(reason) }; let states = [Pending, Failed("timeout")]; states[1].reason`, "timeout"},
+		{"enum Unit { Made() }; variant_of(Made())", "Made"},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(1)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(1.0)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == Circle(2)", false},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) != Circle(2)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Rect(1, 2) == Rect(1, 2)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty == Empty", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty != Circle(1)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(Empty) == Circle(Empty)", true},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1) == 1", false},
+		{"enum A { X(v) }; enum B { Y(v) }; X(1) == Y(1)", false},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle()", vmError("wrong number of arguments: want=1, got=0")},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Circle(1).w", vmError("Circle has no field 'w'")},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; Empty()", vmError("not a function: ENUM")},
+		{"enum Shape { Circle(r), Rect(w, h), Empty }; variant_of(1)", vmError("argument to `variant_of` not supported, got INTEGER")},
+		{"let Circle = 1; enum Shape { Circle(r) }", vmError("identifier 'Circle' already exists")},
+		{"enum Shape { Shape }", vmError("identifier 'Shape' already exists")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 + "a" } catch (e) { e.message }`, "type mismatch: INTEGER + STRING"},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw "boom" } catch (e) { e }`, "boom"},
+		{`try { throw error("boom") } catch (e) { e.message }`, "boom"},
+		{`try { throw error("outer", error("inner")) } catch (e) { e.cause.message }`, "inner"},
+		{`try { throw error("boom") } catch (e) { is_error(e) }`, true},
+		{`try { [1, 2].missing } catch (e) { typeof(e) }`, "ERROR_VALUE"},
+		{`let f = fn(n) { if (n == 0) { throw n } f(n - 1) }; try { f(10) } catch (e) { e + 1 }`, 1},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e + 1 }`, 3},
+		{`let mut log = ""; let r = try { throw "x" } catch (e) { log += "catch "; 1 } finally { log += "finally" }; "${r} ${log}"`, "1 catch finally"},
+		{`let mut log = ""; let r = try { try { throw "x" } finally { log += "inner " } } catch (e) { log += e }; log`, "inner x"},
+		{`let mut log = ""; try { try { throw "x" } catch (e) { throw e + "y" } finally { log += "finally " } } catch (e) { log += e }; log`, "finally xy"},
+		{`let mut log = ""; let f = fn() { try { return 1 } finally { log += "finally" } }; "${f()} ${log}"`, "1 finally"},
+		{`let mut n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { continue } n += x } finally { n += 10 } }; n`, 34},
+		{`let mut n = 0; outer: for (x in [1, 2]) { for (y in [1, 2]) { try { if (y == 2) { break outer } n += 1 } finally { n += 10 } } }; n`, 21},
+		{`let mut n = 0; for (x in 0..100) { try { n += x } catch (e) { 0 } }; n`, 4950},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } s }; is_error(parse(""))`, true},
+		{`let parse = fn(s) { if (len(s) == 0) { return error("empty") } s }; is_error(parse("x"))`, false},
+		{`unwrap(5)`, 5},
+		{`try { unwrap(error("bad")) } catch (e) { e.message }`, "bad"},
+		{`try { undefined_var } catch (e) { e.message }`, "identifier not found: undefined_var"},
+		{`let x = 1; try { x = 2 } catch (e) { e.message }`, "identifier 'x' is not mutable"},
+		{`try { let a = 1; let a = 2; a } catch (e) { e.message }`, "identifier 'a' already exists"},
+		{`let f = try { fn() { missing } } catch (e) { 0 }; try { f() } catch (e) { e.message }`, "identifier not found: missing"},
+		{`"${error("a", error("b"))}"`, "error: a: b"},
+		{`let mut e = error("a"); e.message = "b"; e.message`, "b"},
+		{`if (error("a").cause) { 1 } else { 2 }`, 2},
+		{`throw "boom"`, vmError("boom")},
+		{`throw error("outer", error("inner"))`, vmError("outer: inner")},
+		{`unwrap(error("bad"))`, vmError("bad")},
+		{`try { 1 + "a" } finally { 0 }`, vmError("type mismatch: INTEGER + STRING")},
+		{`try { 1 } finally { throw "late" }`, vmError("late")},
+		{`try { throw 1 } catch (e) { throw "again" }`, vmError("again")},
+		{`error(1)`, vmError("argument to `error` must be STRING, got INTEGER")},
+		{`error("a").code`, vmError("error has no field 'code'")},
+		{`let mut e = error("a"); e.message = 1;`, vmError("message of an error must be a STRING, got INTEGER")},
+		{`let f = try { fn() { missing } } catch (e) { 0 }; f()`, vmError("identifier not found: missing")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMethods(t *testing.T) {
+	tests := []vmTestCase{
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet()`, "Hello, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet("Hi")`, "Hi, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet(greeting: "Hey")`, "Hey, Ada"},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.older(2).older(3).age`, 41},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.len()`, 36},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); "dodo".len()`, 4},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); let twice = fn(x) { x * 2 }; p.age.twice()`, 72},
+		{"struct Counter { n }; let step = 10; impl Counter { fn next(self) { Counter(self.n + step) } } Counter(1).next().n", 11},
+		{"struct Node { value, next }; impl Node { fn sum(self) { if (self.next == 0) { self.value } else { self.value + self.next.sum() } } } Node(1, Node(2, Node(3, 0))).sum()", 6},
+		{"struct P { x }; impl P { fn get(self) { 1 } } impl P { fn get(self) { 2 } } P(0).get()", 2},
+		{"struct P { cb }; let p = P(fn(x) { x * 2 }); p.cb(4)", 8},
+		{"struct P { cb }; let p = P(fn(x) { x * 2 }); (p.cb)(4)", 8},
+		{"let cb = fn(x) { 0 }; struct P { cb }; P(fn(x) { x + 1 }).cb(4)", 5},
+		{"struct P { cb }; P(fn(x, y = 1) { x + y }).cb(1, y: 10)", 11},
+		{"struct P { len }; impl P { fn len(self) { 1 } } P(fn() { 2 }).len()", 1},
+		{"enum Op { Apply(f) }; Apply(fn(a, b) { a - b }).f(5, 3)", 2},
+		{"struct P { cb }; P(1).cb()", vmError("not a function: INTEGER")},
+		{"struct P { cb }; P(1).missing()", vmError("identifier not found: missing")},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.fly()`, vmError("identifier not found: fly")},
+		{`struct Person { name, age }; impl Person { fn greet(self, greeting = "Hello") { "${greeting}, ${self.name}" } fn older(self, years) { Person(self.name, self.age + years) } fn len(self) { self.age } } let p = Person("Ada", 36); p.greet(1, 2)`, vmError("wrong number of arguments: want=1 to 2, got=3")},
+		{"impl Missing { fn f(self) { 1 } }", vmError("identifier not found: Missing")},
+		{"let x = 5; impl x { fn f(self) { 1 } }", vmError("cannot implement methods for INTEGER")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+	let newAdder = fn(x) { fn(y) { x + y }; };
+	let addTwo = newAdder(2);
+
+	addTwo(2);`, 4},
+		{`
+	let fold = fn(arr, init, f) {
+	  let iter = fn(arr, result) {
+	    if (arr.len() == 0) {
+	      return result;
+	    } else {
+	      iter(arr.rest(), f(result, arr.first()));
+	    }
+	  }
+
+	  iter(arr, init);
+	}
+
+	fold([1, 2, 3, 4, 5], 0, fn(acc, el) { acc + el });`, 15},
+	}
+
+	runVmTests(t, tests)
+}
+
+// Functions may refer to globals defined further down, like in the evaluator
+func TestForwardReferences(t *testing.T) {
+	tests := []vmTestCase{
+		{`
+	let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+	let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+
+	isEven(10);`, true},
+		{"let f = fn() { y }; let y = 5; f()", 5},
+		{"let f = fn() { fn() { y * 2 } }; let mut y = 5; y = 6; f()()", 12},
+		{"let f = fn() { Point(1, 2).y }; struct Point { x, y }; f()", 2},
+		{"let f = fn() { y }; f(); let y = 5;", vmError("identifier not found: y")},
+		{"let f = fn() { if (true) { let y = 1; } y }; f()", vmError("identifier not found: y")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len(1)`, vmError("argument to `len` not supported, got INTEGER")},
+		{`len("one", "two")`, vmError("wrong number of arguments. got=2, expected=1")},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest("hello world")`, "ello world"},
+		{`rest([])`, nil},
+		{`rest("")`, nil},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first("")`, nil},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last("")`, nil},
+		{`len("héllo")`, 5},
+		{`first("ñandú")`, "ñ"},
+		{`last("ñandú")`, "ú"},
+		{`rest("ñandú")`, "andú"},
+		{`bytes("hé")`, []int{104, 195, 169}},
+		{`push([1, 2, 3], 4);`, []int{1, 2, 3, 4}},
+		{`let myArray = [1, 2, 3];
+		  let newArray = push(myArray, 4);
+		  newArray;`, []int{1, 2, 3, 4}},
+		{`typeof("hello world")`, "STRING"},
+		{`typeof(9)`, "INTEGER"},
+		{`typeof(fn (x) { 420; })`, "FUNCTION"},
+		{`typeof(len)`, "BUILTIN"},
+		{`typeof("one", "two")`, vmError("wrong number of arguments. got=2, expected=1")},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDebugBuiltin(t *testing.T) {
+	pipeReader, pipeWriter, _ := os.Pipe()
+	stdout := os.Stdout
+	os.Stdout = pipeWriter
+
+	result, err := run(parse(`debug("hello world")`))
+
+	pipeWriter.Close()
+	os.Stdout = stdout
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	testExpectedObject(t, nil, result)
+
+	var buf bytes.Buffer
+	buf.ReadFrom(pipeReader)
+
+	if buf.String() != "hello world\n" {
+		t.Errorf("wrong std message. expected=%q, got=%q", "hello world\n", buf.String())
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	result, err := run(parse(input))
+
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	hash, ok := result.(*object.HashMap)
+
+	if !ok {
+		t.Fatalf("object is not HashMap. got=%T (%+v)", result, result)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		True.HashKey():                             5,
+		False.HashKey():                            6,
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash has wrong num of pairs. got=%d", len(hash.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := hash.Pairs[expectedKey]
+
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+			continue
+		}
+
+		testExpectedObject(t, int(expectedValue), pair.Value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`let key = "foo"; {"foo": 5}.key`, 5},
+		{`let map = {"foo": 5, true: 3}; (map."foo") + (map.true)`, 8},
+		{`{}."foo"`, nil},
+		{`{5: 5}.5`, 5},
+		{`{false: 5}.false`, 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func TestImportStatements(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"lib/fold.dodo": `
+let fold = fn(arr, init, f) {
+  let iter = fn(arr, result) {
+    if (arr.len() == 0) {
+      return result;
+    } else {
+      iter(arr.rest(), f(result, arr.first()));
+    }
+  }
+
+  iter(arr, init);
+};
+
+let answer = 42;`,
+		"math.dodo": `let double = fn(x) { x * 2 };`,
+		"counter.dodo": `
+let mut count = 0;
+let bump = fn() { count += 1; count };`,
+		"a.dodo":      `import counter;`,
+		"b.dodo":      `import counter;`,
+		"c.dodo":      `import d;`,
+		"d.dodo":      `import c;`,
+		"e.dodo":      `import main;`,
+		"broken.dodo": "let x = ;",
+	})
+
+	tests := []vmTestCase{
+		{`import "lib/fold.dodo"; fold.fold([1, 2, 3, 4, 5], 0, fn(acc, el) { acc + el })`, 15},
+		{`import "lib/fold.dodo"; fold.answer`, 42},
+		{`import "lib/fold.dodo"; let a = fold.answer; a + 1`, 43},
+		{`import math; math.double(21)`, 42},
+		{`import math; let double = 1; math.double(21) + double`, 43},
+		{`import math; let m = math; m.double(2)`, 4},
+		{`import math; typeof(math)`, "MODULE"},
+		{`import math; math.triple(1)`, vmError("module math has no binding 'triple'")},
+		{`import math; math.triple`, vmError("module math has no binding 'triple'")},
+		{`let math = 1; import math;`, vmError("identifier 'math' already exists")},
+		{`fn() { import math; }`, vmError("imports are only supported at the top level of a file")},
+		{`import counter; counter.bump(); counter.bump(); counter.count`, 2},
+		{`import a; import b; (a.counter) == (b.counter)`, true},
+		{`import c;`, vmError("import cycle: c.dodo -> d.dodo -> c.dodo")},
+		{`import e;`, vmError("import cycle: main.dodo -> e.dodo -> main.dodo")},
+		{`import "missing.dodo";`, vmError("could not import \"missing.dodo\": open " + filepath.Join(dir, "missing.dodo") + ": no such file or directory")},
+		{`import broken;`, vmError("could not import \"broken.dodo\": " + filepath.Join(dir, "broken.dodo") + ":1:9: no prefix parse function for ; found")},
+	}
+
+	runVmTestsWith(t, tests, func(input string) (object.Object, error) {
+		return runFile(filepath.Join(dir, "main.dodo"), input)
+	})
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	runVmTestsWith(t, tests, func(input string) (object.Object, error) {
+		return run(parse(input))
+	})
+}
+
+func runVmTestsWith(t *testing.T, tests []vmTestCase, run func(input string) (object.Object, error)) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result, err := run(tt.input)
+
+		if expectedErr, ok := tt.expected.(vmError); ok {
+			if err == nil {
+				t.Errorf("expected error %q for %q, got=%T (%+v)", expectedErr, tt.input, result, result)
+				continue
+			}
+
+			message := err.Error()
+
+			switch err := err.(type) {
+			case *Error:
+				message = err.Message
+			case *compiler.Error:
+				message = err.Message
+			}
+
+			if message != string(expectedErr) {
+				t.Errorf("wrong error message. expected=%q, got=%q", expectedErr, message)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("vm error for %q: %s", tt.input, err)
+			continue
+		}
+
+		testExpectedObject(t, tt.expected, result)
+	}
+}
+
+// runFile compiles and runs input as the content of the file filename, which
+// imports are relative to
+func runFile(filename string, input string) (object.Object, error) {
+	program := parser.New(lexer.NewFile(filename, input)).ParseProgram()
+	comp := compiler.New()
+
+	if err := comp.CompileFile(program, filename); err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+// writeModules creates the given files in a fresh directory and returns it
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func testExpectedObject(t *testing.T, expected any, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+
+		if !ok {
+			t.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if result.Value != int64(expected) {
+			t.Errorf("object has wrong value. got=%d, expected=%d", result.Value, expected)
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+
+		if !ok {
+			t.Errorf("object is not Float. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if result.Value != expected {
+			t.Errorf("object has wrong value. got=%g, expected=%g", result.Value, expected)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+
+		if !ok {
+			t.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if result.Value != expected {
+			t.Errorf("object has wrong value. got=%t, expected=%t", result.Value, expected)
+		}
+	case string:
+		result, ok := actual.(*object.String)
+
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if result.Value != expected {
+			t.Errorf("object has wrong value. got=%q, expected=%q", result.Value, expected)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.Elements[i])
+		}
+	case nil:
+		if actual != Null {
+			t.Errorf("object is not Null. got=%T (%+v)", actual, actual)
+		}
+	}
+}